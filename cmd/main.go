@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pizza-nz/url-shortener/config"
@@ -16,19 +20,34 @@ import (
 	"github.com/pizza-nz/url-shortener/middleware"
 	"github.com/pizza-nz/url-shortener/routes"
 	"github.com/pizza-nz/url-shortener/service"
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
 )
 
 // MainConfig holds the top-level configuration for the application,
-// aggregating server and database settings.
+// aggregating server, database and service settings.
 type MainConfig struct {
-	serverCfg *config.ServerConfig
-	dbCfg     *config.DBConfig
+	serverCfg  *config.ServerConfig
+	dbCfg      *config.DBConfig
+	serviceCfg *config.ServiceConfig
 }
 
 // cfg is a package-level variable holding the application's configuration.
 var cfg MainConfig
 
-// mustInitConfig initializes the server and database configurations.
+var (
+	// dbConnMu guards dbConn.
+	dbConnMu sync.Mutex
+	// dbConn is the connected database, set by connectWithRetry and closed on shutdown.
+	dbConn database.Database
+)
+
+// shutdowner is implemented by servers that can be shut down gracefully.
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// mustInitConfig initializes the server, database and service configurations.
 // It panics if loading the configuration fails, ensuring the application
 // does not start with invalid settings.
 func mustInitConfig() {
@@ -47,17 +66,37 @@ func mustInitConfig() {
 		os.Exit(1)
 	}
 
+	// Initialize ServiceConfig
+	serviceConfig, err := config.LoadServiceConfig()
+	if err != nil {
+		slog.Error("Failed to load service configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// Short links of this service, on any of its domains, are refused like those of known shorteners
+	baseURLs := []string{serverConfig.BaseURL}
+	for _, base := range serverConfig.BrandBaseURLMap {
+		baseURLs = append(baseURLs, base)
+	}
+	for _, base := range baseURLs {
+		if baseURL, err := url.Parse(base); err == nil && baseURL.Hostname() != "" {
+			serviceConfig.ShortenerDomainList = append(serviceConfig.ShortenerDomainList, strings.ToLower(baseURL.Hostname()))
+		}
+	}
+
 	cfg = MainConfig{
-		serverCfg: serverConfig,
-		dbCfg:     DBConfig,
+		serverCfg:  serverConfig,
+		dbCfg:      DBConfig,
+		serviceCfg: serviceConfig,
 	}
 	slog.Info("Configuration initialized successfully")
 }
 
 // connectWithRetry attempts to connect to the database with a retry mechanism.
 // It tries to connect every 10 seconds for up to 1 minute. If the connection
-// is successful, it sets the URL service for the handler.
-func connectWithRetry(handler handlers.ShortenedURLHandler) {
+// is successful, it sets the URL service for the handler and the admin API, if enabled,
+// and the database for the health checks.
+func connectWithRetry(handler handlers.ShortenedURLHandler, health *handlers.HealthHandler, admin *handlers.AdminHandler) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 	tickerAttempt := 1
@@ -74,7 +113,7 @@ func connectWithRetry(handler handlers.ShortenedURLHandler) {
 			return
 		case <-ticker.C:
 			slog.Info("Attempting to connect to the database", "Attempt", tickerAttempt)
-			conn, err := database.StartNewDatabase(cfg.dbCfg.ConnectionString(), cfg.dbCfg.RedactedConnectionString())
+			conn, err := database.StartNewDatabase(cfg.dbCfg)
 			if err != nil {
 				slog.Warn("connectWithRetry Failed to connect to the database, retrying...", "Attempt", tickerAttempt, "Error", err)
 				lastErr = err
@@ -82,7 +121,23 @@ func connectWithRetry(handler handlers.ShortenedURLHandler) {
 				continue
 			}
 
-			handler.SetServiceURL(service.NewURLService(conn))
+			dbConnMu.Lock()
+			dbConn = conn
+			dbConnMu.Unlock()
+
+			urlService := service.NewURLService(conn, cfg.serviceCfg)
+			if cfg.dbCfg.SeedFile != "" {
+				if _, _, err := service.Seed(urlService, cfg.dbCfg.SeedFile); err != nil {
+					slog.Error("Failed to seed the database", "file", cfg.dbCfg.SeedFile, "error", err)
+				}
+			}
+			handler.SetServiceURL(urlService)
+			if admin != nil {
+				admin.SetServiceURL(urlService)
+			}
+			if checker, ok := conn.(database.HealthChecker); ok {
+				health.SetDatabase(checker)
+			}
 
 			slog.Info("connectWithRetry connected successfully", "Total Attempts", tickerAttempt)
 			return
@@ -94,11 +149,20 @@ func connectWithRetry(handler handlers.ShortenedURLHandler) {
 // It initializes the logger, configuration, routes, and starts the server.
 // It also handles graceful shutdown on receiving an interrupt signal.
 func main() {
-	env := os.Getenv("ENV")
-	if env == "" {
-		env = "prod"
+	env := config.Environment()
+
+	logCfg, err := config.LoadLogConfig()
+	if err != nil {
+		slog.Error("Failed to load log configuration", "error", err)
+		os.Exit(1)
+	}
+	logger, err := logging.NewLogger(env, logCfg)
+	if err != nil {
+		slog.Error("Failed to create logger", "error", err)
+		os.Exit(1)
 	}
-	slog.SetDefault(logging.NewLogger(env))
+	// The logger is set as the default once, here, so every package logs consistently.
+	slog.SetDefault(logger)
 
 	// Command-line flag for listening address
 	listenAddr := flag.String("listenaddr", ":1232", "Address to listen on")
@@ -107,14 +171,118 @@ func main() {
 
 	mustInitConfig()
 
+	if err := utils.SetErrorFormat(cfg.serverCfg.ErrorFormat); err != nil {
+		slog.Error("Failed to set error format", "error", err)
+		os.Exit(1)
+	}
+
+	if err := utils.SetJSONCasing(cfg.serverCfg.JSONCasing); err != nil {
+		slog.Error("Failed to set JSON casing", "error", err)
+		os.Exit(1)
+	}
+
+	types.RequestIDHeader = http.CanonicalHeaderKey(cfg.serverCfg.RequestIDHeader)
+	handlers.SetRedirectCacheControl(cfg.serverCfg.RedirectCache)
+	if err := handlers.SetRedirectStatus(cfg.serverCfg.RedirectStatus); err != nil {
+		slog.Error("Failed to set redirect status", "error", err)
+		os.Exit(1)
+	}
+	if err := handlers.SetCreateGetResponse(cfg.serverCfg.CreateGet); err != nil {
+		slog.Error("Failed to set create GET response", "error", err)
+		os.Exit(1)
+	}
+	handlers.SetNoIndex(cfg.serverCfg.NoIndex)
+	handlers.SetValidationLogging(cfg.serverCfg.LogValidation, cfg.serverCfg.LogValidationRate)
+	handlers.SetBaseURL(cfg.serverCfg.BaseURL)
+	handlers.SetLocationHeaders(cfg.serverCfg.LocationHeaders)
+	handlers.SetEpochTimestamps(cfg.serverCfg.EpochTimestamps)
+	handlers.SetBrandBaseURLs(cfg.serverCfg.BrandBaseURLMap)
+	if cfg.serverCfg.Debug {
+		if env == config.EnvProd {
+			slog.Error("Debug mode must not be enabled in production", "env", env)
+			os.Exit(1)
+		}
+		slog.Warn("Debug mode enabled, responses include debugging details")
+		handlers.SetDebug(true)
+	}
+	if cfg.serverCfg.DebugErrors {
+		if env == config.EnvProd {
+			slog.Error("Debug errors must not be enabled in production", "env", env)
+			os.Exit(1)
+		}
+		slog.Warn("Debug errors enabled, error responses include internal messages and underlying errors")
+		utils.SetDebugErrors(true)
+	}
+
+	proxies, err := middleware.ParseTrustedProxies(cfg.serverCfg.TrustedProxies)
+	if err != nil {
+		slog.Error("Failed to parse trusted proxies", "error", err)
+		os.Exit(1)
+	}
+
+	createMiddleware := []func(http.Handler) http.Handler{middleware.ClientIPMiddleware(proxies)}
+	if cfg.serverCfg.QuotaPerIP > 0 || cfg.serverCfg.QuotaGlobal > 0 {
+		quota := middleware.NewCreationQuota(cfg.serverCfg.QuotaPerIP, cfg.serverCfg.QuotaGlobal, time.Duration(cfg.serverCfg.QuotaWindow)*time.Millisecond)
+		createMiddleware = append(createMiddleware, middleware.CreationQuotaMiddleware(quota, proxies, cfg.serverCfg.QuotaHeaders))
+	}
+	// Replayed retries are answered before the quota, so they don't count against it
+	idempotency := middleware.NewIdempotencyCache(time.Duration(cfg.serverCfg.IdempotencyTTL)*time.Millisecond, cfg.serverCfg.IdempotencyMax)
+	createMiddleware = append(createMiddleware, middleware.IdempotencyMiddleware(idempotency, proxies, cfg.serverCfg.IdempotencyKey))
+
+	landing, err := routes.LoadLandingTemplate(cfg.serverCfg.LandingTemplate)
+	if err != nil {
+		slog.Error("Failed to load landing template", "error", err, "path", cfg.serverCfg.LandingTemplate)
+		os.Exit(1)
+	}
+
 	mux := http.NewServeMux()
-	routes.RegisterStaticRoutes(mux)
-	handler := handlers.RegisterAPIRoutesWithMiddleware(mux, nil)
+	routes.RegisterStaticRoutes(mux, cfg.serverCfg.NoIndex, cfg.serverCfg.StaticRoutes, landing, cfg.serverCfg.BaseURL)
+	handler := handlers.RegisterAPIRoutesWithMiddleware(mux, nil, createMiddleware...)
+	handler.SetInterstitialDelay(cfg.serverCfg.Interstitial)
+	health := handlers.RegisterHealthRoutes(mux, cfg.serverCfg.DeepReadiness, time.Duration(cfg.serverCfg.ReadinessCache)*time.Millisecond)
+	handlers.RegisterMetricsRoutes(mux)
 
-	go connectWithRetry(handler)
+	var admin *handlers.AdminHandler
+	if cfg.serverCfg.AdminToken != "" {
+		admin = handlers.RegisterAdminRoutes(mux, cfg.serverCfg.AdminToken, cfg.serverCfg.AdminUI)
+		admin.SetExportMaxRows(cfg.serverCfg.ExportMaxRows)
+	}
+
+	go connectWithRetry(handler, health, admin)
+
+	var rootHandler http.Handler = mux
+	// The timeouts go inside the path rewrites, so the exempt event stream is matched by its cleaned and versioned path
+	if cfg.serverCfg.HandlerTimeout > 0 {
+		rootHandler = middleware.TimeoutMiddleware(time.Duration(cfg.serverCfg.HandlerTimeout)*time.Millisecond, handlers.AdminEventsPath)(rootHandler)
+	}
+	if cfg.serverCfg.MaxClientTimeout > 0 {
+		rootHandler = middleware.ClientTimeoutMiddleware(time.Duration(cfg.serverCfg.MaxClientTimeout)*time.Millisecond, handlers.AdminEventsPath)(rootHandler)
+	}
+	if cfg.serverCfg.APIVersioning == middleware.APIVersioningHeader {
+		rootHandler = middleware.AcceptVersionMiddleware(rootHandler)
+	}
+	rootHandler = middleware.CleanPathMiddleware(rootHandler)
+	if cfg.serverCfg.MaxDecompressedBytes > 0 {
+		rootHandler = middleware.DecompressMiddleware(cfg.serverCfg.MaxDecompressedBytes)(rootHandler)
+	}
+	if cfg.serviceCfg.VisitEvents {
+		// Visit events of redirects are annotated from the client IP
+		rootHandler = middleware.ClientIPMiddleware(proxies)(rootHandler)
+	}
+	if cfg.serverCfg.HTTPSRedirect {
+		rootHandler = middleware.HTTPSRedirectMiddleware(proxies)(rootHandler)
+	}
+	if cfg.serverCfg.HSTS {
+		rootHandler = middleware.HSTSMiddleware(proxies, cfg.serverCfg.HSTSMaxAge, cfg.serverCfg.HSTSSubdomains)(rootHandler)
+	}
 
 	cfg.serverCfg.Server.Addr = *listenAddr
-	cfg.serverCfg.Server.Handler = middleware.RequestIDMiddleware(mux)
+	rootHandler = middleware.RequestIDMiddleware(cfg.serverCfg.AccessLogSkipList)(rootHandler)
+	if logCfg.LogTraceIDs {
+		// Outermost, so every log of the request carries the trace and span IDs
+		rootHandler = middleware.TraceContextMiddleware(rootHandler)
+	}
+	cfg.serverCfg.Server.Handler = rootHandler
 
 	go cfg.serverCfg.MustStart()
 
@@ -127,11 +295,35 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	if err := cfg.serverCfg.Shutdown(shutdownCtx); err != nil {
-		slog.Error("Server shutdown failed", "error", err)
+	dbConnMu.Lock()
+	conn := dbConn
+	dbConnMu.Unlock()
+
+	if err := shutdown(shutdownCtx, cfg.serverCfg, conn); err != nil {
+		slog.Error("Shutdown failed", "error", err)
 	} else {
 		slog.Info("Server shutdown gracefully")
 	}
 
 	os.Exit(0)
-}
\ No newline at end of file
+}
+
+// shutdown drains the HTTP server and then closes the database, so in-flight requests can
+// still use their connections. The database is closed even if draining the server fails.
+func shutdown(ctx context.Context, server shutdowner, db database.Database) error {
+	serverErr := server.Shutdown(ctx)
+	if serverErr != nil {
+		slog.Error("Server shutdown failed", "error", serverErr)
+	}
+
+	if db == nil {
+		return serverErr
+	}
+	if err := db.Close(); err != nil {
+		slog.Error("Database close failed", "error", err)
+		return errors.Join(serverErr, err)
+	}
+	slog.Info("Database closed")
+
+	return serverErr
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// MockServer is a mock implementation of the shutdowner interface that records the call order.
+type MockServer struct {
+	calls *[]string
+	err   error
+}
+
+// Shutdown mocks the Shutdown method of the server.
+func (m *MockServer) Shutdown(ctx context.Context) error {
+	*m.calls = append(*m.calls, "server")
+	return m.err
+}
+
+// MockDatabase is a mock implementation of the Database interface that records the call order.
+type MockDatabase struct {
+	calls *[]string
+}
+
+// Get mocks the Get method of the Database interface.
+func (m *MockDatabase) Get(key string) (string, error) {
+	return "", nil
+}
+
+// Set mocks the Set method of the Database interface.
+func (m *MockDatabase) Set(key, value string) error {
+	return nil
+}
+
+// Exists mocks the Exists method of the Database interface.
+func (m *MockDatabase) Exists(key string) (bool, error) {
+	return false, nil
+}
+
+// Close mocks the Close method of the Database interface.
+func (m *MockDatabase) Close() error {
+	*m.calls = append(*m.calls, "database")
+	return nil
+}
+
+// BackendType mocks the BackendType method of the Database interface.
+func (m *MockDatabase) BackendType() string {
+	return "mock"
+}
+
+// TestShutdownClosesDatabase tests that shutdown closes the database after the server drains.
+func TestShutdownClosesDatabase(t *testing.T) {
+	// Test case 1: Server drains, then the database is closed
+	calls := []string{}
+	err := shutdown(context.Background(), &MockServer{calls: &calls}, &MockDatabase{calls: &calls})
+	if err != nil {
+		t.Errorf("shutdown() error = %v, wantErr nil", err)
+	}
+	if len(calls) != 2 || calls[0] != "server" || calls[1] != "database" {
+		t.Errorf("shutdown() calls = %v, want [server database]", calls)
+	}
+
+	// Test case 2: The database is closed even if the server fails to drain
+	calls = []string{}
+	err = shutdown(context.Background(), &MockServer{calls: &calls, err: errors.New("deadline exceeded")}, &MockDatabase{calls: &calls})
+	if err == nil {
+		t.Error("Expected an error from the server shutdown, but got nil")
+	}
+	if len(calls) != 2 || calls[1] != "database" {
+		t.Errorf("shutdown() calls = %v, want [server database]", calls)
+	}
+
+	// Test case 3: No database connected yet
+	calls = []string{}
+	if err := shutdown(context.Background(), &MockServer{calls: &calls}, nil); err != nil {
+		t.Errorf("shutdown() error = %v, wantErr nil", err)
+	}
+}
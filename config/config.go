@@ -2,13 +2,20 @@ package config
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pizza-nz/url-shortener/types"
@@ -22,6 +29,34 @@ type DBConfig struct {
 	DBName string `default:"url_shortener"` // Database name
 	DBUser string `default:"user"`          // Database user
 	DBPass string `default:"password"`      // Database password
+
+	DatabaseURL   string // Full connection string, URL or key=value DSN, taking precedence over the DB_* parts
+	DBSSLMode     string `default:"disable"` // sslmode of the built connection string: disable, require or verify-full
+	DBSSLRootCert string // PEM CA certificate file verifying the server certificate of the built connection string
+
+	DBCompressMap       bool `default:"false"` // Store long URLs compressed in the in-memory map
+	DBRequirePersistent bool `default:"false"` // Refuse to fall back to the in-memory map
+
+	Environment string // Deployment environment from ENV, prod set explicitly refuses the in-memory map
+
+	SeedFile string // JSON or CSV file of short URLs loaded at startup
+
+	DBListOrder string `default:"code"` // Order of listed URLs: code, or created_at with URLs without a creation time last
+
+	DBEncrypt         bool              // Encrypt long URLs at rest with AES-GCM
+	DBEncryptionKeys  map[string][]byte // AES keys by key id, old ids are kept to decrypt rows written before a rotation
+	DBEncryptionKeyID string            // Key id used to encrypt new long URLs
+}
+
+// EnvProd is the ENV value of production deployments, and the default when ENV is unset.
+const EnvProd = "prod"
+
+// Environment returns the deployment environment from ENV, EnvProd if unset.
+func Environment() string {
+	if env := os.Getenv("ENV"); env != "" {
+		return env
+	}
+	return EnvProd
 }
 
 // LoadDBConfig loads the database configuration from environment variables.
@@ -36,27 +71,407 @@ func LoadDBConfig() (*DBConfig, error) {
 	cfg.DBName = os.Getenv("DB_NAME")
 	cfg.DBUser = os.Getenv("DB_USER")
 	cfg.DBPass = os.Getenv("DB_PASS")
+	cfg.DatabaseURL = os.Getenv("DATABASE_URL")
+	cfg.DBSSLRootCert = os.Getenv("DB_SSLROOTCERT")
+	cfg.SeedFile = os.Getenv("SEED_FILE")
+
+	cfg.DBSSLMode = os.Getenv("DB_SSLMODE")
+	switch cfg.DBSSLMode {
+	case "":
+		cfg.DBSSLMode = "disable"
+	case "disable", "require", "verify-full":
+	default:
+		return nil, types.NewConfigError(fmt.Sprintf("DB_SSLMODE must be disable, require or verify-full, got %q", cfg.DBSSLMode), nil)
+	}
+
+	if v := os.Getenv("DB_COMPRESS_MAP"); v != "" {
+		compress, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, types.NewConfigError("DB_COMPRESS_MAP must be a boolean", err)
+		}
+		cfg.DBCompressMap = compress
+	}
+
+	if v := os.Getenv("DB_REQUIRE_PERSISTENT"); v != "" {
+		requirePersistent, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, types.NewConfigError("DB_REQUIRE_PERSISTENT must be a boolean", err)
+		}
+		cfg.DBRequirePersistent = requirePersistent
+	}
+
+	cfg.Environment = Environment()
+	// The in-memory map loses every short URL on restart, never acceptable in production.
+	// Only an explicit ENV=prod trips this, so local runs without ENV keep starting against the map.
+	if os.Getenv("ENV") == EnvProd && cfg.ConnectionString() == "" {
+		return nil, types.NewConfigError("ENV is prod but no database is configured, refusing to use the in-memory map", nil)
+	}
+
+	cfg.DBListOrder = os.Getenv("DB_LIST_ORDER")
+	switch cfg.DBListOrder {
+	case "":
+		cfg.DBListOrder = "code"
+	case "code", "created_at":
+	default:
+		return nil, types.NewConfigError(fmt.Sprintf("DB_LIST_ORDER must be code or created_at, got %q", cfg.DBListOrder), nil)
+	}
+
+	if v := os.Getenv("DB_ENCRYPT"); v != "" {
+		encrypt, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, types.NewConfigError("DB_ENCRYPT must be a boolean", err)
+		}
+		cfg.DBEncrypt = encrypt
+	}
+
+	if cfg.DBEncrypt {
+		keys, err := parseEncryptionKeys(os.Getenv("DB_ENCRYPTION_KEYS"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.DBEncryptionKeys = keys
+		cfg.DBEncryptionKeyID = os.Getenv("DB_ENCRYPTION_KEY_ID")
+		if _, ok := keys[cfg.DBEncryptionKeyID]; !ok {
+			return nil, types.NewConfigError(fmt.Sprintf("DB_ENCRYPTION_KEY_ID %q is not in DB_ENCRYPTION_KEYS", cfg.DBEncryptionKeyID), nil)
+		}
+	}
+
+	if cfg.DBSSLRootCert != "" {
+		if err := checkCACert(cfg.DBSSLRootCert); err != nil {
+			return nil, err
+		}
+	}
+
+	if conn := cfg.ConnectionString(); conn != "" {
+		if _, err := pgxpool.ParseConfig(conn); err != nil {
+			return nil, types.NewConfigError("Invalid database connection string "+cfg.RedactedConnectionString(), err)
+		}
+	}
 
 	return cfg, nil
 }
 
-// ConnectionString returns the formatted connection string for the database.
+// parseEncryptionKeys parses comma-separated "id:base64key" pairs into AES keys by key id.
+// Keys must decode to 16, 24 or 32 bytes, selecting AES-128, AES-192 or AES-256.
+func parseEncryptionKeys(s string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, types.NewConfigError("DB_ENCRYPTION_KEYS must be comma-separated id:base64key pairs", nil)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, types.NewConfigError(fmt.Sprintf("DB_ENCRYPTION_KEYS key %q is not valid base64", id), err)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, types.NewConfigError(fmt.Sprintf("DB_ENCRYPTION_KEYS key %q must be 16, 24 or 32 bytes, got %d", id, n), nil)
+		}
+		keys[id] = key
+	}
+	if len(keys) == 0 {
+		return nil, types.NewConfigError("DB_ENCRYPTION_KEYS must be set when DB_ENCRYPT is enabled", nil)
+	}
+	return keys, nil
+}
+
+// ConnectionString returns the connection string for the database.
+// DatabaseURL is returned as is if set, otherwise a postgres:// URL is built from the DB_* parts with the configured sslmode.
+// It returns an empty string if neither DatabaseURL nor a host is configured, selecting the in-memory map.
 func (cfg *DBConfig) ConnectionString() string {
-	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", cfg.DBUser, cfg.DBPass, cfg.DBHost, cfg.DBPort, cfg.DBName)
+	if cfg.DatabaseURL != "" {
+		return cfg.DatabaseURL
+	}
+	if cfg.DBHost == "" {
+		return ""
+	}
+	sslMode := cfg.DBSSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	query := url.Values{"sslmode": {sslMode}}
+	if cfg.DBSSLRootCert != "" {
+		// pgx loads the CA into the TLS config of every connection, including migrations
+		query.Set("sslrootcert", cfg.DBSSLRootCert)
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.DBUser, cfg.DBPass),
+		Host:     cfg.DBHost + ":" + cfg.DBPort,
+		Path:     "/" + cfg.DBName,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
 }
 
-// RedactedConnectionString returns the formatted connection string for the database with the password redacted.
+// checkCACert checks that the file at path holds at least one PEM CA certificate,
+// so a missing or malformed certificate fails at startup rather than on the first connection.
+func checkCACert(path string) error {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return types.NewConfigError("Failed to read DB_SSLROOTCERT", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+		return types.NewConfigError("DB_SSLROOTCERT contains no PEM certificate: "+path, nil)
+	}
+	return nil
+}
+
+// dsnPassword matches the password of a key=value DSN, quoted or not.
+var dsnPassword = regexp.MustCompile(`password=('(\\.|[^'])*'|\S+)`)
+
+// RedactedConnectionString returns the connection string for the database with the password redacted.
 func (cfg *DBConfig) RedactedConnectionString() string {
-	return fmt.Sprintf("postgres://%s:xxxxx@%s:%s/%s?sslmode=disable", cfg.DBUser, cfg.DBHost, cfg.DBPort, cfg.DBName)
+	conn := cfg.ConnectionString()
+	if u, err := url.Parse(conn); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(conn, "password=xxxxx")
+}
+
+// ServiceConfig holds the configuration for the URL shortening service.
+// It includes the optional behaviors applied when creating and resolving short URLs.
+type ServiceConfig struct {
+	ResolveRedirects   int    `env:"RESOLVEREDIRECTS" default:"0"`                                          // Maximum redirects followed at creation, 0 disables resolving
+	ResolveTimeout     int    `env:"RESOLVETIMEOUT" default:"5000"`                                         // Timeout in milliseconds for resolving redirects
+	CounterOffset      uint64 `env:"COUNTEROFFSET" default:"0"`                                             // Starting offset added to the counters used for code generation
+	CounterBlockSize   uint64 `env:"COUNTERBLOCKSIZE" default:"1"`                                          // Counter values allocated per database round trip
+	CheckDigit         bool   `env:"CHECKDIGIT" default:"false"`                                            // Append a check character to generated codes to catch typos
+	SignCodes          bool   `env:"SIGNCODES" default:"false"`                                             // Append an HMAC signature to codes, rejecting forged codes before a lookup
+	SigningKey         string `env:"SIGNINGKEY" default:""`                                                 // Secret key of the code signatures
+	SignatureLength    int    `env:"SIGNATURELENGTH" default:"4"`                                           // Characters of the code signature
+	CodeGenerator      string `env:"CODEGENERATOR" default:"sqids"`                                         // Short code generator: sqids, hash or sequence
+	HashLength         int    `env:"HASHLENGTH" default:"7"`                                                // Base code length of the hash generator
+	OutboundHeaders    string `env:"OUTBOUNDHEADERS" default:""`                                            // Comma-separated Name:Value headers sent on outbound requests
+	RecordCreator      bool   `env:"RECORDCREATOR" default:"false"`                                         // Record the creator IP and creation time for abuse investigation
+	Dedup              bool   `env:"DEDUP" default:"false"`                                                 // Return the existing short URL when a long URL is shortened again
+	DedupSalt          string `env:"DEDUPSALT" default:""`                                                  // Secret salt of the long URL hashes used for dedup
+	LongURLLookup      bool   `env:"LONGURLLOOKUP" default:"false"`                                         // Serve the lookup of existing short URLs by long URL on the admin API, requires DEDUP
+	ValidateDNS        bool   `env:"VALIDATEDNS" default:"false"`                                           // Reject long URLs whose host doesn't resolve
+	DNSTimeout         int    `env:"DNSTIMEOUT" default:"1000"`                                             // Timeout in milliseconds of a DNS lookup
+	DNSCacheTTL        int    `env:"DNSCACHETTL" default:"300"`                                             // Seconds a DNS lookup result is cached
+	BlockPrivateIPs    bool   `env:"BLOCKPRIVATEIPS" default:"false"`                                       // Reject long URLs whose host is or resolves to a private or internal IP
+	LinkPreviews       bool   `env:"LINKPREVIEWS" default:"false"`                                          // Fetch the OpenGraph metadata of long URLs at creation for the record endpoint
+	LinkPreviewTimeout int    `env:"LINKPREVIEWTIMEOUT" default:"3000"`                                     // Timeout in milliseconds of fetching a link preview
+	LinkPreviewTTL     int    `env:"LINKPREVIEWTTL" default:"86400"`                                        // Seconds a link preview is cached
+	LinkPreviewMax     int    `env:"LINKPREVIEWMAX" default:"10000"`                                        // Maximum cached link previews, the least recently used are evicted
+	RejectShortURLs    bool   `env:"REJECTSHORTURLS" default:"false"`                                       // Reject long URLs pointing at this service or a known shortener
+	ShortenerDomains   string `env:"SHORTENERDOMAINS" default:"bit.ly,t.co,tinyurl.com,goo.gl,ow.ly,is.gd"` // Comma-separated domains of known shorteners, rejected with their subdomains
+	InvalidCodes       string `env:"INVALIDCODES" default:"lenient"`                                        // Status of lookups of codes that can't exist: strict for 400, lenient for 404
+	CheckReachable     bool   `env:"CHECKREACHABLE" default:"false"`                                        // Reject long URLs that don't answer a HEAD request with a status below 400
+	ReachableTimeout   int    `env:"REACHABLETIMEOUT" default:"3000"`                                       // Timeout in milliseconds of the reachability check
+	FetchProxy         bool   `env:"FETCHPROXY" default:"false"`                                            // Serve the fetch proxy of the admin API, fetching long URLs server-side
+	FetchProxyTimeout  int    `env:"FETCHPROXYTIMEOUT" default:"10000"`                                     // Timeout in milliseconds of connecting to and receiving headers from a proxied long URL
+	FetchProxyMaxBytes int64  `env:"FETCHPROXYMAXBYTES" default:"5242880"`                                  // Maximum size in bytes of a proxied response
+	FetchProxyTypes    string `env:"FETCHPROXYTYPES" default:"text/html,text/plain"`                        // Comma-separated media types a proxied response may have
+	BrandAlphabets     string `env:"BRANDALPHABETS" default:""`                                             // Comma-separated host=alphabet pairs of branded domains generating codes with their own sqids alphabet
+	HostCreationLimit  int    `env:"HOSTCREATIONLIMIT" default:"0"`                                         // Maximum short URLs created per long URL host per sliding window, 0 disables
+	HostCreationWindow int    `env:"HOSTCREATIONWINDOW" default:"3600000"`                                  // Sliding window in milliseconds of the per host creation limit
+	VisitEvents        bool   `env:"VISITEVENTS" default:"false"`                                           // Publish an event for every redirect to the event stream
+	GeoResolver        string `env:"GEORESOLVER" default:"none"`                                            // Resolver annotating visit events with the client country and ASN: none or maxmind
+	GeoTimeout         int    `env:"GEOTIMEOUT" default:"1000"`                                             // Timeout in milliseconds of resolving a client IP
+	MaxMindAccountID   string `env:"MAXMINDACCOUNTID" default:""`                                           // Account ID of the MaxMind GeoIP2 web service
+	MaxMindLicenseKey  string `env:"MAXMINDLICENSEKEY" default:""`                                          // License key of the MaxMind GeoIP2 web service
+
+	OutboundHeader      http.Header       `ignored:"true"` // Parsed OutboundHeaders
+	ShortenerDomainList []string          `ignored:"true"` // Parsed ShortenerDomains, main adds the host of BASEURL
+	FetchProxyTypeList  []string          `ignored:"true"` // Parsed FetchProxyTypes
+	BrandAlphabetMap    map[string]string `ignored:"true"` // Parsed BrandAlphabets, by lowercase host
+}
+
+// LoadServiceConfig loads the service configuration from environment variables.
+// It returns a ServiceConfig instance or an error if loading fails.
+func LoadServiceConfig() (*ServiceConfig, error) {
+	cfg := &ServiceConfig{}
+	if err := envconfig.Process("", cfg); err != nil {
+		return nil, types.NewConfigError("Failed to load service configuration", err)
+	}
+
+	if cfg.Dedup && cfg.DedupSalt == "" {
+		return nil, types.NewConfigError("DEDUPSALT must be set when DEDUP is enabled", nil)
+	}
+	if cfg.LongURLLookup && !cfg.Dedup {
+		return nil, types.NewConfigError("DEDUP must be enabled when LONGURLLOOKUP is enabled", nil)
+	}
+
+	if cfg.SignCodes && cfg.SigningKey == "" {
+		return nil, types.NewConfigError("SIGNINGKEY must be set when SIGNCODES is enabled", nil)
+	}
+	if cfg.SignCodes && (cfg.SignatureLength < 1 || cfg.SignatureLength > 32) {
+		return nil, types.NewConfigError("SIGNATURELENGTH must be between 1 and 32", nil)
+	}
+
+	if cfg.HostCreationLimit > 0 && cfg.HostCreationWindow <= 0 {
+		return nil, types.NewConfigError("HOSTCREATIONWINDOW must be positive when HOSTCREATIONLIMIT is set", nil)
+	}
+
+	switch cfg.GeoResolver {
+	case "none":
+	case "maxmind":
+		if cfg.MaxMindAccountID == "" || cfg.MaxMindLicenseKey == "" {
+			return nil, types.NewConfigError("MAXMINDACCOUNTID and MAXMINDLICENSEKEY must be set when GEORESOLVER is maxmind", nil)
+		}
+	default:
+		return nil, types.NewConfigError("GEORESOLVER must be none or maxmind: "+cfg.GeoResolver, nil)
+	}
+
+	if cfg.InvalidCodes != "strict" && cfg.InvalidCodes != "lenient" {
+		return nil, types.NewConfigError("INVALIDCODES must be strict or lenient: "+cfg.InvalidCodes, nil)
+	}
+
+	header, err := parseHeaders(cfg.OutboundHeaders)
+	if err != nil {
+		return nil, err
+	}
+	cfg.OutboundHeader = header
+
+	for _, domain := range strings.Split(cfg.ShortenerDomains, ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			cfg.ShortenerDomainList = append(cfg.ShortenerDomainList, domain)
+		}
+	}
+
+	for _, mediaType := range strings.Split(cfg.FetchProxyTypes, ",") {
+		if mediaType = strings.ToLower(strings.TrimSpace(mediaType)); mediaType != "" {
+			cfg.FetchProxyTypeList = append(cfg.FetchProxyTypeList, mediaType)
+		}
+	}
+
+	alphabets, err := parseBrandAlphabets(cfg.BrandAlphabets)
+	if err != nil {
+		return nil, err
+	}
+	cfg.BrandAlphabetMap = alphabets
+
+	return cfg, nil
+}
+
+// parseBrandAlphabets parses a comma-separated list of host=alphabet pairs into a map by lowercase host.
+// An alphabet must have at least 3 unique ASCII letters and digits, so its codes pass the same validation,
+// check characters and signatures as the default alphabet. An empty string returns an empty map.
+func parseBrandAlphabets(list string) (map[string]string, error) {
+	alphabets := map[string]string{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, alphabet, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		alphabet = strings.TrimSpace(alphabet)
+		if !ok || host == "" {
+			return nil, types.NewConfigError("Invalid brand alphabet, expected host=alphabet: "+entry, nil)
+		}
+		if len(alphabet) < 3 {
+			return nil, types.NewConfigError("Brand alphabet of "+host+" must have at least 3 characters", nil)
+		}
+		seen := map[rune]bool{}
+		for _, c := range alphabet {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') || seen[c] {
+				return nil, types.NewConfigError("Brand alphabet of "+host+" must only contain unique letters and digits", nil)
+			}
+			seen[c] = true
+		}
+		alphabets[host] = alphabet
+	}
+	return alphabets, nil
+}
+
+// parseHeaders parses a comma-separated list of Name:Value pairs into an http.Header.
+// An empty string returns an empty header.
+func parseHeaders(list string) (http.Header, error) {
+	header := http.Header{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, types.NewConfigError("Invalid outbound header, expected Name:Value: "+name, nil)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// LogConfig holds the configuration for the application logger.
+type LogConfig struct {
+	LogLevel  string `env:"LOGLEVEL" default:"info"`  // Minimum log level: debug, info, warn or error
+	LogFormat string `env:"LOGFORMAT" default:"json"` // Log format: json or text
+	LogURLs   string `env:"LOGURLS" default:"always"` // When long URLs are logged: always, or errors for warnings and errors only
+
+	LogTraceIDs bool `env:"LOGTRACEIDS" default:"false"` // Propagate W3C trace context and log the trace and span IDs of requests
+}
+
+// LoadLogConfig loads the logger configuration from environment variables.
+// It returns a LogConfig instance or an error if loading fails.
+func LoadLogConfig() (*LogConfig, error) {
+	cfg := &LogConfig{}
+	if err := envconfig.Process("", cfg); err != nil {
+		return nil, types.NewConfigError("Failed to load log configuration", err)
+	}
+	return cfg, nil
 }
 
 // ServerConfig holds the configuration for the HTTP server.
 // It includes listen address, timeouts, and the server instance itself.
 type ServerConfig struct {
-	ListenAddr   string `env:"LISTENADDR" default:":1232"`   // Address to listen on
-	ReadTimeout  int    `env:"READTIMEOUT" default:"10000"`  // Read timeout in milliseconds
-	WriteTimeout int    `env:"WRITETIMEOUT" default:"10000"` // Write timeout in milliseconds
-	IdleTimeout  int    `env:"IDLETIMEOUT" default:"120000"` // Idle timeout in milliseconds
+	ListenAddr           string `env:"LISTENADDR" default:":1232"`             // Address to listen on
+	ReadTimeout          int    `env:"READTIMEOUT" default:"10000"`            // Read timeout in milliseconds
+	ReadHeaderTimeout    int    `env:"READHEADERTIMEOUT" default:"5000"`       // Timeout in milliseconds for reading request headers, guards against slowloris
+	MaxHeaderBytes       int    `env:"MAXHEADERBYTES" default:"65536"`         // Maximum size in bytes of the request headers
+	WriteTimeout         int    `env:"WRITETIMEOUT" default:"10000"`           // Write timeout in milliseconds
+	IdleTimeout          int    `env:"IDLETIMEOUT" default:"120000"`           // Idle timeout in milliseconds
+	HandlerTimeout       int    `env:"HANDLERTIMEOUT" default:"0"`             // Handler timeout in milliseconds, 0 disables
+	MaxClientTimeout     int    `env:"MAXCLIENTTIMEOUT" default:"0"`           // Maximum X-Request-Timeout in milliseconds, 0 ignores the header
+	MaxDecompressedBytes int64  `env:"MAXDECOMPRESSEDBYTES" default:"1048576"` // Maximum size in bytes of a gzip request body once decompressed, 0 rejects gzip
+
+	DeepReadiness     bool   `env:"DEEPREADINESS" default:"false"`                     // Readiness probe performs a write/read round trip
+	ReadinessCache    int    `env:"READINESSCACHE" default:"1000"`                     // Milliseconds a readiness result is reused, 0 checks on every probe
+	HTTPSRedirect     bool   `env:"HTTPSREDIRECT" default:"false"`                     // Redirect plain HTTP requests to HTTPS
+	HSTS              bool   `env:"HSTS" default:"false"`                              // Send Strict-Transport-Security on HTTPS responses
+	HSTSMaxAge        int    `env:"HSTSMAXAGE" default:"31536000"`                     // Seconds browsers only use HTTPS for the host
+	HSTSSubdomains    bool   `env:"HSTSSUBDOMAINS" default:"false"`                    // Extend HSTS to all subdomains
+	TrustedProxies    string `env:"TRUSTEDPROXIES" default:""`                         // Comma-separated CIDRs whose forwarding headers are trusted
+	ErrorFormat       string `env:"ERRORFORMAT" default:"json"`                        // Error response format: json or problem (RFC 7807)
+	JSONCasing        string `env:"JSONCASING" default:"camel"`                        // JSON response key casing: camel or snake
+	RequestIDHeader   string `env:"REQUESTIDHEADER" default:"X-Request-ID"`            // Header used to read and write the request ID
+	QuotaPerIP        int    `env:"QUOTAPERIP" default:"0"`                            // Maximum creations per client IP per quota window, 0 disables
+	QuotaGlobal       int    `env:"QUOTAGLOBAL" default:"0"`                           // Maximum creations across all clients per quota window, 0 disables
+	QuotaWindow       int    `env:"QUOTAWINDOW" default:"86400000"`                    // Creation quota window in milliseconds
+	QuotaHeaders      bool   `env:"QUOTAHEADERS" default:"false"`                      // Send X-RateLimit-* headers with the remaining creation quota
+	IdempotencyKey    bool   `env:"IDEMPOTENCYKEY" default:"false"`                    // Require an Idempotency-Key header on creations
+	IdempotencyTTL    int    `env:"IDEMPOTENCYTTL" default:"86400000"`                 // Time in milliseconds responses are replayed for an Idempotency-Key
+	IdempotencyMax    int    `env:"IDEMPOTENCYMAX" default:"10000"`                    // Maximum number of Idempotency-Key responses kept
+	AdminToken        string `env:"ADMINTOKEN" default:""`                             // Bearer token for the admin API, empty disables it
+	AdminUI           bool   `env:"ADMINUI" default:"false"`                           // Serve the admin UI at /admin, requires AdminToken
+	ExportMaxRows     int    `env:"EXPORTMAXROWS" default:"10000"`                     // Maximum rows of an admin export response, the rest continues by cursor
+	RedirectCache     string `env:"REDIRECTCACHE" default:""`                          // Cache-Control header sent on redirects, empty sends none
+	RedirectStatus    int    `env:"REDIRECTSTATUS" default:"301"`                      // Redirect status code: 301, 302, 307 or 308
+	Interstitial      int    `env:"INTERSTITIAL" default:"0"`                          // Seconds an interstitial page is shown before redirecting, 0 disables
+	NoIndex           bool   `env:"NOINDEX" default:"true"`                            // Disallow crawling in robots.txt and mark redirects noindex
+	Debug             bool   `env:"DEBUG" default:"false"`                             // Include debugging details in responses, refused in prod
+	DebugErrors       bool   `envconfig:"DEBUG_ERRORS" default:"false"`                // Include the internal message and underlying error in error responses, refused in prod
+	LogValidation     bool   `env:"LOGVALIDATION" default:"false"`                     // Log the details of rejected requests at debug level
+	LogValidationRate int    `env:"LOGVALIDATIONRATE" default:"10"`                    // Maximum validation failures logged per second
+	BaseURL           string `env:"BASEURL" default:""`                                // Public base URL of short links, links are relative if empty
+	BrandBaseURLs     string `env:"BRANDBASEURLS" default:""`                          // Comma-separated host=baseURL pairs of branded domains, overriding BaseURL
+	LocationHeaders   bool   `env:"LOCATIONHEADERS" default:"false"`                   // Set Location and Content-Location on 201 Created responses
+	EpochTimestamps   bool   `env:"EPOCHTIMESTAMPS" default:"false"`                   // Also return creation times in seconds since the Unix epoch
+	StaticRoutes      bool   `env:"STATICROUTES" default:"true"`                       // Serve the favicon and root page, false serves the API only
+	AccessLogSkip     string `env:"ACCESSLOGSKIP" default:"/healthz,/readyz,/metrics"` // Comma-separated path prefixes of requests not logged
+	LandingTemplate   string `env:"LANDINGTEMPLATE" default:""`                        // Path of an html/template file served at the root, empty serves the embedded page
+	CreateGet         string `env:"CREATEGET" default:"405"`                           // Response to GET on the create endpoint: 405, or usage for a JSON usage hint
+	APIVersioning     string `env:"APIVERSIONING" default:"path"`                      // API version selection: path, or header to also accept a versioned Accept media type on unversioned paths
+
+	AccessLogSkipList []string          `ignored:"true"` // Parsed AccessLogSkip
+	BrandBaseURLMap   map[string]string `ignored:"true"` // Parsed BrandBaseURLs, by lowercase host
 
 	Server *http.Server `json:"-"` // HTTP server instance
 }
@@ -69,17 +484,56 @@ func LoadServerConfig() (*ServerConfig, error) {
 		return nil, types.NewConfigError("Failed to load server configuration", err)
 	}
 
+	if cfg.APIVersioning != "path" && cfg.APIVersioning != "header" {
+		return nil, types.NewConfigError("APIVERSIONING must be path or header: "+cfg.APIVersioning, nil)
+	}
+
+	for _, prefix := range strings.Split(cfg.AccessLogSkip, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			cfg.AccessLogSkipList = append(cfg.AccessLogSkipList, prefix)
+		}
+	}
+
+	brands, err := parseBrandBaseURLs(cfg.BrandBaseURLs)
+	if err != nil {
+		return nil, err
+	}
+	cfg.BrandBaseURLMap = brands
+
 	// Initialize the HTTP server with the loaded configuration
 	cfg.Server = &http.Server{
-		Addr:         cfg.ListenAddr,
-		ReadTimeout:  time.Duration(cfg.ReadTimeout) * time.Millisecond,
-		WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Millisecond,
-		IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Millisecond,
+		Addr:              cfg.ListenAddr,
+		ReadTimeout:       time.Duration(cfg.ReadTimeout) * time.Millisecond,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(cfg.WriteTimeout) * time.Millisecond,
+		IdleTimeout:       time.Duration(cfg.IdleTimeout) * time.Millisecond,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
 	}
 
 	return cfg, nil
 }
 
+// parseBrandBaseURLs parses a comma-separated list of host=baseURL pairs into a map by lowercase host,
+// e.g. "go.brand-a.com=https://go.brand-a.com,links.brand-b.com=https://brand-b.link".
+// Trailing slashes of the base URLs are trimmed. An empty string returns an empty map.
+func parseBrandBaseURLs(list string) (map[string]string, error) {
+	brands := map[string]string{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, base, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		base = strings.TrimSuffix(strings.TrimSpace(base), "/")
+		if !ok || host == "" || base == "" {
+			return nil, types.NewConfigError("Invalid branded base URL, expected host=baseURL: "+entry, nil)
+		}
+		brands[host] = base
+	}
+	return brands, nil
+}
+
 // MustStart starts the HTTP server.
 // It panics if the server configuration is not initialized or if the server fails to start.
 func (cfg *ServerConfig) MustStart() {
@@ -103,4 +557,4 @@ func (cfg *ServerConfig) Shutdown(ctx context.Context) error {
 
 	// Shutdown the HTTP server gracefully
 	return cfg.Server.Shutdown(ctx)
-}
\ No newline at end of file
+}
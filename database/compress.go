@@ -0,0 +1,37 @@
+package database
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// compressValue compresses a long URL with flate for storage in the in-memory map.
+func compressValue(value string) (string, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", types.NewDBError("Map DB failed to create compressor", err)
+	}
+	if _, err := io.WriteString(w, value); err != nil {
+		return "", types.NewDBError("Map DB failed to compress value", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", types.NewDBError("Map DB failed to compress value", err)
+	}
+	return buf.String(), nil
+}
+
+// decompressValue decompresses a long URL stored by compressValue.
+func decompressValue(value string) (string, error) {
+	r := flate.NewReader(strings.NewReader(value))
+	defer r.Close()
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return "", types.NewDBError("Map DB failed to decompress value", err)
+	}
+	return string(decompressed), nil
+}
@@ -2,26 +2,45 @@ package database
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log/slog"
+	"net"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pizza-nz/url-shortener/config"
 	"github.com/pizza-nz/url-shortener/types"
 )
 
-var (
-	// dbReady indicates whether the database is connected and ready to accept queries.
-	dbReady bool = false
+const (
+	// ReservedPrefix starts the keys reserved for internal use, client chosen short URLs may not start with it.
+	ReservedPrefix = "__"
+	// healthCheckKey is the sentinel key used by CheckWrite.
+	// It lives in the reserved namespace so it can never collide with a generated or client chosen short URL.
+	healthCheckKey = ReservedPrefix + "healthcheck__"
+
+	// BackendPostgres is the backend type of the PostgreSQL database.
+	BackendPostgres = "postgres"
+	// BackendMemory is the backend type of the in-memory map.
+	BackendMemory = "memory"
 )
 
 // Database is an interface for URL storage.
-// It defines methods for getting and setting URL data.
+// It defines methods for getting and setting URL data, for releasing its resources,
+// and for reporting which storage backend it is.
 type Database interface {
 	Get(key string) (string, error)
 	Set(key, value string) error
+	Exists(key string) (bool, error)
+	Close() error
+	BackendType() string
 }
 
 // CounterDatabase is an interface for a counter.
@@ -30,28 +49,126 @@ type CounterDatabase interface {
 	GetAndIncreament() (uint64, error)
 }
 
+// BlockCounterDatabase is an interface for a counter that can allocate a block of values per round trip.
+// GetAndIncreamentBy allocates n counter values and returns them in ascending order.
+// The values are unique but not necessarily consecutive, as concurrent allocations may interleave.
+type BlockCounterDatabase interface {
+	GetAndIncreamentBy(n uint64) ([]uint64, error)
+}
+
+// HealthChecker is an interface for storage backends that can report their health.
+// Ping checks connectivity, CheckWrite performs a round-trip write/read of a sentinel key.
+type HealthChecker interface {
+	Ping() error
+	CheckWrite() error
+}
+
+// CreatorStore is an interface for storage backends that can record who created a short URL.
+// SetCreator records the creator of an existing key, GetCreator returns a NotFoundError if none was recorded.
+type CreatorStore interface {
+	SetCreator(key string, creator types.Creator) error
+	GetCreator(key string) (types.Creator, error)
+}
+
+// HitCounter is an interface for storage backends that count redirects per short URL.
+// GetHits returns the hits of the given keys in one call, keys that don't exist are omitted.
+type HitCounter interface {
+	IncrementHits(key string) error
+	GetHits(keys []string) (map[string]uint64, error)
+}
+
+// DedupIndex is an interface for storage backends that can find a short URL by a hash of its long URL.
+// Only the hash is indexed, so the index doesn't expose the plaintext long URLs.
+// FindByHash returns a NotFoundError if no short URL has the hash.
+type DedupIndex interface {
+	SetHash(key, hash string) error
+	FindByHash(hash string) (string, error)
+}
+
+// RecordStore is an interface for storage backends that can return the complete record of a short URL in one call.
+// GetRecord returns a NotFoundError if the key does not exist.
+type RecordStore interface {
+	GetRecord(key string) (*types.URLRecord, error)
+}
+
+// Readier is an interface for storage backends that need to connect before they can serve queries.
+// Backends that don't implement it are ready as soon as they are created.
+type Readier interface {
+	Ready() bool
+}
+
+// Lister is an interface for storage backends that can page through the stored URLs.
+// List returns the entries in the configured list order, ties ordered by short URL so pages are stable,
+// along with the total number of entries.
+// ListAfter returns up to limit entries with a short URL after the cursor, ordered by short URL, without counting,
+// so paging through large tables stays cheap and entries inserted meanwhile are neither skipped nor repeated.
+type Lister interface {
+	List(limit, offset int) ([]types.URLEntry, int, error)
+	ListAfter(after string, limit int) ([]types.URLEntry, error)
+}
+
 // DatabaseURLPGImpl is a PostgreSQL implementation of the Database interface.
 // It uses a pgxpool for connection pooling.
+// If cipher is set, long URLs are stored encrypted.
 type DatabaseURLPGImpl struct {
-	URLs *pgxpool.Pool
+	URLs      *pgxpool.Pool
+	cipher    *urlCipher
+	listOrder string      // ListOrderCode or ListOrderCreatedAt
+	ready     atomic.Bool // Set once the pool has pinged the database
 }
 
+const (
+	// ListOrderCode lists URLs ordered by short URL.
+	ListOrderCode = "code"
+	// ListOrderCreatedAt lists URLs ordered by creation time, which is recorded on every insert.
+	// Rows of Postgres databases created before it was recorded have none and are listed last.
+	ListOrderCreatedAt = "created_at"
+)
+
 // DatabaseURLMapImpl is a thread-safe in-memory implementation of the Database interface.
 // It uses a map for storing URLs with their corresponding short keys.
+// If compress is set, long URLs are stored flate-compressed, trading CPU for memory.
+// If cipher is set, long URLs are stored encrypted. List orders entries by listOrder, ListOrderCode or ListOrderCreatedAt.
 type DatabaseURLMapImpl struct {
-	lock sync.RWMutex
-	URLs map[string]string
+	lock      sync.RWMutex
+	URLs      map[string]string
+	creators  map[string]types.Creator
+	created   map[string]time.Time // Creation time of every key, overwritten by the recorded creator
+	hits      map[string]uint64
+	hashes    map[string]string
+	compress  bool
+	cipher    *urlCipher
+	listOrder string
+	now       func() time.Time
 }
 
-// StartNewDatabase initializes and returns a database instance based on the connection string.
-// It supports in-memory and PostgreSQL databases.
-func StartNewDatabase(conn string, redactedConn string) (Database, error) {
-	slog.Info("Starting new database connection", "connection_string", redactedConn)
+// StartNewDatabase initializes and returns a database instance based on the database configuration.
+// It supports in-memory and PostgreSQL databases. If persistence is required,
+// a missing connection string is a ConfigError rather than a silent fall back to the in-memory map.
+func StartNewDatabase(cfg *config.DBConfig) (Database, error) {
+	conn := cfg.ConnectionString()
+	slog.Info("Starting new database connection", "connection_string", cfg.RedactedConnectionString())
+
+	var cipher *urlCipher
+	if cfg.DBEncrypt {
+		var err error
+		if cipher, err = newURLCipher(cfg.DBEncryptionKeys, cfg.DBEncryptionKeyID); err != nil {
+			return nil, err
+		}
+		slog.Info("Encrypting long URLs at rest", "keyID", cfg.DBEncryptionKeyID)
+	}
+
 	switch {
+	case conn == "" && cfg.DBRequirePersistent:
+		return nil, types.NewConfigError("No database connection configured and the in-memory map is disabled", nil)
 	case conn == "":
-		slog.Info("Using in-memory map database")
-		return mapDB(), nil
-	case conn[:4] == "post":
+		slog.Info("Using in-memory map database", "compressed", cfg.DBCompressMap)
+		db := mapDB(cfg.DBCompressMap)
+		db.(*DatabaseURLMapImpl).cipher = cipher
+		db.(*DatabaseURLMapImpl).listOrder = cfg.DBListOrder
+		return db, nil
+	case strings.HasPrefix(conn, "postgres") || !strings.Contains(conn, "://"):
+		// A postgres:// or postgresql:// URL, or a key=value DSN
 		slog.Info("Using PostgreSQL database")
 		err := pingDB(conn)
 		if err != nil {
@@ -62,6 +179,8 @@ func StartNewDatabase(conn string, redactedConn string) (Database, error) {
 		if err != nil {
 			return nil, err
 		}
+		db.(*DatabaseURLPGImpl).cipher = cipher
+		db.(*DatabaseURLPGImpl).listOrder = cfg.DBListOrder
 		return db, nil
 	default:
 		return nil, types.NewDBError("Unsupported database type", nil)
@@ -69,7 +188,6 @@ func StartNewDatabase(conn string, redactedConn string) (Database, error) {
 }
 
 // pingDB checks the connection to the database.
-// It sets the dbReady flag to true if the connection is successful.
 func pingDB(conn string) error {
 	slog.Info("Pinging database")
 	ctx := context.Background()
@@ -84,22 +202,33 @@ func pingDB(conn string) error {
 		return types.NewDBError("pingDB failed to ping to DB", err)
 	}
 
-	dbReady = true
 	slog.Info("Database ping successful")
 
 	return nil
 }
 
-// IsDBReady returns the status of the database connection.
-func IsDBReady() bool {
-	return dbReady
+// Ready reports that the in-memory map is ready, it needs no connection.
+func (m *DatabaseURLMapImpl) Ready() bool {
+	return true
+}
+
+// Ready reports whether the PostgreSQL database has been pinged successfully.
+// A DatabaseURLPGImpl not created by StartNewDatabase is not ready.
+func (db *DatabaseURLPGImpl) Ready() bool {
+	return db.ready.Load()
 }
 
 // mapDB creates a new instance of DatabaseURLMapImpl.
 // It initializes the internal map to ensure it is ready for use.
-func mapDB() Database {
+func mapDB(compress bool) Database {
 	return &DatabaseURLMapImpl{
-		URLs: make(map[string]string),
+		URLs:     make(map[string]string),
+		creators: make(map[string]types.Creator),
+		created:  make(map[string]time.Time),
+		hits:     make(map[string]uint64),
+		hashes:   make(map[string]string),
+		compress: compress,
+		now:      time.Now,
 	}
 }
 
@@ -112,11 +241,43 @@ func (m *DatabaseURLMapImpl) Get(key string) (string, error) {
 	if !exists {
 		return "", types.NewNotFoundError(key)
 	}
+	return m.decode(key, value)
+}
+
+// encode prepares a long URL for storage in the in-memory map, compressing and encrypting it as configured.
+func (m *DatabaseURLMapImpl) encode(key, value string) (string, error) {
+	if m.compress {
+		compressed, err := compressValue(value)
+		if err != nil {
+			return "", err
+		}
+		value = compressed
+	}
+	return m.cipher.encrypt(key, value)
+}
+
+// decode reverses encode.
+func (m *DatabaseURLMapImpl) decode(key, stored string) (string, error) {
+	value, err := m.cipher.decrypt(key, stored)
+	if err != nil {
+		return "", err
+	}
+	if m.compress {
+		return decompressValue(value)
+	}
 	return value, nil
 }
 
+// Exists reports whether the given short key exists in the in-memory map.
+func (m *DatabaseURLMapImpl) Exists(key string) (bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, exists := m.URLs[key]
+	return exists, nil
+}
+
 // Set adds a new key-value pair to the in-memory map.
-// It returns a BadRequestError if the key or value is empty, or if the key already exists.
+// It returns a BadRequestError if the key or value is empty, or a ConflictError if the key already exists.
 func (m *DatabaseURLMapImpl) Set(key, value string) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -131,67 +292,504 @@ func (m *DatabaseURLMapImpl) Set(key, value string) error {
 		return types.NewBadRequestError(details)
 	}
 	if _, exists := m.URLs[key]; exists {
-		details = append(details, types.Details{Field: "key", Issue: fmt.Sprintf("key '%s' already exists", key)})
-		return types.NewBadRequestError(details)
+		return types.NewConflictError(key)
+	}
+
+	stored, err := m.encode(key, value)
+	if err != nil {
+		return err
+	}
+
+	m.URLs[key] = stored
+	m.created[key] = m.now()
+	slog.Info("URL added to map", "key", key, "longURL", value)
+
+	return nil
+}
+
+// SetCreator records the creator of the given short key in the in-memory map.
+func (m *DatabaseURLMapImpl) SetCreator(key string, creator types.Creator) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, exists := m.URLs[key]; !exists {
+		return types.NewNotFoundError(key)
+	}
+	m.creators[key] = creator
+	m.created[key] = creator.CreatedAt
+	return nil
+}
+
+// GetCreator returns the recorded creator of the given short key from the in-memory map.
+func (m *DatabaseURLMapImpl) GetCreator(key string) (types.Creator, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	creator, exists := m.creators[key]
+	if !exists {
+		return types.Creator{}, types.NewNotFoundError(key)
+	}
+	return creator, nil
+}
+
+// GetRecord returns the complete record of the given short key from the in-memory map.
+func (m *DatabaseURLMapImpl) GetRecord(key string) (*types.URLRecord, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	value, exists := m.URLs[key]
+	if !exists {
+		return nil, types.NewNotFoundError(key)
+	}
+	longURL, err := m.decode(key, value)
+	if err != nil {
+		return nil, err
 	}
 
-	m.URLs[key] = value
-	slog.Info("URL added to map", "key", key, "value", value)
+	record := &types.URLRecord{ShortURL: key, LongURL: longURL, Hits: m.hits[key]}
+	if created, ok := m.created[key]; ok {
+		record.CreatedAt = &created
+	}
+	return record, nil
+}
 
+// IncrementHits increments the hits of the given short key in the in-memory map.
+func (m *DatabaseURLMapImpl) IncrementHits(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, exists := m.URLs[key]; !exists {
+		return types.NewNotFoundError(key)
+	}
+	m.hits[key]++
 	return nil
 }
 
+// GetHits returns the hits of the given short keys from the in-memory map, omitting keys that don't exist.
+func (m *DatabaseURLMapImpl) GetHits(keys []string) (map[string]uint64, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	hits := make(map[string]uint64, len(keys))
+	for _, key := range keys {
+		if _, exists := m.URLs[key]; exists {
+			hits[key] = m.hits[key]
+		}
+	}
+	return hits, nil
+}
+
+// SetHash indexes the given short key by the hash of its long URL in the in-memory map.
+func (m *DatabaseURLMapImpl) SetHash(key, hash string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, exists := m.URLs[key]; !exists {
+		return types.NewNotFoundError(key)
+	}
+	m.hashes[hash] = key
+	return nil
+}
+
+// FindByHash returns the short key indexed by the given long URL hash in the in-memory map.
+func (m *DatabaseURLMapImpl) FindByHash(hash string) (string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	key, exists := m.hashes[hash]
+	if !exists {
+		return "", types.NewNotFoundError(hash)
+	}
+	return key, nil
+}
+
+// List returns a page of the entries in the in-memory map, in the list order, and the total number of entries.
+func (m *DatabaseURLMapImpl) List(limit, offset int) ([]types.URLEntry, int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	keys := make([]string, 0, len(m.URLs))
+	for key := range m.URLs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if m.listOrder == ListOrderCreatedAt {
+		// Stable, so keys created at the same time or without a creation time stay ordered by short URL
+		sort.SliceStable(keys, func(i, j int) bool {
+			return m.createdBefore(keys[i], keys[j])
+		})
+	}
+
+	total := len(keys)
+	offset = min(offset, total)
+	keys = keys[offset:min(offset+limit, total)]
+
+	entries := make([]types.URLEntry, 0, len(keys))
+	for _, key := range keys {
+		value, err := m.decode(key, m.URLs[key])
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, types.URLEntry{ShortURL: key, LongURL: value})
+	}
+	return entries, total, nil
+}
+
+// createdBefore reports whether key a was created before key b.
+func (m *DatabaseURLMapImpl) createdBefore(a, b string) bool {
+	return m.created[a].Before(m.created[b])
+}
+
+// ListAfter returns up to limit entries of the in-memory map with a short URL after the cursor, ordered by short URL.
+func (m *DatabaseURLMapImpl) ListAfter(after string, limit int) ([]types.URLEntry, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	keys := make([]string, 0, len(m.URLs))
+	for key := range m.URLs {
+		if key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	keys = keys[:min(limit, len(keys))]
+
+	entries := make([]types.URLEntry, 0, len(keys))
+	for _, key := range keys {
+		value, err := m.decode(key, m.URLs[key])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, types.URLEntry{ShortURL: key, LongURL: value})
+	}
+	return entries, nil
+}
+
+// Ping always succeeds for the in-memory map.
+func (m *DatabaseURLMapImpl) Ping() error {
+	return nil
+}
+
+// CheckWrite writes, reads back and removes a sentinel key in the in-memory map.
+func (m *DatabaseURLMapImpl) CheckWrite() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.URLs[healthCheckKey] = healthCheckKey
+	defer delete(m.URLs, healthCheckKey)
+	if m.URLs[healthCheckKey] != healthCheckKey {
+		return types.NewDBError("Map DB failed to read back health check key", nil)
+	}
+	return nil
+}
+
+// Close is a no-op for the in-memory map.
+func (m *DatabaseURLMapImpl) Close() error {
+	return nil
+}
+
+// BackendType returns BackendMemory.
+func (m *DatabaseURLMapImpl) BackendType() string {
+	return BackendMemory
+}
+
 // Get retrieves the long URL associated with the given short key from the PostgreSQL database.
 // It returns a NotFoundError if the key does not exist.
 func (db *DatabaseURLPGImpl) Get(key string) (string, error) {
 	var longURL string
 	err := db.URLs.QueryRow(context.Background(), "select long_url from table_urls where short_url=$1", key).Scan(&longURL)
-	switch err {
-	case nil:
-		return longURL, nil
-	case pgx.ErrNoRows:
-		return "", types.NewNotFoundError(key)
-	default:
-		return "", types.NewDBError("Internal Server Error", nil)
+	if err != nil {
+		return "", pgGetError(key, err)
 	}
+	return db.cipher.decrypt(key, longURL)
 }
 
-// Set adds a new key-value pair to the PostgreSQL database.
-// It uses a transaction to ensure atomicity.
+// Exists reports whether the given short key exists in the PostgreSQL database.
+// It is cheaper than Get as the long URL is not transferred.
+func (db *DatabaseURLPGImpl) Exists(key string) (bool, error) {
+	var exists bool
+	err := db.URLs.QueryRow(context.Background(), "select exists(select 1 from table_urls where short_url=$1)", key).Scan(&exists)
+	if err != nil {
+		return false, types.NewDBError("Postgres DB failed to check URL existence", err)
+	}
+	return exists, nil
+}
+
+// pgGetError maps an error from a PostgreSQL lookup of key to the application error types.
+// A missing row becomes a NotFoundError, anything else is wrapped in a DBError so the real cause is logged.
+func pgGetError(key string, err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.NewNotFoundError(key)
+	}
+	return types.NewDBError("Postgres DB failed to get URL", err)
+}
+
+// pgWriteError maps an error from a PostgreSQL write to the application error types, so clients can tell
+// a rejected value from an outage. Integrity constraint violations (class 23, e.g. unique or check violations)
+// and values too long for their column become a BadRequestError, connection failures and timeouts
+// a 503 AppError, and anything else is wrapped in a DBError.
+func pgWriteError(internalMessage string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "23"), pgErr.Code == "22001":
+			slog.Warn("Postgres DB rejected value", "code", pgErr.Code, "constraint", pgErr.ConstraintName, "error", pgErr.Message)
+			return types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Value is not accepted by the database")})
+		case strings.HasPrefix(pgErr.Code, "08"), pgErr.Code == "53300", pgErr.Code == "57P01":
+			return types.NewUnavailableError(internalMessage, err)
+		}
+		return types.NewDBError(internalMessage, err)
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connectErr) || errors.As(err, &netErr) || pgconn.Timeout(err) {
+		return types.NewUnavailableError(internalMessage, err)
+	}
+	return types.NewDBError(internalMessage, err)
+}
+
+// Set adds a new key-value pair to the PostgreSQL database, and returns a ConflictError if the key already exists.
+// The insert returns the key only if it inserted the row, so of concurrent inserts of the same key
+// exactly one succeeds and the others get a ConflictError, as with the map backend.
 func (db *DatabaseURLPGImpl) Set(key, value string) error {
-	tx, err := db.URLs.Begin(context.Background())
+	value, err := db.cipher.encrypt(key, value)
 	if err != nil {
-		return types.NewDBError("Postgres DB failed to begin a transcation", err)
+		return err
 	}
-	_, err = tx.Exec(context.Background(), `insert into table_urls(short_url, long_url) values ($1, $2) 
-	on conflict (short_url) do update set short_url=excluded.short_url`,
+
+	var inserted string
+	err = db.URLs.QueryRow(context.Background(), `insert into table_urls(short_url, long_url) values ($1, $2)
+	on conflict (short_url) do nothing
+	returning short_url`,
 		key,
-		value)
+		value).Scan(&inserted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.NewConflictError(key)
+	}
 	if err != nil {
-		tx.Rollback(context.Background())
-		return types.NewDBError("Postgres DB failed to set new row", err)
+		return pgWriteError("Postgres DB failed to set new row", err)
 	}
-
-	return tx.Commit(context.Background())
+	return nil
 }
 
-// GetAndIncreament retrieves the current counter value from the database and increments it.
-// It uses a transaction to ensure atomicity.
+// GetAndIncreament returns the next value of the counter sequence.
+// Sequences are atomic without locking, so instances sharing the database never get the same value.
 func (db *DatabaseURLPGImpl) GetAndIncreament() (uint64, error) {
+	var counter uint64
+	if err := db.URLs.QueryRow(context.Background(), `select nextval('url_counter')`).Scan(&counter); err != nil {
+		return 0, types.NewDBError("Counter DB failed to increment the counter", err)
+	}
+	return counter, nil
+}
+
+// GetAndIncreamentBy allocates the next n values of the counter sequence in a single round trip.
+// Each instance sharing the database claims its own values, which interleave with concurrent allocations.
+func (db *DatabaseURLPGImpl) GetAndIncreamentBy(n uint64) ([]uint64, error) {
+	rows, err := db.URLs.Query(context.Background(), `select nextval('url_counter') from generate_series(1, $1)`, n)
+	if err != nil {
+		return nil, types.NewDBError("Counter DB failed to increment the counter", err)
+	}
+	values, err := pgx.CollectRows(rows, pgx.RowTo[uint64])
+	if err != nil {
+		return nil, types.NewDBError("Counter DB failed to read the counter values", err)
+	}
+	slices.Sort(values)
+	return values, nil
+}
+
+// Close closes all connections in the PostgreSQL connection pool.
+func (db *DatabaseURLPGImpl) Close() error {
+	db.URLs.Close()
+	return nil
+}
+
+// SetCreator records the creator of the given short key in the PostgreSQL database.
+func (db *DatabaseURLPGImpl) SetCreator(key string, creator types.Creator) error {
+	tag, err := db.URLs.Exec(context.Background(), "update table_urls set creator_ip=$2, created_at=$3 where short_url=$1",
+		key,
+		creator.IP,
+		creator.CreatedAt)
+	if err != nil {
+		return types.NewDBError("Postgres DB failed to set creator", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return types.NewNotFoundError(key)
+	}
+	return nil
+}
+
+// GetCreator returns the recorded creator of the given short key from the PostgreSQL database.
+func (db *DatabaseURLPGImpl) GetCreator(key string) (types.Creator, error) {
+	var ip *string
+	var createdAt *time.Time
+	err := db.URLs.QueryRow(context.Background(), "select creator_ip, created_at from table_urls where short_url=$1", key).Scan(&ip, &createdAt)
+	if err != nil {
+		return types.Creator{}, pgGetError(key, err)
+	}
+	if ip == nil || createdAt == nil {
+		return types.Creator{}, types.NewNotFoundError(key)
+	}
+	return types.Creator{IP: *ip, CreatedAt: *createdAt}, nil
+}
+
+// GetRecord returns the complete record of the given short key from the PostgreSQL database.
+func (db *DatabaseURLPGImpl) GetRecord(key string) (*types.URLRecord, error) {
+	record := &types.URLRecord{ShortURL: key}
+	err := db.URLs.QueryRow(context.Background(), "select long_url, created_at, hits from table_urls where short_url=$1", key).Scan(&record.LongURL, &record.CreatedAt, &record.Hits)
+	if err != nil {
+		return nil, pgGetError(key, err)
+	}
+	if record.LongURL, err = db.cipher.decrypt(key, record.LongURL); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// IncrementHits increments the hits of the given short key in the PostgreSQL database.
+func (db *DatabaseURLPGImpl) IncrementHits(key string) error {
+	tag, err := db.URLs.Exec(context.Background(), "update table_urls set hits=hits+1 where short_url=$1", key)
+	if err != nil {
+		return types.NewDBError("Postgres DB failed to increment hits", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return types.NewNotFoundError(key)
+	}
+	return nil
+}
+
+// GetHits returns the hits of the given short keys from the PostgreSQL database in a single query,
+// omitting keys that don't exist.
+func (db *DatabaseURLPGImpl) GetHits(keys []string) (map[string]uint64, error) {
+	rows, err := db.URLs.Query(context.Background(), "select short_url, hits from table_urls where short_url = any($1)", keys)
+	if err != nil {
+		return nil, types.NewDBError("Postgres DB failed to get hits", err)
+	}
+	defer rows.Close()
+
+	hits := make(map[string]uint64, len(keys))
+	for rows.Next() {
+		var key string
+		var count int64
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, types.NewDBError("Postgres DB failed to scan hits", err)
+		}
+		hits[key] = uint64(count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, types.NewDBError("Postgres DB failed to read hits", err)
+	}
+	return hits, nil
+}
+
+// SetHash indexes the given short key by the hash of its long URL in the PostgreSQL database.
+func (db *DatabaseURLPGImpl) SetHash(key, hash string) error {
+	tag, err := db.URLs.Exec(context.Background(), "update table_urls set long_url_hash=$2 where short_url=$1", key, hash)
+	if err != nil {
+		return types.NewDBError("Postgres DB failed to set long URL hash", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return types.NewNotFoundError(key)
+	}
+	return nil
+}
+
+// FindByHash returns the short key indexed by the given long URL hash in the PostgreSQL database.
+func (db *DatabaseURLPGImpl) FindByHash(hash string) (string, error) {
+	var key string
+	err := db.URLs.QueryRow(context.Background(), "select short_url from table_urls where long_url_hash=$1 limit 1", hash).Scan(&key)
+	if err != nil {
+		return "", pgGetError(hash, err)
+	}
+	return key, nil
+}
+
+// BackendType returns BackendPostgres.
+func (db *DatabaseURLPGImpl) BackendType() string {
+	return BackendPostgres
+}
+
+// List returns a page of the rows in the PostgreSQL database, in the list order, and the total number of rows.
+// Ascending order puts rows inserted before created_at defaulted to the insert time, which have none, last.
+func (db *DatabaseURLPGImpl) List(limit, offset int) ([]types.URLEntry, int, error) {
+	var total int
+	if err := db.URLs.QueryRow(context.Background(), "select count(*) from table_urls").Scan(&total); err != nil {
+		return nil, 0, types.NewDBError("Postgres DB failed to count URLs", err)
+	}
+
+	orderBy := "short_url"
+	if db.listOrder == ListOrderCreatedAt {
+		orderBy = "created_at, short_url"
+	}
+	rows, err := db.URLs.Query(context.Background(), "select short_url, long_url from table_urls order by "+orderBy+" limit $1 offset $2", limit, offset)
+	if err != nil {
+		return nil, 0, types.NewDBError("Postgres DB failed to list URLs", err)
+	}
+	entries, err := db.scanEntries(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// ListAfter returns up to limit rows with a short URL after the cursor, ordered by short URL.
+// The primary key index serves the range scan, so late pages cost the same as the first.
+func (db *DatabaseURLPGImpl) ListAfter(after string, limit int) ([]types.URLEntry, error) {
+	rows, err := db.URLs.Query(context.Background(), "select short_url, long_url from table_urls where short_url > $1 order by short_url limit $2", after, limit)
+	if err != nil {
+		return nil, types.NewDBError("Postgres DB failed to list URLs", err)
+	}
+	return db.scanEntries(rows)
+}
+
+// scanEntries reads the short and long URLs of rows, decrypting the long URLs, and closes rows.
+func (db *DatabaseURLPGImpl) scanEntries(rows pgx.Rows) ([]types.URLEntry, error) {
+	defer rows.Close()
+
+	entries := []types.URLEntry{}
+	for rows.Next() {
+		var entry types.URLEntry
+		if err := rows.Scan(&entry.ShortURL, &entry.LongURL); err != nil {
+			return nil, types.NewDBError("Postgres DB failed to scan URL", err)
+		}
+		var err error
+		if entry.LongURL, err = db.cipher.decrypt(entry.ShortURL, entry.LongURL); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, types.NewDBError("Postgres DB failed to list URLs", err)
+	}
+	return entries, nil
+}
+
+// Ping checks the connection to the PostgreSQL database.
+func (db *DatabaseURLPGImpl) Ping() error {
+	if err := db.URLs.Ping(context.Background()); err != nil {
+		return types.NewDBError("Postgres DB failed to ping", err)
+	}
+	return nil
+}
+
+// CheckWrite confirms the PostgreSQL database accepts writes.
+// It inserts and reads back a sentinel row inside a transaction that is always rolled back,
+// so read-only replicas and permission issues are caught without leaving data behind.
+func (db *DatabaseURLPGImpl) CheckWrite() error {
 	tx, err := db.URLs.Begin(context.Background())
 	if err != nil {
-		return 0, types.NewDBError("Postgres DB failed to begin a transcation", err)
+		return types.NewDBError("Postgres DB failed to begin a transcation", err)
 	}
-	createdAt := time.Now()
-	_, err = tx.Exec(context.Background(), `insert into table_counter (created_at) values ($1)`, createdAt)
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), `insert into table_urls(short_url, long_url) values ($1, $2)
+	on conflict (short_url) do update set long_url=excluded.long_url`,
+		healthCheckKey,
+		healthCheckKey)
 	if err != nil {
-		tx.Rollback(context.Background())
-		return 0, types.NewDBError("Counter DB failed to set new row", err)
+		return types.NewDBError("Postgres DB failed to write health check row", err)
 	}
-	var counter uint64
-	_ = tx.QueryRow(context.Background(), `SELECT count(*) from table_counter`).Scan(&counter)
 
-	return counter, tx.Commit(context.Background())
+	var value string
+	if err := tx.QueryRow(context.Background(), "select long_url from table_urls where short_url=$1", healthCheckKey).Scan(&value); err != nil {
+		return types.NewDBError("Postgres DB failed to read health check row", err)
+	}
+	if value != healthCheckKey {
+		return types.NewDBError("Postgres DB read back an unexpected health check value", nil)
+	}
+	return nil
 }
 
 // postgresDB creates a new PostgreSQL database instance.
@@ -228,7 +826,9 @@ func postgresDB(conn string) (Database, error) {
 	}
 	slog.Info("PostgreSQL connection pool pinged successfully")
 
-	return &DatabaseURLPGImpl{
+	pg := &DatabaseURLPGImpl{
 		URLs: db,
-	}, nil
-}
\ No newline at end of file
+	}
+	pg.ready.Store(true)
+	return pg, nil
+}
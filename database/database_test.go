@@ -0,0 +1,378 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pizza-nz/url-shortener/config"
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// TestPGGetError tests that PostgreSQL lookup errors are mapped without losing the underlying error.
+func TestPGGetError(t *testing.T) {
+	// Test case 1: No rows, including when wrapped, is a NotFoundError
+	err := pgGetError("abc", fmt.Errorf("scan: %w", pgx.ErrNoRows))
+	var notFound *types.NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("pgGetError() = %T, want *types.NotFoundError", err)
+	}
+
+	// Test case 2: Any other error is a DBError preserving the underlying error
+	underlying := errors.New("connection reset by peer")
+	err = pgGetError("abc", underlying)
+	var appErr *types.AppError
+	if !errors.As(err, &appErr) {
+		t.Fatalf("pgGetError() = %T, want *types.AppError", err)
+	}
+	if !errors.Is(err, underlying) {
+		t.Errorf("pgGetError() dropped the underlying error, got %v", err)
+	}
+}
+
+// TestPGWriteError tests that PostgreSQL write errors are mapped to 400 for rejected values and 503 for outages.
+func TestPGWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "table_urls_long_url_key"}, http.StatusBadRequest},
+		{"check violation", fmt.Errorf("exec: %w", &pgconn.PgError{Code: "23514"}), http.StatusBadRequest},
+		{"value too long", &pgconn.PgError{Code: "22001"}, http.StatusBadRequest},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, http.StatusServiceUnavailable},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, http.StatusServiceUnavailable},
+		{"network error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, http.StatusServiceUnavailable},
+		{"timeout", context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{"other postgres error", &pgconn.PgError{Code: "42P01"}, http.StatusInternalServerError},
+		{"other error", errors.New("unexpected"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pgWriteError("Postgres DB failed to set new row", tt.err)
+
+			var badRequest *types.BadRequestError
+			if errors.As(err, &badRequest) {
+				if tt.wantStatus != http.StatusBadRequest {
+					t.Errorf("pgWriteError() = BadRequestError, want status %v", tt.wantStatus)
+				}
+				return
+			}
+			var appErr *types.AppError
+			if !errors.As(err, &appErr) {
+				t.Fatalf("pgWriteError() = %T, want *types.AppError", err)
+			}
+			if appErr.HTTPStatus != tt.wantStatus {
+				t.Errorf("pgWriteError() status = %v, want %v", appErr.HTTPStatus, tt.wantStatus)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("pgWriteError() dropped the underlying error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestMapDBCompressedRoundTrip tests that long URLs round-trip through the compressed map store.
+func TestMapDBCompressedRoundTrip(t *testing.T) {
+	longURL := "https://example.com/search?q=" + strings.Repeat("golang+best+practices+", 200)
+
+	db := mapDB(true)
+	if err := db.Set("abc", longURL); err != nil {
+		t.Fatalf("Set() error = %v, wantErr nil", err)
+	}
+
+	got, err := db.Get("abc")
+	if err != nil {
+		t.Fatalf("Get() error = %v, wantErr nil", err)
+	}
+	if got != longURL {
+		t.Errorf("Get() = %v, want %v", got, longURL)
+	}
+
+	stored := db.(*DatabaseURLMapImpl).URLs["abc"]
+	if len(stored) >= len(longURL) {
+		t.Errorf("stored value is %d bytes, want less than %d", len(stored), len(longURL))
+	}
+}
+
+// TestReady tests that the in-memory map is ready once created, while a PostgreSQL database is not until it has pinged.
+func TestReady(t *testing.T) {
+	db, err := StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readier, ok := db.(Readier)
+	if !ok || !readier.Ready() {
+		t.Error("in-memory map Ready() = false, want true")
+	}
+
+	if (&DatabaseURLPGImpl{}).Ready() {
+		t.Error("uninitialized PostgreSQL Ready() = true, want false")
+	}
+}
+
+// TestStartNewDatabaseRequirePersistent tests that the in-memory fallback can be disabled.
+func TestStartNewDatabaseRequirePersistent(t *testing.T) {
+	// Test case 1: Empty connection falls back to the map by default
+	db, err := StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatalf("StartNewDatabase() error = %v, wantErr nil", err)
+	}
+	if _, ok := db.(*DatabaseURLMapImpl); !ok {
+		t.Errorf("StartNewDatabase() = %T, want *DatabaseURLMapImpl", db)
+	}
+
+	// Test case 2: Empty connection is a ConfigError when persistence is required
+	_, err = StartNewDatabase(&config.DBConfig{DBRequirePersistent: true})
+	var appErr *types.AppError
+	if !errors.As(err, &appErr) || appErr.Message != "Application configuration error" {
+		t.Errorf("StartNewDatabase() error = %v, want a ConfigError", err)
+	}
+}
+
+// TestMapDBSetConflict tests that setting an existing key returns a ConflictError.
+func TestMapDBSetConflict(t *testing.T) {
+	db := mapDB(false)
+	if err := db.Set("abc", "http://example.com"); err != nil {
+		t.Fatalf("Set() error = %v, wantErr nil", err)
+	}
+
+	err := db.Set("abc", "http://example.org")
+	var conflict *types.ConflictError
+	if !errors.As(err, &conflict) || conflict.Key != "abc" {
+		t.Errorf("Set() error = %v, want a ConflictError for abc", err)
+	}
+}
+
+// TestMapDBHits tests that the map backend counts hits and omits missing keys.
+func TestMapDBHits(t *testing.T) {
+	db := mapDB(false).(*DatabaseURLMapImpl)
+	if err := db.Set("abc", "https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("def", "https://example.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := db.IncrementHits("abc"); err != nil {
+			t.Fatalf("IncrementHits() error = %v, wantErr nil", err)
+		}
+	}
+	if err := db.IncrementHits("missing"); err == nil {
+		t.Error("Expected an error for a missing key, but got nil")
+	}
+
+	hits, err := db.GetHits([]string{"abc", "def", "missing"})
+	if err != nil {
+		t.Fatalf("GetHits() error = %v, wantErr nil", err)
+	}
+	if len(hits) != 2 || hits["abc"] != 3 || hits["def"] != 0 {
+		t.Errorf("GetHits() = %v, want map[abc:3 def:0]", hits)
+	}
+}
+
+// TestReadSeedFile tests reading the entries of JSON and CSV seed files, skipping the CSV header row.
+func TestReadSeedFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"json", "seed.json", `[{"shortURL": "docs", "longURL": "https://example.com/docs"}, {"shortURL": "blog", "longURL": "https://example.com/blog"}]`},
+		{"csv", "seed.csv", "shortURL,longURL\ndocs,https://example.com/docs\nblog,https://example.com/blog\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := ReadSeedFile(path)
+			if err != nil {
+				t.Fatalf("ReadSeedFile() error = %v, wantErr nil", err)
+			}
+			want := []SeedEntry{{"docs", "https://example.com/docs"}, {"blog", "https://example.com/blog"}}
+			if len(entries) != len(want) || entries[0] != want[0] || entries[1] != want[1] {
+				t.Errorf("ReadSeedFile() = %v, want %v", entries, want)
+			}
+		})
+	}
+
+	if _, err := ReadSeedFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing seed file, but got nil")
+	}
+}
+
+// TestMapDBEncryptedRoundTrip tests that long URLs round-trip through the encrypted store, including across a key rotation.
+func TestMapDBEncryptedRoundTrip(t *testing.T) {
+	longURL := "https://example.com/private/report?id=42"
+	oldKey := []byte("0123456789abcdef0123456789abcdef")
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+
+	cipher, err := newURLCipher(map[string][]byte{"k1": oldKey}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := mapDB(true).(*DatabaseURLMapImpl)
+	db.cipher = cipher
+	if err := db.Set("abc", longURL); err != nil {
+		t.Fatalf("Set() error = %v, wantErr nil", err)
+	}
+
+	stored := db.URLs["abc"]
+	if !strings.HasPrefix(stored, "enc:k1:") {
+		t.Errorf("stored value = %v, want prefix enc:k1:", stored)
+	}
+	if strings.Contains(stored, "example.com") {
+		t.Errorf("stored value %v contains the plaintext long URL", stored)
+	}
+
+	// Rotate to a new key, values written with the old key still decrypt
+	db.cipher, err = newURLCipher(map[string][]byte{"k1": oldKey, "k2": newKey}, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("def", longURL); err != nil {
+		t.Fatalf("Set() error = %v, wantErr nil", err)
+	}
+	if !strings.HasPrefix(db.URLs["def"], "enc:k2:") {
+		t.Errorf("stored value = %v, want prefix enc:k2:", db.URLs["def"])
+	}
+	for _, key := range []string{"abc", "def"} {
+		if got, err := db.Get(key); err != nil || got != longURL {
+			t.Errorf("Get(%v) = %v, %v, want %v", key, got, err, longURL)
+		}
+	}
+
+	// A value moved to another key fails authentication
+	db.URLs["ghi"] = db.URLs["abc"]
+	if _, err := db.Get("ghi"); err == nil {
+		t.Error("Get() of a moved value error = nil, want an error")
+	}
+
+	// Dropping the old key makes its values undecryptable, plaintext values pass through
+	db.cipher, _ = newURLCipher(map[string][]byte{"k2": newKey}, "k2")
+	if _, err := db.Get("abc"); err == nil {
+		t.Error("Get() with an unknown key id error = nil, want an error")
+	}
+	db.compress = false
+	db.URLs["plain"] = longURL
+	if got, err := db.Get("plain"); err != nil || got != longURL {
+		t.Errorf("Get() of a plaintext value = %v, %v, want %v", got, err, longURL)
+	}
+}
+
+// TestStartNewDatabaseEncryption tests that an unconfigured active key id is rejected.
+func TestStartNewDatabaseEncryption(t *testing.T) {
+	_, err := StartNewDatabase(&config.DBConfig{
+		DBEncrypt:         true,
+		DBEncryptionKeys:  map[string][]byte{"k1": []byte("0123456789abcdef")},
+		DBEncryptionKeyID: "k2",
+	})
+	if err == nil {
+		t.Error("StartNewDatabase() error = nil, want a ConfigError")
+	}
+}
+
+// TestMapDBGetRecord tests that the record of a short key consolidates the long URL, creation time and hits,
+// with the creation time of the insert until a creator is recorded.
+func TestMapDBGetRecord(t *testing.T) {
+	db := mapDB(false).(*DatabaseURLMapImpl)
+	inserted := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	db.now = func() time.Time { return inserted }
+	if err := db.Set("abc", "http://example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := db.GetRecord("abc")
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v, wantErr nil", err)
+	}
+	if record.LongURL != "http://example.com" || record.Hits != 0 || record.CreatedAt == nil || !record.CreatedAt.Equal(inserted) {
+		t.Errorf("GetRecord() = %+v, want the long URL without hits created at the insert %v", record, inserted)
+	}
+
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := db.SetCreator("abc", types.Creator{IP: "203.0.113.7", CreatedAt: createdAt}); err != nil {
+		t.Fatal(err)
+	}
+	db.IncrementHits("abc")
+	db.IncrementHits("abc")
+
+	record, err = db.GetRecord("abc")
+	if err != nil {
+		t.Fatalf("GetRecord() error = %v, wantErr nil", err)
+	}
+	if record.ShortURL != "abc" || record.Hits != 2 || record.CreatedAt == nil || !record.CreatedAt.Equal(createdAt) {
+		t.Errorf("GetRecord() = %+v, want abc with 2 hits created at %v", record, createdAt)
+	}
+
+	var notFound *types.NotFoundError
+	if _, err := db.GetRecord("missing"); !errors.As(err, &notFound) {
+		t.Errorf("GetRecord() error = %v, want *types.NotFoundError", err)
+	}
+}
+
+// TestMapDBListOrder tests that the map lists entries in the same configured order on every call,
+// despite the random iteration order of Go maps.
+func TestMapDBListOrder(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		listOrder string
+		expected  []string
+	}{
+		{"code", ListOrderCode, []string{"a", "b", "c", "d", "e"}},
+		{"created at", ListOrderCreatedAt, []string{"d", "b", "e", "c", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := mapDB(false).(*DatabaseURLMapImpl)
+			db.listOrder = tt.listOrder
+			// Every key gets a creation time, also without a recorded creator
+			now := created.Add(time.Hour)
+			db.now = func() time.Time { return now }
+			for _, key := range []string{"c", "e", "a", "d", "b"} {
+				if err := db.Set(key, "http://example.com/"+key); err != nil {
+					t.Fatal(err)
+				}
+				now = now.Add(time.Minute)
+			}
+			// A recorded creator overwrites the creation time, b and e are created at the same time
+			for key, offset := range map[string]time.Duration{"d": 0, "b": time.Minute, "e": time.Minute} {
+				if err := db.SetCreator(key, types.Creator{CreatedAt: created.Add(offset)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for call := 0; call < 20; call++ {
+				entries, total, err := db.List(len(tt.expected), 0)
+				if err != nil {
+					t.Fatalf("List() error = %v, wantErr nil", err)
+				}
+				keys := make([]string, 0, len(entries))
+				for _, entry := range entries {
+					keys = append(keys, entry.ShortURL)
+				}
+				if total != len(tt.expected) || strings.Join(keys, ",") != strings.Join(tt.expected, ",") {
+					t.Fatalf("List() call %d = %v, %d, want %v", call, keys, total, tt.expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// encryptedPrefix marks a stored long URL as encrypted, followed by the key id and a colon.
+// Values without it are plaintext, written before encryption was enabled, and are returned as is.
+const encryptedPrefix = "enc:"
+
+// urlCipher encrypts long URLs at rest with AES-GCM.
+// New values are encrypted with the active key, and the key id is stored with each value
+// so rows written before a key rotation still decrypt as long as their key is configured.
+// A nil urlCipher leaves values unencrypted.
+type urlCipher struct {
+	aeads    map[string]cipher.AEAD
+	activeID string
+}
+
+// newURLCipher creates a urlCipher from AES keys by key id, encrypting with the key activeID.
+func newURLCipher(keys map[string][]byte, activeID string) (*urlCipher, error) {
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, types.NewConfigError(fmt.Sprintf("Invalid encryption key %q", id), err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, types.NewConfigError(fmt.Sprintf("Invalid encryption key %q", id), err)
+		}
+		aeads[id] = aead
+	}
+	if _, ok := aeads[activeID]; !ok {
+		return nil, types.NewConfigError(fmt.Sprintf("Encryption key id %q is not configured", activeID), nil)
+	}
+	return &urlCipher{aeads: aeads, activeID: activeID}, nil
+}
+
+// encrypt encrypts value with the active key, as "enc:<key id>:<base64 nonce and ciphertext>".
+// The key is bound as additional data, so a value can't be moved to another short URL.
+func (c *urlCipher) encrypt(key, value string) (string, error) {
+	if c == nil {
+		return value, nil
+	}
+	aead := c.aeads[c.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", types.NewDBError("Failed to generate encryption nonce", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(key))
+	return encryptedPrefix + c.activeID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt decrypts a value stored by encrypt for key, plaintext values are returned as is.
+func (c *urlCipher) decrypt(key, stored string) (string, error) {
+	if c == nil {
+		return stored, nil
+	}
+	rest, ok := strings.CutPrefix(stored, encryptedPrefix)
+	if !ok {
+		return stored, nil
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", types.NewDBError("Stored long URL has a malformed encryption prefix", nil)
+	}
+	aead, ok := c.aeads[id]
+	if !ok {
+		return "", types.NewDBError(fmt.Sprintf("Stored long URL is encrypted with unknown key %q", id), nil)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", types.NewDBError("Stored long URL has malformed ciphertext", err)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return "", types.NewDBError("Failed to decrypt stored long URL", err)
+	}
+	return string(value), nil
+}
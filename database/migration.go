@@ -36,9 +36,39 @@ func Migration(conn string) error {
 			UpSQL:    `CREATE TABLE table_counter (id SERIAL primary key, created_at TIMESTAMPTZ); INSERT INTO table_counter (created_at) VALUES (NOW())`,
 			DownSQL:  `DROP TABLE table_counter`,
 		},
+		{
+			Sequence: 3,
+			Name:     "3",
+			UpSQL:    `ALTER TABLE table_urls ADD COLUMN creator_ip text, ADD COLUMN created_at TIMESTAMPTZ`,
+			DownSQL:  `ALTER TABLE table_urls DROP COLUMN creator_ip, DROP COLUMN created_at`,
+		},
+		{
+			Sequence: 4,
+			Name:     "4",
+			UpSQL:    `ALTER TABLE table_urls ADD COLUMN hits bigint not null default 0`,
+			DownSQL:  `ALTER TABLE table_urls DROP COLUMN hits`,
+		},
+		{
+			Sequence: 5,
+			Name:     "5",
+			UpSQL:    `ALTER TABLE table_urls ADD COLUMN long_url_hash text; CREATE INDEX table_urls_long_url_hash ON table_urls (long_url_hash)`,
+			DownSQL:  `DROP INDEX table_urls_long_url_hash; ALTER TABLE table_urls DROP COLUMN long_url_hash`,
+		},
+		{
+			Sequence: 6,
+			Name:     "6",
+			UpSQL:    `CREATE SEQUENCE url_counter; SELECT setval('url_counter', (SELECT count(*) FROM table_counter)); DROP TABLE table_counter`,
+			DownSQL:  `CREATE TABLE table_counter (id SERIAL primary key, created_at TIMESTAMPTZ); INSERT INTO table_counter (created_at) SELECT NOW() FROM generate_series(1, (SELECT last_value FROM url_counter)); DROP SEQUENCE url_counter`,
+		},
+		{
+			Sequence: 7,
+			Name:     "7",
+			UpSQL:    `ALTER TABLE table_urls ALTER COLUMN created_at SET DEFAULT now()`,
+			DownSQL:  `ALTER TABLE table_urls ALTER COLUMN created_at DROP DEFAULT`,
+		},
 	}
 
-	m.MigrateTo(context.Background(), 2)
+	m.MigrateTo(context.Background(), 7)
 
 	return m.Migrate(ctx)
-}
\ No newline at end of file
+}
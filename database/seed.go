@@ -0,0 +1,62 @@
+package database
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// SeedEntry is a short URL loaded from a seed file.
+type SeedEntry struct {
+	ShortURL string `json:"shortURL"`
+	LongURL  string `json:"longURL"`
+}
+
+// ReadSeedFile reads the short URLs of a seed file, so operators can ship default links with the app.
+// The file is a JSON array of {"shortURL", "longURL"} objects, or a CSV of shortURL,longURL rows if it ends in .csv.
+// The entries are not validated, they are loaded through the URL service like any other creation.
+func ReadSeedFile(path string) ([]SeedEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, types.NewConfigError("Failed to open seed file", err)
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readSeedCSV(file)
+	}
+
+	var entries []SeedEntry
+	if err := json.NewDecoder(file).Decode(&entries); err != nil {
+		return nil, types.NewConfigError("Failed to decode seed file", err)
+	}
+	return entries, nil
+}
+
+// readSeedCSV reads shortURL,longURL rows, skipping a header row if present.
+func readSeedCSV(r io.Reader) ([]SeedEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	entries := []SeedEntry{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, types.NewConfigError("Failed to read seed file", err)
+		}
+		if len(entries) == 0 && strings.EqualFold(record[0], "shortURL") {
+			continue
+		}
+		entries = append(entries, SeedEntry{ShortURL: record[0], LongURL: record[1]})
+	}
+	return entries, nil
+}
@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/service"
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
+)
+
+const (
+	// defaultListLimit is the page size of ListURLs when no limit is given.
+	defaultListLimit = 20
+	// defaultExportMaxRows is the maximum number of rows of an export response when no limit is set.
+	defaultExportMaxRows = 10000
+
+	// ExportFormatJSONL exports one JSON object per line.
+	ExportFormatJSONL = "jsonl"
+	// ExportFormatCSV exports comma-separated values with a header row.
+	ExportFormatCSV = "csv"
+)
+
+// eventHeartbeat is the interval of the comments keeping idle event streams open through proxies.
+var eventHeartbeat = 15 * time.Second
+
+// AdminHandler serves the admin API, used by operators for abuse investigation.
+// Every request must carry the configured token as "Authorization: Bearer <token>".
+// The service is set once the database has connected, until then requests respond with 503.
+type AdminHandler struct {
+	mu            sync.RWMutex
+	service       service.URLService
+	token         string
+	exportMaxRows int
+}
+
+// NewAdminHandler creates a new instance of AdminHandler authenticating requests with token.
+func NewAdminHandler(service service.URLService, token string) *AdminHandler {
+	return &AdminHandler{
+		service:       service,
+		token:         token,
+		exportMaxRows: defaultExportMaxRows,
+	}
+}
+
+// SetExportMaxRows sets the maximum number of rows of an export response, beyond which the export continues by cursor.
+// Values below 1 are ignored.
+func (h *AdminHandler) SetExportMaxRows(rows int) {
+	if rows < 1 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.exportMaxRows = rows
+}
+
+// SetServiceURL sets the URL service for the handler.
+func (h *AdminHandler) SetServiceURL(service service.URLService) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.service = service
+}
+
+// authorized reports whether the request carries the admin token, as a bearer token
+// or as the password of basic auth, which browsers use for the admin UI.
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, token, ok = r.BasicAuth()
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// adminPage is the admin UI, listing and creating short URLs through the JSON API.
+//
+//go:embed admin.html
+var adminPage []byte
+
+// AdminUI serves the embedded admin UI. Unauthorized requests are challenged for basic auth,
+// with any username and the admin token as the password.
+func (h *AdminHandler) AdminUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.HandleMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+		utils.HandleError(w, types.NewUnauthorizedError("Missing or invalid admin token", nil))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(http.StatusOK)
+	w.Write(adminPage)
+}
+
+// authorizedService checks the method and admin token of the request and returns the service.
+// It writes the error response and returns false if the request can't be served.
+func (h *AdminHandler) authorizedService(w http.ResponseWriter, r *http.Request) (service.URLService, bool) {
+	if r.Method != http.MethodGet {
+		utils.HandleMethodNotAllowed(w, http.MethodGet)
+		return nil, false
+	}
+	if !h.authorized(r) {
+		utils.HandleError(w, types.NewUnauthorizedError("Missing or invalid admin token", nil))
+		return nil, false
+	}
+
+	h.mu.RLock()
+	svc := h.service
+	h.mu.RUnlock()
+	if svc == nil {
+		utils.HandleError(w, types.NewUnavailableError("DB is not set up", nil))
+		return nil, false
+	}
+	return svc, true
+}
+
+// GetCreator handles the retrieval of the recorded creator of a shortened URL.
+func (h *AdminHandler) GetCreator(w http.ResponseWriter, r *http.Request) {
+	svc, ok := h.authorizedService(w, r)
+	if !ok {
+		return
+	}
+
+	shortURL := strings.TrimPrefix(r.URL.Path, "/admin/"+types.APIVersion+"/creators/")
+	creator, err := svc.GetCreator(shortURL)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, types.CreatorResponse{
+		ShortURL:      shortURL,
+		IP:            creator.IP,
+		CreatedAt:     creator.CreatedAt,
+		CreatedAtUnix: unixTimestamp(&creator.CreatedAt),
+	})
+}
+
+// ListURLs handles paging through the stored shortened URLs with the limit and offset query parameters.
+// The page is returned in a ListResponse envelope, with a Link header pointing to the next and previous pages.
+// With the after query parameter, even empty, it pages by cursor instead, see listURLsAfter.
+func (h *AdminHandler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	svc, ok := h.authorizedService(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePage(r.URL.Query())
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+	if r.URL.Query().Has("after") {
+		listURLsAfter(w, r, svc, limit)
+		return
+	}
+
+	entries, total, err := svc.ListURLs(limit, offset)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	response := types.ListResponse{
+		Data:   entries,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}
+	links := []string{}
+	if next := offset + limit; next < total {
+		response.NextOffset = &next
+		links = append(links, pageLink(r.URL.Path, limit, next, "next"))
+	}
+	if offset > 0 {
+		links = append(links, pageLink(r.URL.Path, limit, max(offset-limit, 0), "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	utils.JSONResponse(w, http.StatusOK, response)
+}
+
+// Events streams the creation activity as server-sent events, one event per change named by its type
+// with the JSON encoded types.Event as data, until the client disconnects.
+// Events are not replayed, and a client too slow to keep up misses events rather than slowing down creation.
+// The response is flushed through http.ResponseController, so middleware wrapping the writer must implement Unwrap.
+func (h *AdminHandler) Events(w http.ResponseWriter, r *http.Request) {
+	svc, ok := h.authorizedService(w, r)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := rc.Flush(); errors.Is(err, http.ErrNotSupported) {
+		utils.HandleError(w, types.NewInternalError("Event streaming is not supported", err))
+		return
+	}
+
+	events, unsubscribe := svc.SubscribeEvents()
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			data, err := utils.Marshal(event)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to encode event", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// listURLsAfter responds with the page of stored shortened URLs after the cursor in the after query parameter,
+// in a CursorListResponse envelope with a Link header pointing to the next page.
+// Exports of large tables should page by cursor: it doesn't count the rows, and doesn't skip or repeat URLs created meanwhile.
+func listURLsAfter(w http.ResponseWriter, r *http.Request, svc service.URLService, limit int) {
+	after := r.URL.Query().Get("after")
+	entries, next, err := svc.ListURLsAfter(after, limit)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	response := types.CursorListResponse{
+		Data:  entries,
+		Limit: limit,
+		After: after,
+	}
+	if next != "" {
+		response.NextCursor = &next
+		w.Header().Set("Link", fmt.Sprintf(`<%s?limit=%d&after=%s>; rel="next"`, r.URL.Path, limit, url.QueryEscape(next)))
+	}
+
+	utils.JSONResponse(w, http.StatusOK, response)
+}
+
+// Export handles exporting the stored shortened URLs after the cursor in the after query parameter,
+// as JSON lines or, with format=csv, as CSV with a shortURL,longURL header row.
+// At most the configured maximum number of rows is returned. If more remain, the X-Next-Cursor header carries
+// the after of the next request and a Link header points to it, so even enormous tables are exported in bounded responses.
+// The rows are collected before responding, so a failing page is reported as an error rather than a truncated export.
+func (h *AdminHandler) Export(w http.ResponseWriter, r *http.Request) {
+	svc, ok := h.authorizedService(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.HandleMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = ExportFormatJSONL
+	}
+	if format != ExportFormatJSONL && format != ExportFormatCSV {
+		badRequest := types.NewBadRequestError([]types.Details{
+			types.NewDetails("format", "must be "+ExportFormatJSONL+" or "+ExportFormatCSV),
+		})
+		utils.HandleError(w, types.NewValidationError(badRequest.Error(), badRequest))
+		return
+	}
+
+	h.mu.RLock()
+	maxRows := h.exportMaxRows
+	h.mu.RUnlock()
+
+	after := query.Get("after")
+	var entries []types.URLEntry
+	cursor := after
+	for len(entries) < maxRows {
+		page, next, err := svc.ListURLsAfter(cursor, min(maxRows-len(entries), service.MaxListLimit))
+		if err != nil {
+			utils.HandleError(w, err)
+			return
+		}
+		entries = append(entries, page...)
+		cursor = next
+		if next == "" {
+			break
+		}
+	}
+
+	if cursor != "" {
+		w.Header().Set("X-Next-Cursor", cursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?format=%s&after=%s>; rel="next"`, r.URL.Path, format, url.QueryEscape(cursor)))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if format == ExportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="urls.csv"`)
+		w.WriteHeader(http.StatusOK)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"shortURL", "longURL"})
+		for _, entry := range entries {
+			cw.Write([]string{entry.ShortURL, entry.LongURL})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			slog.WarnContext(r.Context(), "Failed to write export", "error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="urls.jsonl"`)
+	w.WriteHeader(http.StatusOK)
+	for _, entry := range entries {
+		line, err := utils.Marshal(entry)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to encode export entry", "shortURL", entry.ShortURL, "error", err)
+			continue
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			slog.WarnContext(r.Context(), "Failed to write export", "error", err)
+			return
+		}
+	}
+}
+
+// fetchSuffix is the path suffix of the fetch proxy of a shortened URL.
+const fetchSuffix = "/fetch"
+
+// FetchURL handles fetching the long URL of a shortened URL server-side and streaming the response back,
+// for clients that can't reach the internet directly. It requires the admin token and FETCHPROXY.
+// The response is sandboxed, so proxied HTML can't run scripts or read cookies on this origin.
+// A body exceeding the maximum size once streaming has started aborts the connection, so it isn't taken as complete.
+func (h *AdminHandler) FetchURL(w http.ResponseWriter, r *http.Request) {
+	svc, ok := h.authorizedService(w, r)
+	if !ok {
+		return
+	}
+
+	shortURL := strings.TrimPrefix(r.URL.Path, "/"+types.APIVersion+"/shorten/")
+	shortURL = strings.TrimSuffix(shortURL, fetchSuffix)
+	resp, err := svc.FetchLongURL(r.Context(), shortURL)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		slog.WarnContext(r.Context(), "Aborted fetch proxy response", "shortURL", shortURL, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// LookupURL handles looking up the existing short URLs of the long URL in the url query parameter,
+// so clients can check before creating one. It requires the admin token, since it reveals URLs shortened by others.
+func (h *AdminHandler) LookupURL(w http.ResponseWriter, r *http.Request) {
+	svc, ok := h.authorizedService(w, r)
+	if !ok {
+		return
+	}
+
+	longURL := r.URL.Query().Get("url")
+	if longURL == "" {
+		badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("url", "is required")})
+		utils.HandleError(w, types.NewValidationError(badRequest.Error(), badRequest))
+		return
+	}
+
+	shortURLs, err := svc.LookupLongURL(longURL)
+	if err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, types.LookupResponse{LongURL: longURL, ShortURLs: shortURLs})
+}
+
+// parsePage parses the limit and offset query parameters, defaulting to defaultListLimit and 0.
+func parsePage(query url.Values) (int, int, error) {
+	limit, offset := defaultListLimit, 0
+	details := []types.Details{}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			details = append(details, types.NewDetails("limit", "must be an integer"))
+		}
+		limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			details = append(details, types.NewDetails("offset", "must be an integer"))
+		}
+		offset = n
+	}
+	if len(details) > 0 {
+		badRequest := types.NewBadRequestError(details)
+		return 0, 0, types.NewValidationError(badRequest.Error(), badRequest)
+	}
+	return limit, offset, nil
+}
+
+// pageLink formats a Link header entry for the page at offset.
+func pageLink(path string, limit, offset int, rel string) string {
+	return fmt.Sprintf(`<%s?limit=%d&offset=%d>; rel="%s"`, path, limit, offset, rel)
+}
+
+// AdminEventsPath is the path of the admin event stream. Its response is flushed per event, so it must be exempt
+// from middleware buffering the response.
+var AdminEventsPath = "/admin/" + types.APIVersion + "/events"
+
+// RegisterAdminRoutes registers the admin API, authenticated with token, and the admin UI at /admin if ui is true.
+// The fetch proxy is registered on the public API path /v1/shorten/{shortURL}/fetch, but authenticated like the admin API.
+// The returned handler is used to set the service once the database has connected.
+func RegisterAdminRoutes(mux *http.ServeMux, token string, ui bool) *AdminHandler {
+	adminHandler := NewAdminHandler(nil, token)
+
+	if ui {
+		mux.HandleFunc("/admin", adminHandler.AdminUI)
+	}
+
+	mux.HandleFunc("/admin/"+types.APIVersion+"/creators/", adminHandler.GetCreator)
+	mux.HandleFunc("/admin/"+types.APIVersion+"/urls", adminHandler.ListURLs)
+	mux.HandleFunc(AdminEventsPath, adminHandler.Events)
+	mux.HandleFunc("/admin/"+types.APIVersion+"/export", adminHandler.Export)
+	mux.HandleFunc("/"+types.APIVersion+"/shorten/{shortURL}"+fetchSuffix, adminHandler.FetchURL)
+	mux.HandleFunc("/admin/"+types.APIVersion+"/lookup", adminHandler.LookupURL)
+
+	return adminHandler
+}
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pizza-nz/url-shortener/middleware"
 	"github.com/pizza-nz/url-shortener/service"
@@ -11,6 +16,175 @@ import (
 	"github.com/pizza-nz/url-shortener/utils"
 )
 
+// redirectCacheControl is the Cache-Control header sent on redirects, empty sends none.
+var redirectCacheControl = ""
+
+// SetRedirectCacheControl sets the Cache-Control header sent on redirects.
+// It is separate from API responses, which are never cached.
+func SetRedirectCacheControl(value string) {
+	redirectCacheControl = value
+}
+
+// redirectStatus is the status code used for redirects.
+var redirectStatus = http.StatusMovedPermanently
+
+// SetRedirectStatus sets the status code used for redirects: 301, 302, 307 or 308.
+// 307 and 308 preserve the method and body, so a POST to an API-style short link stays a POST.
+func SetRedirectStatus(status int) error {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		redirectStatus = status
+		return nil
+	default:
+		return types.NewConfigError(fmt.Sprintf("Redirect status must be 301, 302, 307 or 308, got %d", status), nil)
+	}
+}
+
+// baseURL is the public base URL of short links, e.g. https://sho.rt. If empty, links are relative to the host.
+var baseURL = ""
+
+// SetBaseURL sets the public base URL used for fully-qualified short links.
+func SetBaseURL(url string) {
+	baseURL = strings.TrimSuffix(url, "/")
+}
+
+// brandBaseURLs maps the hostnames of branded domains to their public base URL, overriding baseURL.
+var brandBaseURLs = map[string]string{}
+
+// SetBrandBaseURLs sets the base URLs of branded domains by lowercase hostname, as parsed from BRANDBASEURLS.
+// Requests to any other host use the base URL set with SetBaseURL. A nil map clears them.
+func SetBrandBaseURLs(brands map[string]string) {
+	if brands == nil {
+		brands = map[string]string{}
+	}
+	brandBaseURLs = brands
+}
+
+// requestBaseURL returns the public base URL of short links for the host of the request:
+// the branded base URL of the host, or else the configured base URL.
+// The Host header and TLS state are chosen by the client, so they only select among the configured base URLs
+// and never end up in a link; without a configured base URL, it returns "" and links are relative to the host.
+func requestBaseURL(r *http.Request) string {
+	host := strings.ToLower(r.Host)
+	if base, ok := brandBaseURLs[host]; ok {
+		return base
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		if base, ok := brandBaseURLs[hostname]; ok {
+			return base
+		}
+	}
+	return baseURL
+}
+
+// payloadError maps an error decoding a request payload to the response: a body over the size limit
+// keeps its 413 Payload Too Large, anything else is a 400 Bad Request.
+func payloadError(err error) error {
+	if appErr, ok := err.(*types.AppError); ok {
+		return appErr
+	}
+	return types.NewValidationError("Invalid request payload", err)
+}
+
+// fullURL returns the fully-qualified short link of shortURL if the request asks for it with ?full=true,
+// and "" otherwise, so responses keep the bare code by default.
+func fullURL(r *http.Request, shortURL string) string {
+	if full, _ := strconv.ParseBool(r.URL.Query().Get("full")); !full {
+		return ""
+	}
+	return requestBaseURL(r) + "/" + types.APIVersion + "/shorten/" + shortURL
+}
+
+// bareCode reports whether the request asks for the bare code response with ?bare=true, {"code":"abc"}.
+func bareCode(r *http.Request) bool {
+	bare, _ := strconv.ParseBool(r.URL.Query().Get("bare"))
+	return bare
+}
+
+// redirectPreservesMethod reports whether the configured redirect status preserves the method and body,
+// in which case short links also accept POST.
+func redirectPreservesMethod() bool {
+	return redirectStatus == http.StatusTemporaryRedirect || redirectStatus == http.StatusPermanentRedirect
+}
+
+// debug indicates whether debugging details, such as the counters of generated codes, are included in responses.
+var debug = false
+
+// SetDebug sets whether debugging details are included in responses. It must never be enabled in production.
+func SetDebug(enabled bool) {
+	debug = enabled
+}
+
+// noIndex indicates whether redirects and interstitial pages are marked with X-Robots-Tag: noindex.
+var noIndex = false
+
+// SetNoIndex sets whether redirects and interstitial pages are marked with X-Robots-Tag: noindex,
+// preventing search engines from indexing short links.
+func SetNoIndex(enabled bool) {
+	noIndex = enabled
+}
+
+// locationHeaders indicates whether 201 Created responses carry Location and Content-Location headers.
+var locationHeaders = false
+
+// SetLocationHeaders sets whether 201 Created responses point at the created short link with Location
+// and at its record, the representation of the resource, with Content-Location.
+func SetLocationHeaders(enabled bool) {
+	locationHeaders = enabled
+}
+
+// epochTimestamps indicates whether creation times are also returned in seconds since the Unix epoch.
+var epochTimestamps = false
+
+// SetEpochTimestamps sets whether admin creator responses carry the creation time as a Unix epoch integer
+// next to the RFC 3339 string, for clients that don't parse dates.
+func SetEpochTimestamps(enabled bool) {
+	epochTimestamps = enabled
+}
+
+const (
+	// CreateGetMethodNotAllowed answers GET on the create endpoint with 405 Method Not Allowed.
+	CreateGetMethodNotAllowed = "405"
+	// CreateGetUsage answers GET on the create endpoint with a JSON usage hint.
+	CreateGetUsage = "usage"
+)
+
+// createGetUsage indicates whether GET on the create endpoint is answered with a usage hint instead of a 405.
+var createGetUsage = false
+
+// SetCreateGetResponse sets the response to GET on the create endpoint, e.g. a browser opening it:
+// CreateGetMethodNotAllowed or CreateGetUsage. Both carry the Allow header.
+func SetCreateGetResponse(mode string) error {
+	switch mode {
+	case CreateGetMethodNotAllowed, "":
+		createGetUsage = false
+	case CreateGetUsage:
+		createGetUsage = true
+	default:
+		return types.NewConfigError(fmt.Sprintf("Create GET response must be 405 or usage, got %q", mode), nil)
+	}
+	return nil
+}
+
+// unixTimestamp returns t in seconds since the Unix epoch if epoch timestamps are enabled, nil otherwise.
+func unixTimestamp(t *time.Time) *int64 {
+	if !epochTimestamps || t == nil {
+		return nil
+	}
+	unix := t.Unix()
+	return &unix
+}
+
+// setLocationHeaders sets the Location and Content-Location headers of a created short URL, if enabled.
+func setLocationHeaders(w http.ResponseWriter, shortURL string) {
+	if !locationHeaders {
+		return
+	}
+	location := "/" + types.APIVersion + "/shorten/" + shortURL
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Location", location+recordSuffix)
+}
+
 // ShortenedURLHandler is an interface that defines methods for handling shortened URLs.
 type ShortenedURLHandler interface {
 	// CreateShortenedURL handles the creation of a new shortened URL.
@@ -19,8 +193,23 @@ type ShortenedURLHandler interface {
 	// GetShortenedURL handles the retrieval of a long URL from a shortened URL.
 	GetShortenedURL(w http.ResponseWriter, r *http.Request)
 
+	// CheckShortenedURLs handles a batch existence check of shortened URLs.
+	CheckShortenedURLs(w http.ResponseWriter, r *http.Request)
+
+	// ShortenedURLStats handles a batch lookup of the hits of shortened URLs.
+	ShortenedURLStats(w http.ResponseWriter, r *http.Request)
+
+	// UpsertShortenedURL handles the idempotent creation of a shortened URL at a given code.
+	UpsertShortenedURL(w http.ResponseWriter, r *http.Request)
+
+	// ShortenedURLResource dispatches requests on a single shortened URL by method.
+	ShortenedURLResource(w http.ResponseWriter, r *http.Request)
+
 	// SetServiceURL sets the URL service for the handler.
 	SetServiceURL(service service.URLService)
+
+	// SetInterstitialDelay sets the number of seconds the interstitial page is shown before redirecting.
+	SetInterstitialDelay(seconds int)
 }
 
 // NewShortenedURLHandler creates a new instance of ShortenedURLHandler.
@@ -34,51 +223,126 @@ func NewShortenedURLHandler(service service.URLService) ShortenedURLHandler {
 // ShortenedURLHandlerImpl is a concrete implementation of the ShortenedURLHandler interface.
 type ShortenedURLHandlerImpl struct {
 	Service service.URLService // URL service for URL operations
+	upsert  http.Handler       // UpsertShortenedURL wrapped in the creation middleware, nil serves it unwrapped
+
+	interstitialDelay int // Seconds the interstitial page is shown before redirecting, 0 redirects immediately
+}
+
+// backendType returns the storage backend type of the URL service, or "" if no service is set yet.
+func (h *ShortenedURLHandlerImpl) backendType() string {
+	if h.Service == nil {
+		return ""
+	}
+	return h.Service.BackendType()
+}
+
+// ready reports whether the service is set and its database is ready.
+func (h *ShortenedURLHandlerImpl) ready() bool {
+	return h.Service != nil && h.Service.Ready()
 }
 
 // CreateShortenedURL handles the creation of a new shortened URL.
-// It expects a POST request with a JSON payload containing the long URL.
+// It expects a POST request with a JSON payload containing the long URL and optionally a custom alias.
+// With an alias, "If-None-Match: *" makes the creation conditional and an existing alias responds with 412.
 func (h *ShortenedURLHandlerImpl) CreateShortenedURL(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		utils.HandleError(w, types.NewAppError("Method Not Allowed", "Only POST method is allowed", http.StatusMethodNotAllowed, nil))
+		utils.HandleMethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
 	payload, err := types.DecodePayload(r)
 	if err != nil {
-		utils.HandleError(w, types.NewAppError("Failed to decode payload", "Invalid request payload", http.StatusBadRequest, err))
+		utils.HandleError(w, payloadError(err))
 		return
 	}
 	if payload.LongURL == "" {
 		badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Long URL cannot be empty")})
-		utils.HandleError(w, types.NewAppError("Bad Request", badRequest.Error(), http.StatusBadRequest, badRequest))
+		handleRequestError(w, r, types.NewValidationError(badRequest.Error(), badRequest), "")
 		return
 	}
 
 	// Check if service is nil, if so return 503
 	if h.Service == nil {
-		utils.HandleError(w, types.NewAppError("Service Unavailable", "DB is not set up", http.StatusServiceUnavailable, nil))
+		utils.HandleError(w, types.NewUnavailableError("DB is not set up", nil))
 		return
 	}
 
-	shortURL, err := h.Service.CreateShortenedURL(payload.LongURL)
+	var shortURL string
+	if payload.ShortURL != "" {
+		shortURL, err = h.Service.CreateAliasedURL(payload.ShortURL, payload.LongURL)
+	} else {
+		shortURL, err = h.Service.CreateShortenedURLForHost(r.Host, payload.LongURL)
+	}
 	if err != nil {
-		utils.HandleError(w, err)
+		var conflict *types.ConflictError
+		if errors.As(err, &conflict) && payload.ShortURL != "" && r.Header.Get("If-None-Match") == "*" {
+			utils.HandleError(w, types.NewAppError("Precondition Failed", "Short URL already exists", http.StatusPreconditionFailed, conflict))
+			return
+		}
+		if errors.As(err, &conflict) {
+			writeConflict(w, r, conflict)
+			return
+		}
+		handleRequestError(w, r, err, payload.LongURL)
 		return
 	}
 
-	utils.JSONResponse(w, http.StatusCreated, map[string]string{
-		"shortURL": shortURL,
+	if err := h.Service.RecordCreator(shortURL, middleware.ClientIPFromContext(r.Context())); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record creator", "shortURL", shortURL, "error", err, "requestID", w.Header().Get(types.RequestIDHeader))
+	}
+	setLocationHeaders(w, shortURL)
+
+	if bareCode(r) {
+		utils.JSONResponse(w, http.StatusCreated, types.CodeResponse{Code: shortURL})
+		return
+	}
+
+	response := types.ShortenResponse{
+		ShortURL: shortURL,
+		URL:      fullURL(r, shortURL),
+	}
+	if debug {
+		response.Counters = h.Service.DecodeCounters(shortURL)
+	}
+	utils.JSONResponse(w, http.StatusCreated, response)
+}
+
+// writeConflict answers a creation at an existing short URL with 409 Conflict and the existing long URL.
+func writeConflict(w http.ResponseWriter, r *http.Request, conflict *types.ConflictError) {
+	slog.WarnContext(r.Context(), "Short URL already exists", "shortURL", conflict.Key, "requestID", w.Header().Get(types.RequestIDHeader), "backend", middleware.BackendFromContext(r.Context()))
+	utils.JSONResponse(w, http.StatusConflict, types.ConflictResponse{
+		ShortURL: conflict.Key,
+		LongURL:  conflict.LongURL,
+		Conflict: true,
 	})
+}
 
+// createGet answers GET and HEAD on the create endpoint, without a code, with 405 Method Not Allowed or,
+// if configured, a usage hint. It needs no database, so it is registered outside of the readiness check.
+func (h *ShortenedURLHandlerImpl) createGet(w http.ResponseWriter, r *http.Request) {
+	if !createGetUsage {
+		utils.HandleMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	w.Header().Set("Allow", http.MethodPost)
+	utils.JSONResponse(w, http.StatusOK, types.UsageResponse{
+		Message: `Create a short URL by sending a JSON body such as {"longURL": "https://example.com"}`,
+		Method:  http.MethodPost,
+		Path:    "/" + types.APIVersion + "/shorten",
+	})
 }
 
 // GetShortenedURL handles the retrieval of a long URL from a shortened URL.
-// It redirects the user to the long URL associated with the provided short URL.
+// It redirects the user to the long URL associated with the provided short URL, for both GET and HEAD,
+// and for POST if the configured redirect status preserves the method.
+// With an interstitial delay configured, a page showing the destination is served instead, redirecting after the delay.
 // If the short URL does not exist, it returns a 404 Not Found error.
+// Only GET redirects count as hits, after the client is known to still be waiting for the redirect.
+// If the client cancels the request, it stops without counting a hit, redirecting or logging the redirect.
 func (h *ShortenedURLHandlerImpl) GetShortenedURL(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		utils.HandleError(w, types.NewAppError("Method Not Allowed", "Only GET method is allowed", http.StatusMethodNotAllowed, nil))
+	allowed := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodPost && redirectPreservesMethod()
+	if !allowed {
+		utils.HandleMethodNotAllowed(w, http.MethodGet, http.MethodHead)
 		return
 	}
 
@@ -86,18 +350,222 @@ func (h *ShortenedURLHandlerImpl) GetShortenedURL(w http.ResponseWriter, r *http
 
 	// Protection from panic if Service is nil
 	if h.Service == nil {
-		utils.HandleError(w, types.NewAppError("Internal Server Error", "service var is nil", http.StatusInternalServerError, nil))
+		utils.HandleError(w, types.NewInternalError("service var is nil", nil))
+		return
+	}
+
+	// A client that went away doesn't count as a visit
+	if abandoned(r, shortURL) {
 		return
 	}
 
 	longURL, err := h.Service.GetLongURL(shortURL)
 	if err != nil {
-		utils.HandleError(w, err)
+		handleRequestError(w, r, err, "")
+		return
+	}
+
+	if abandoned(r, shortURL) {
+		return
+	}
+
+	if redirectCacheControl != "" {
+		w.Header().Set("Cache-Control", redirectCacheControl)
+	}
+	if noIndex {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+	if h.interstitialDelay > 0 && r.Method != http.MethodPost {
+		writeInterstitial(w, longURL, h.interstitialDelay)
+	} else {
+		http.Redirect(w, r, longURL, redirectStatus)
+	}
+	if r.Method == http.MethodGet {
+		h.Service.RecordHit(shortURL)
+	}
+	h.Service.RecordVisit(shortURL, longURL, middleware.ClientIPFromContext(r.Context()))
+	slog.InfoContext(r.Context(), "Redirecting to long URL", "shortURL", shortURL, "longURL", longURL, "requestID", w.Header().Get(types.RequestIDHeader), "backend", middleware.BackendFromContext(r.Context()))
+}
+
+// abandoned reports whether the client cancelled the request, e.g. by disconnecting, so no further work is done for it.
+func abandoned(r *http.Request, shortURL string) bool {
+	if err := r.Context().Err(); err != nil {
+		slog.DebugContext(r.Context(), "Request abandoned by the client, not redirecting", "shortURL", shortURL, "error", err)
+		return true
+	}
+	return false
+}
+
+// CheckShortenedURLs handles a batch existence check of shortened URLs.
+// It expects a POST request with a JSON payload containing the short URLs
+// and responds with the status of each one, so link checkers avoid N separate requests.
+func (h *ShortenedURLHandlerImpl) CheckShortenedURLs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.HandleMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	payload, err := types.DecodeCheckPayload(r)
+	if err != nil {
+		utils.HandleError(w, payloadError(err))
+		return
+	}
+
+	if h.Service == nil {
+		utils.HandleError(w, types.NewUnavailableError("DB is not set up", nil))
+		return
+	}
+
+	results, err := h.Service.CheckShortURLs(payload.ShortURLs)
+	if err != nil {
+		handleRequestError(w, r, err, "")
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, results)
+}
+
+// ShortenedURLStats handles a batch lookup of the hits of shortened URLs.
+// It expects a POST request with a JSON payload containing the short URLs
+// and responds with the hits of each existing one, so dashboards avoid N separate requests.
+func (h *ShortenedURLHandlerImpl) ShortenedURLStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.HandleMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	payload, err := types.DecodeCheckPayload(r)
+	if err != nil {
+		utils.HandleError(w, payloadError(err))
+		return
+	}
+
+	if h.Service == nil {
+		utils.HandleError(w, types.NewUnavailableError("DB is not set up", nil))
 		return
 	}
 
-	http.Redirect(w, r, longURL, http.StatusMovedPermanently)
-	slog.Info("Redirecting to long URL", "shortURL", shortURL, "longURL", longURL, "requestID", w.Header().Get("X-Request-ID"))
+	hits, err := h.Service.GetHits(payload.ShortURLs)
+	if err != nil {
+		handleRequestError(w, r, err, "")
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, hits)
+}
+
+// UpsertShortenedURL handles the idempotent creation of a shortened URL at a given code.
+// It expects a PUT request with a JSON payload containing the long URL.
+// It responds with 201 Created if the code was created and 200 OK if it already pointed at the long URL.
+// An existing code with another long URL is never replaced, it responds with 409 Conflict like POST.
+func (h *ShortenedURLHandlerImpl) UpsertShortenedURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		utils.HandleMethodNotAllowed(w, http.MethodPut)
+		return
+	}
+
+	shortURL := strings.TrimPrefix(r.URL.Path, "/"+types.APIVersion+"/shorten/")
+
+	payload, err := types.DecodePayload(r)
+	if err != nil {
+		utils.HandleError(w, payloadError(err))
+		return
+	}
+	if payload.LongURL == "" {
+		badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Long URL cannot be empty")})
+		handleRequestError(w, r, types.NewValidationError(badRequest.Error(), badRequest), "")
+		return
+	}
+
+	if h.Service == nil {
+		utils.HandleError(w, types.NewUnavailableError("DB is not set up", nil))
+		return
+	}
+
+	shortURL, created, err := h.Service.UpsertShortenedURL(shortURL, payload.LongURL)
+	if err != nil {
+		var conflict *types.ConflictError
+		if errors.As(err, &conflict) {
+			writeConflict(w, r, conflict)
+			return
+		}
+		handleRequestError(w, r, err, payload.LongURL)
+		return
+	}
+	if created {
+		if err := h.Service.RecordCreator(shortURL, middleware.ClientIPFromContext(r.Context())); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to record creator", "shortURL", shortURL, "error", err, "requestID", w.Header().Get(types.RequestIDHeader))
+		}
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		setLocationHeaders(w, shortURL)
+	}
+	if bareCode(r) {
+		utils.JSONResponse(w, status, types.CodeResponse{Code: shortURL})
+		return
+	}
+	utils.JSONResponse(w, status, types.ShortenResponse{
+		ShortURL: shortURL,
+		URL:      fullURL(r, shortURL),
+	})
+}
+
+// GetShortenedURLRecord handles the retrieval of the public record of a shortened URL as JSON.
+// Its creation time and hits are left out, they are only exposed through the admin and stats endpoints.
+// With ?preview=true the OpenGraph metadata of the long URL is included, if link previews are enabled.
+func (h *ShortenedURLHandlerImpl) GetShortenedURLRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.HandleMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	shortURL, _ := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/"+types.APIVersion+"/shorten/"), recordSuffix)
+
+	if h.Service == nil {
+		utils.HandleError(w, types.NewUnavailableError("DB is not set up", nil))
+		return
+	}
+
+	record, err := h.Service.GetRecord(shortURL)
+	if err != nil {
+		handleRequestError(w, r, err, "")
+		return
+	}
+	response := types.RecordResponse{ShortURL: record.ShortURL, LongURL: record.LongURL}
+	if preview, _ := strconv.ParseBool(r.URL.Query().Get("preview")); preview {
+		response.Preview = h.Service.GetLinkPreview(record.LongURL)
+	}
+	utils.JSONResponse(w, http.StatusOK, response)
+}
+
+// recordSuffix is the path suffix of the record of a shortened URL. Short URLs never contain a slash.
+const recordSuffix = "/record"
+
+// ShortenedURLResource dispatches requests on a single shortened URL by method:
+// GET and HEAD redirect to the long URL, PUT creates it through the creation middleware.
+// POST also redirects if the configured redirect status preserves the method.
+// Requests on /v1/shorten/{shortURL}/record return its record instead, a code named record still redirects.
+func (h *ShortenedURLHandlerImpl) ShortenedURLResource(w http.ResponseWriter, r *http.Request) {
+	_, isRecord := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/"+types.APIVersion+"/shorten/"), recordSuffix)
+	switch {
+	case isRecord:
+		h.GetShortenedURLRecord(w, r)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		h.GetShortenedURL(w, r)
+	case r.Method == http.MethodPost && redirectPreservesMethod():
+		h.GetShortenedURL(w, r)
+	case r.Method == http.MethodPut && h.upsert != nil:
+		h.upsert.ServeHTTP(w, r)
+	case r.Method == http.MethodPut:
+		h.UpsertShortenedURL(w, r)
+	case redirectPreservesMethod():
+		utils.HandleMethodNotAllowed(w, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut)
+	default:
+		utils.HandleMethodNotAllowed(w, http.MethodGet, http.MethodHead, http.MethodPut)
+	}
 }
 
 // SetServiceURL sets the URL service for the handler.
@@ -107,15 +575,40 @@ func (h *ShortenedURLHandlerImpl) SetServiceURL(service service.URLService) {
 
 // RegisterAPIRoutesWithMiddleware registers API routes for the URL shortening service with middlewares.
 // It sets up routes for creating and retrieving shortened URLs, with a database readiness check.
-func RegisterAPIRoutesWithMiddleware(mux *http.ServeMux, service service.URLService) ShortenedURLHandler {
+// Any createMiddleware (e.g. creation quotas) wraps only the creation of shortened URLs, by POST or PUT.
+func RegisterAPIRoutesWithMiddleware(mux *http.ServeMux, service service.URLService, createMiddleware ...func(http.Handler) http.Handler) ShortenedURLHandler {
 	// ShortenedURLHandler
-	shortenedURLHandler := NewShortenedURLHandler(service)
+	shortenedURLHandler := &ShortenedURLHandlerImpl{Service: service}
+	backend := middleware.BackendMiddleware(shortenedURLHandler.backendType)
+	dbReady := middleware.DBReadyMiddleware(shortenedURLHandler.ready)
 
 	// API route for creating a shortened URL
-	mux.Handle("/"+types.APIVersion+"/shorten", middleware.DBReadyMiddleware(http.HandlerFunc(shortenedURLHandler.CreateShortenedURL)))
+	var createHandler http.Handler = http.HandlerFunc(shortenedURLHandler.CreateShortenedURL)
+	for _, mw := range createMiddleware {
+		createHandler = mw(createHandler)
+	}
+	createHandler = dbReady(backend(createHandler))
+	var upsertHandler http.Handler = http.HandlerFunc(shortenedURLHandler.UpsertShortenedURL)
+	for _, mw := range createMiddleware {
+		upsertHandler = mw(upsertHandler)
+	}
+	shortenedURLHandler.upsert = upsertHandler
+	mux.HandleFunc("/"+types.APIVersion+"/shorten", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			shortenedURLHandler.createGet(w, r)
+			return
+		}
+		createHandler.ServeHTTP(w, r)
+	})
+
+	// API route for checking the existence of a batch of shortened URLs
+	mux.Handle("/"+types.APIVersion+"/shorten/check", dbReady(backend(http.HandlerFunc(shortenedURLHandler.CheckShortenedURLs))))
+
+	// API route for the hits of a batch of shortened URLs
+	mux.Handle("/"+types.APIVersion+"/shorten/stats", dbReady(backend(http.HandlerFunc(shortenedURLHandler.ShortenedURLStats))))
 
-	// API route for retrieving a long URL from a shortened URL
-	mux.Handle("/"+types.APIVersion+"/shorten/", middleware.DBReadyMiddleware(http.HandlerFunc(shortenedURLHandler.GetShortenedURL)))
+	// API route for retrieving (GET) or creating (PUT) a shortened URL, or its record
+	mux.Handle("/"+types.APIVersion+"/shorten/", dbReady(backend(http.HandlerFunc(shortenedURLHandler.ShortenedURLResource))))
 
 	return shortenedURLHandler
 }
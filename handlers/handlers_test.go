@@ -1,18 +1,52 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
 
+	"github.com/pizza-nz/url-shortener/middleware"
+	"github.com/pizza-nz/url-shortener/service"
 	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
 )
 
 // MockURLService is a mock implementation of the URLService interface for testing purposes.
 type MockURLService struct {
 	CreateShortenedURLFunc func(longURL string) (string, error)
+	CreateForHostFunc      func(host, longURL string) (string, error)
 	GetLongURLFunc         func(shortURL string) (string, error)
+	CheckShortURLsFunc     func(shortURLs []string) (map[string]string, error)
+	UpsertShortenedURLFunc func(shortURL, longURL string) (string, bool, error)
+	CreateAliasedURLFunc   func(shortURL, longURL string) (string, error)
+	RecordCreatorFunc      func(shortURL, ip string) error
+	GetCreatorFunc         func(shortURL string) (types.Creator, error)
+	ListURLsFunc           func(limit, offset int) ([]types.URLEntry, int, error)
+	ListURLsAfterFunc      func(after string, limit int) ([]types.URLEntry, string, error)
+	FetchLongURLFunc       func(ctx context.Context, shortURL string) (*http.Response, error)
+	LookupLongURLFunc      func(longURL string) ([]string, error)
+	ReadyFunc              func() bool
+	GetRecordFunc          func(shortURL string) (*types.URLRecord, error)
+	GetHitsFunc            func(shortURLs []string) (map[string]uint64, error)
+	DecodeCountersFunc     func(shortURL string) []uint64
+	GetLinkPreviewFunc     func(longURL string) *types.LinkPreview
+	SubscribeEventsFunc    func() (<-chan types.Event, func())
+	RecordVisitFunc        func(shortURL, longURL, ip string)
+	RecordHitFunc          func(shortURL string)
 }
 
 // CreateShortenedURL mocks the CreateShortenedURL method of the URLService interface.
@@ -20,11 +54,124 @@ func (m *MockURLService) CreateShortenedURL(longURL string) (string, error) {
 	return m.CreateShortenedURLFunc(longURL)
 }
 
+// CreateShortenedURLForHost mocks the CreateShortenedURLForHost method of the URLService interface.
+// It calls CreateShortenedURLFunc, ignoring the host, if CreateForHostFunc is nil.
+func (m *MockURLService) CreateShortenedURLForHost(host, longURL string) (string, error) {
+	if m.CreateForHostFunc == nil {
+		return m.CreateShortenedURLFunc(longURL)
+	}
+	return m.CreateForHostFunc(host, longURL)
+}
+
 // GetLongURL mocks the GetLongURL method of the URLService interface.
 func (m *MockURLService) GetLongURL(shortURL string) (string, error) {
 	return m.GetLongURLFunc(shortURL)
 }
 
+// CheckShortURLs mocks the CheckShortURLs method of the URLService interface.
+func (m *MockURLService) CheckShortURLs(shortURLs []string) (map[string]string, error) {
+	return m.CheckShortURLsFunc(shortURLs)
+}
+
+// UpsertShortenedURL mocks the UpsertShortenedURL method of the URLService interface.
+func (m *MockURLService) UpsertShortenedURL(shortURL, longURL string) (string, bool, error) {
+	return m.UpsertShortenedURLFunc(shortURL, longURL)
+}
+
+// CreateAliasedURL mocks the CreateAliasedURL method of the URLService interface.
+func (m *MockURLService) CreateAliasedURL(shortURL, longURL string) (string, error) {
+	return m.CreateAliasedURLFunc(shortURL, longURL)
+}
+
+// RecordCreator mocks the RecordCreator method of the URLService interface.
+// It is a no-op unless RecordCreatorFunc is set.
+func (m *MockURLService) RecordCreator(shortURL, ip string) error {
+	if m.RecordCreatorFunc == nil {
+		return nil
+	}
+	return m.RecordCreatorFunc(shortURL, ip)
+}
+
+// GetRecord mocks the GetRecord method of the URLService interface.
+func (m *MockURLService) GetRecord(shortURL string) (*types.URLRecord, error) {
+	return m.GetRecordFunc(shortURL)
+}
+
+// ListURLs mocks the ListURLs method of the URLService interface.
+func (m *MockURLService) ListURLs(limit, offset int) ([]types.URLEntry, int, error) {
+	return m.ListURLsFunc(limit, offset)
+}
+
+// FetchLongURL mocks the FetchLongURL method of the URLService interface.
+func (m *MockURLService) FetchLongURL(ctx context.Context, shortURL string) (*http.Response, error) {
+	return m.FetchLongURLFunc(ctx, shortURL)
+}
+
+// LookupLongURL mocks the LookupLongURL method of the URLService interface.
+func (m *MockURLService) LookupLongURL(longURL string) ([]string, error) {
+	return m.LookupLongURLFunc(longURL)
+}
+
+// ListURLsAfter mocks the ListURLsAfter method of the URLService interface.
+func (m *MockURLService) ListURLsAfter(after string, limit int) ([]types.URLEntry, string, error) {
+	return m.ListURLsAfterFunc(after, limit)
+}
+
+// GetCreator mocks the GetCreator method of the URLService interface.
+func (m *MockURLService) GetCreator(shortURL string) (types.Creator, error) {
+	return m.GetCreatorFunc(shortURL)
+}
+
+// GetHits mocks the GetHits method of the URLService interface.
+func (m *MockURLService) GetHits(shortURLs []string) (map[string]uint64, error) {
+	return m.GetHitsFunc(shortURLs)
+}
+
+// DecodeCounters mocks the DecodeCounters method of the URLService interface.
+func (m *MockURLService) DecodeCounters(shortURL string) []uint64 {
+	return m.DecodeCountersFunc(shortURL)
+}
+
+// GetLinkPreview mocks the GetLinkPreview method of the URLService interface.
+func (m *MockURLService) GetLinkPreview(longURL string) *types.LinkPreview {
+	return m.GetLinkPreviewFunc(longURL)
+}
+
+// SubscribeEvents mocks the SubscribeEvents method of the URLService interface.
+func (m *MockURLService) SubscribeEvents() (<-chan types.Event, func()) {
+	return m.SubscribeEventsFunc()
+}
+
+// RecordVisit mocks the RecordVisit method of the URLService interface.
+// It is a no-op unless RecordVisitFunc is set.
+func (m *MockURLService) RecordVisit(shortURL, longURL, ip string) {
+	if m.RecordVisitFunc != nil {
+		m.RecordVisitFunc(shortURL, longURL, ip)
+	}
+}
+
+// RecordHit mocks the RecordHit method of the URLService interface.
+// It is a no-op unless RecordHitFunc is set.
+func (m *MockURLService) RecordHit(shortURL string) {
+	if m.RecordHitFunc != nil {
+		m.RecordHitFunc(shortURL)
+	}
+}
+
+// BackendType mocks the BackendType method of the URLService interface.
+func (m *MockURLService) BackendType() string {
+	return "mock"
+}
+
+// Ready mocks the Ready method of the URLService interface.
+// The service is ready unless ReadyFunc is set.
+func (m *MockURLService) Ready() bool {
+	if m.ReadyFunc == nil {
+		return true
+	}
+	return m.ReadyFunc()
+}
+
 // CountersArr mocks the CountersArr method of the URLService interface.
 func (m *MockURLService) CountersArr() []uint64 {
 	return []uint64{1, 2}
@@ -61,6 +208,11 @@ func TestCreateShortenedURL(t *testing.T) {
 			rr.Body.String(), expected)
 	}
 
+	if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "no-store" {
+		t.Errorf("handler returned wrong Cache-Control header: got %v want %v",
+			cacheControl, "no-store")
+	}
+
 	// Test case 2: Invalid request - empty longURL
 	payload = strings.NewReader(`{"longURL": ""}`)
 	req, err = http.NewRequest("POST", "/"+types.APIVersion+"/shorten", payload)
@@ -79,6 +231,7 @@ func TestCreateShortenedURL(t *testing.T) {
 
 // TestGetShortenedURL tests the GetShortenedURL handler function.
 func TestGetShortenedURL(t *testing.T) {
+	var hits []string
 	mockService := &MockURLService{
 		GetLongURLFunc: func(shortURL string) (string, error) {
 			if shortURL == "exists" {
@@ -86,6 +239,9 @@ func TestGetShortenedURL(t *testing.T) {
 			}
 			return "", types.NewAppError("Not Found", "URL not found", http.StatusNotFound, nil)
 		},
+		RecordHitFunc: func(shortURL string) {
+			hits = append(hits, shortURL)
+		},
 	}
 
 	handler := NewShortenedURLHandler(mockService)
@@ -119,4 +275,1885 @@ func TestGetShortenedURL(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusNotFound)
 	}
+
+	// Test case 3: HEAD redirects without counting a hit
+	req, err = http.NewRequest("HEAD", "/"+types.APIVersion+"/shorten"+"/exists", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.GetShortenedURL(rr, req)
+
+	if status := rr.Code; status != http.StatusMovedPermanently {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusMovedPermanently)
+	}
+	if len(hits) != 1 || hits[0] != "exists" {
+		t.Errorf("hits = %v, want only the GET redirect of exists", hits)
+	}
+}
+
+// MockHealthChecker is a mock implementation of the HealthChecker interface for testing purposes.
+type MockHealthChecker struct {
+	PingErr       error
+	CheckWriteErr error
+	Pings         atomic.Int32
+}
+
+// Ping mocks the Ping method of the HealthChecker interface.
+func (m *MockHealthChecker) Ping() error {
+	m.Pings.Add(1)
+	return m.PingErr
+}
+
+// CheckWrite mocks the CheckWrite method of the HealthChecker interface.
+func (m *MockHealthChecker) CheckWrite() error {
+	return m.CheckWriteErr
+}
+
+// TestReadyz tests the Readyz handler function with and without the deep write check.
+func TestReadyz(t *testing.T) {
+	readOnlyDB := &MockHealthChecker{
+		CheckWriteErr: errors.New("cannot execute INSERT in a read-only transaction"),
+	}
+
+	tests := []struct {
+		name      string
+		db        *MockHealthChecker
+		deepCheck bool
+		want      int
+	}{
+		{"no database", nil, false, http.StatusServiceUnavailable},
+		{"ping fails", &MockHealthChecker{PingErr: errors.New("connection refused")}, false, http.StatusServiceUnavailable},
+		{"ping only ignores failing writes", readOnlyDB, false, http.StatusOK},
+		{"deep check catches failing writes", readOnlyDB, true, http.StatusServiceUnavailable},
+		{"deep check healthy", &MockHealthChecker{}, true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHealthHandler(nil, tt.deepCheck, 0)
+			if tt.db != nil {
+				handler.SetDatabase(tt.db)
+			}
+
+			req, err := http.NewRequest("GET", "/readyz", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.Readyz(rr, req)
+
+			if status := rr.Code; status != tt.want {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.want)
+			}
+		})
+	}
+}
+
+// TestReadyzCache tests that rapid probes ping the database at most once per cache interval.
+func TestReadyzCache(t *testing.T) {
+	db := &MockHealthChecker{}
+	handler := NewHealthHandler(db, false, time.Second)
+	now := time.Now()
+	handler.now = func() time.Time { return now }
+
+	probe := func() int {
+		rr := httptest.NewRecorder()
+		handler.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+		return rr.Code
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probe()
+		}()
+	}
+	wg.Wait()
+	if pings := db.Pings.Load(); pings != 1 {
+		t.Errorf("Pings within the interval = %v, want 1", pings)
+	}
+
+	// The cached result is served even after the database fails
+	db.PingErr = errors.New("connection refused")
+	now = now.Add(999 * time.Millisecond)
+	if status := probe(); status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	// The first probe after the interval checks again
+	now = now.Add(time.Millisecond)
+	if status := probe(); status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusServiceUnavailable)
+	}
+	if pings := db.Pings.Load(); pings != 2 {
+		t.Errorf("Pings after the interval = %v, want 2", pings)
+	}
+}
+
+// TestMetrics tests that the metrics endpoint exposes the counter fallback metric.
+func TestMetrics(t *testing.T) {
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	Metrics(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "url_shortener_counter_fallbacks_total ") {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+// TestCreateShortenedURLJSONCasing tests the create response with camelCase and snake_case keys.
+func TestCreateShortenedURLJSONCasing(t *testing.T) {
+	defer utils.SetJSONCasing("camel")
+
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			return "abc", nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	tests := []struct {
+		casing   string
+		expected string
+	}{
+		{"camel", `{"shortURL":"abc"}`},
+		{"snake", `{"short_url":"abc"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.casing, func(t *testing.T) {
+			if err := utils.SetJSONCasing(tt.casing); err != nil {
+				t.Fatal(err)
+			}
+
+			payload := strings.NewReader(`{"longURL": "http://example.com"}`)
+			req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten", payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.CreateShortenedURL(rr, req)
+
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expected {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					body, tt.expected)
+			}
+		})
+	}
+}
+
+// TestMethodNotAllowedAllowHeader tests that 405 responses list the permitted methods in the Allow header.
+func TestMethodNotAllowedAllowHeader(t *testing.T) {
+	handler := NewShortenedURLHandler(&MockURLService{})
+
+	tests := []struct {
+		name    string
+		method  string
+		handle  http.HandlerFunc
+		allowed string
+	}{
+		{"create rejects GET", http.MethodGet, handler.CreateShortenedURL, "POST"},
+		{"redirect rejects POST", http.MethodPost, handler.GetShortenedURL, "GET, HEAD"},
+		{"redirect rejects DELETE", http.MethodDelete, handler.GetShortenedURL, "GET, HEAD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/"+types.APIVersion+"/shorten/abc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			tt.handle(rr, req)
+
+			if status := rr.Code; status != http.StatusMethodNotAllowed {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, http.StatusMethodNotAllowed)
+			}
+			if allow := rr.Header().Get("Allow"); allow != tt.allowed {
+				t.Errorf("handler returned wrong Allow header: got %v want %v",
+					allow, tt.allowed)
+			}
+		})
+	}
+}
+
+// TestCheckShortenedURLs tests the CheckShortenedURLs handler function.
+func TestCheckShortenedURLs(t *testing.T) {
+	mockService := &MockURLService{
+		CheckShortURLsFunc: func(shortURLs []string) (map[string]string, error) {
+			return map[string]string{"exists": types.StatusActive, "missing": types.StatusNotFound}, nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	payload := strings.NewReader(`{"shortURLs": ["exists", "missing"]}`)
+	req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten/check", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.CheckShortenedURLs(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	expected := `{"exists":"active","missing":"not_found"}`
+	if body := strings.TrimSpace(rr.Body.String()); body != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v",
+			body, expected)
+	}
+}
+
+// TestUpsertShortenedURL tests the UpsertShortenedURL handler for the create, unchanged and conflict branches,
+// and that PUT passes through the creation middleware like POST.
+func TestUpsertShortenedURL(t *testing.T) {
+	existing := map[string]string{"docs": "https://example.com/v2", "blog": "https://example.com/blog"}
+	mockService := &MockURLService{
+		UpsertShortenedURLFunc: func(shortURL, longURL string) (string, bool, error) {
+			current, exists := existing[shortURL]
+			if exists && current != longURL {
+				conflict := types.NewConflictError(shortURL)
+				conflict.LongURL = current
+				return "", false, types.NewConflictAppError("Short URL already exists", conflict)
+			}
+			existing[shortURL] = longURL
+			return shortURL, !exists, nil
+		},
+		RecordCreatorFunc: func(shortURL, ip string) error { return nil },
+		ReadyFunc:         func() bool { return true },
+	}
+	mux := http.NewServeMux()
+	createMiddlewareCalls := 0
+	RegisterAPIRoutesWithMiddleware(mux, mockService, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			createMiddlewareCalls++
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	tests := []struct {
+		name     string
+		shortURL string
+		want     int
+		wantURL  string
+	}{
+		{"existing code with the same long URL", "docs", http.StatusOK, "https://example.com/v2"},
+		{"create new code", "wiki", http.StatusCreated, "https://example.com/v2"},
+		{"existing code with another long URL", "blog", http.StatusConflict, "https://example.com/blog"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := strings.NewReader(`{"longURL": "https://example.com/v2"}`)
+			req, err := http.NewRequest("PUT", "/"+types.APIVersion+"/shorten/"+tt.shortURL, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.want {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.want)
+			}
+			if existing[tt.shortURL] != tt.wantURL {
+				t.Errorf("%v points at %v, want %v", tt.shortURL, existing[tt.shortURL], tt.wantURL)
+			}
+			if createMiddlewareCalls != i+1 {
+				t.Errorf("creation middleware called %d times, want %d", createMiddlewareCalls, i+1)
+			}
+		})
+	}
+}
+
+// TestCreateShortenedURLInvalidUTF8 tests that a payload with invalid UTF-8 is rejected with a clean 400.
+func TestCreateShortenedURLInvalidUTF8(t *testing.T) {
+	called := false
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			called = true
+			return "shortURL", nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	payload := strings.NewReader("{\"longURL\": \"http://example.com/\xff\xfe\"}")
+	req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.CreateShortenedURL(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusBadRequest)
+	}
+	if called {
+		t.Error("Expected the service not to be called with an invalid UTF-8 long URL")
+	}
+	if !utf8.Valid(rr.Body.Bytes()) {
+		t.Errorf("handler returned a body that is not valid UTF-8: %q", rr.Body.String())
+	}
+}
+
+// TestCreateShortenedURLConflict tests that a conflict responds with 409 and the existing resource.
+func TestCreateShortenedURLConflict(t *testing.T) {
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			conflict := types.NewConflictError("abc")
+			conflict.LongURL = "http://example.org"
+			return "", types.NewAppError("Conflict", "Short URL already exists", http.StatusConflict, conflict)
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	payload := strings.NewReader(`{"longURL": "http://example.com"}`)
+	req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.CreateShortenedURL(rr, req)
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusConflict)
+	}
+
+	expected := `{"shortURL":"abc","longURL":"http://example.org","conflict":true}`
+	if body := strings.TrimSpace(rr.Body.String()); body != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v",
+			body, expected)
+	}
+}
+
+// TestAPIRoutesReadiness tests that the API routes are served once the service's database is ready,
+// and answered with 503 before the service is set or while its database is not ready.
+func TestAPIRoutesReadiness(t *testing.T) {
+	ready := false
+	mockService := &MockURLService{
+		GetLongURLFunc: func(shortURL string) (string, error) {
+			return "http://example.com", nil
+		},
+		ReadyFunc: func() bool { return ready },
+	}
+	mux := http.NewServeMux()
+	handler := RegisterAPIRoutesWithMiddleware(mux, nil)
+
+	tests := []struct {
+		name           string
+		setup          func()
+		expectedStatus int
+	}{
+		{"service not set", func() {}, http.StatusServiceUnavailable},
+		{"database not ready", func() { handler.SetServiceURL(mockService) }, http.StatusServiceUnavailable},
+		{"database ready", func() { ready = true }, http.StatusMovedPermanently},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			req := httptest.NewRequest("GET", "/"+types.APIVersion+"/shorten/jR", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+// TestCreateEndpointGet tests that GET on the bare create path answers with a 405 or the usage hint,
+// without a database, while GET with a code still redirects.
+func TestCreateEndpointGet(t *testing.T) {
+	defer SetCreateGetResponse(CreateGetMethodNotAllowed)
+
+	mockService := &MockURLService{
+		GetLongURLFunc: func(shortURL string) (string, error) {
+			return "http://example.com", nil
+		},
+		ReadyFunc: func() bool { return false },
+	}
+	mux := http.NewServeMux()
+	RegisterAPIRoutesWithMiddleware(mux, mockService)
+
+	tests := []struct {
+		name           string
+		mode           string
+		path           string
+		expectedStatus int
+		expectedMethod string
+	}{
+		{"405", CreateGetMethodNotAllowed, "/" + types.APIVersion + "/shorten", http.StatusMethodNotAllowed, ""},
+		{"usage", CreateGetUsage, "/" + types.APIVersion + "/shorten", http.StatusOK, http.MethodPost},
+		{"code with usage", CreateGetUsage, "/" + types.APIVersion + "/shorten/jR", http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetCreateGetResponse(tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", tt.path, nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if strings.HasSuffix(tt.path, "/jR") {
+				return
+			}
+			if allow := rr.Header().Get("Allow"); allow != http.MethodPost {
+				t.Errorf("Allow = %v, want %v", allow, http.MethodPost)
+			}
+			var usage types.UsageResponse
+			json.NewDecoder(rr.Body).Decode(&usage)
+			if usage.Method != tt.expectedMethod {
+				t.Errorf("usage method = %q, want %q", usage.Method, tt.expectedMethod)
+			}
+		})
+	}
+
+	if err := SetCreateGetResponse("html"); err == nil {
+		t.Error("Expected an error for an unsupported mode, but got nil")
+	}
+}
+
+// TestBackendInLogs tests that the storage backend from the request context appears in handler logs.
+func TestBackendInLogs(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	mockService := &MockURLService{
+		GetLongURLFunc: func(shortURL string) (string, error) {
+			return "http://example.com", nil
+		},
+	}
+	handler := &ShortenedURLHandlerImpl{Service: mockService}
+
+	req, err := http.NewRequest("GET", "/"+types.APIVersion+"/shorten/abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	middleware.BackendMiddleware(handler.backendType)(http.HandlerFunc(handler.GetShortenedURL)).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusMovedPermanently {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusMovedPermanently)
+	}
+	if !strings.Contains(buf.String(), "backend=mock") {
+		t.Errorf("handler logs do not contain the backend: got %v", buf.String())
+	}
+}
+
+// TestValidationLogging tests that validation failures are logged with their fields at debug level, rate-limited,
+// and that the long URL is only logged in debug mode.
+func TestValidationLogging(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(defaultLogger)
+	SetValidationLogging(true, 1)
+	defer SetValidationLogging(false, 0)
+
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Long URL host does not resolve")})
+			return "", types.NewAppError("Bad Request", badRequest.Error(), http.StatusBadRequest, badRequest)
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	create := func() {
+		req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten", strings.NewReader(`{"longURL":"http://secret.invalid/token"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.CreateShortenedURL(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusBadRequest)
+		}
+	}
+
+	create()
+	logs := buf.String()
+	for _, want := range []string{"level=DEBUG", `msg="Validation failed"`, "field=LongURL", `issue="Long URL host does not resolve"`} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("validation log does not contain %v: got %v", want, logs)
+		}
+	}
+	if strings.Contains(logs, "longURL=") {
+		t.Errorf("validation log contains the long URL outside debug mode: got %v", logs)
+	}
+
+	// The second failure within the same second is over the rate limit
+	buf.Reset()
+	create()
+	if strings.Contains(buf.String(), "Validation failed") {
+		t.Errorf("validation log is not rate-limited: got %v", buf.String())
+	}
+
+	// In debug mode the long URL is included
+	SetValidationLogging(true, 1)
+	SetDebug(true)
+	defer SetDebug(false)
+	buf.Reset()
+	create()
+	if !strings.Contains(buf.String(), "longURL=http://secret.invalid/token") {
+		t.Errorf("validation log does not contain the long URL in debug mode: got %v", buf.String())
+	}
+}
+
+// TestFullURLResponses tests that ?full=true adds the fully-qualified short link to create and upsert responses,
+// and that ?bare=true returns the bare code only.
+func TestFullURLResponses(t *testing.T) {
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			return "jR", nil
+		},
+		UpsertShortenedURLFunc: func(shortURL, longURL string) (string, bool, error) {
+			return shortURL, true, nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService).(*ShortenedURLHandlerImpl)
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		baseURL      string
+		expectedBody string
+	}{
+		{"create bare code", "POST", "/v1/shorten", "", `{"shortURL":"jR"}`},
+		{"create relative URL without base URL", "POST", "/v1/shorten?full=true", "", `{"shortURL":"jR","url":"/v1/shorten/jR"}`},
+		{"create full URL from base URL", "POST", "/v1/shorten?full=true", "https://go.example/", `{"shortURL":"jR","url":"https://go.example/v1/shorten/jR"}`},
+		{"create full=false", "POST", "/v1/shorten?full=false", "https://go.example", `{"shortURL":"jR"}`},
+		{"upsert bare code", "PUT", "/v1/shorten/docs", "", `{"shortURL":"docs"}`},
+		{"upsert full URL", "PUT", "/v1/shorten/docs?full=true", "https://go.example", `{"shortURL":"docs","url":"https://go.example/v1/shorten/docs"}`},
+		{"create bare code mode", "POST", "/v1/shorten?bare=true", "https://go.example", `{"code":"jR"}`},
+		{"upsert bare code mode", "PUT", "/v1/shorten/docs?bare=true", "https://go.example", `{"code":"docs"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetBaseURL(tt.baseURL)
+			defer SetBaseURL("")
+
+			req, err := http.NewRequest(tt.method, "http://sho.rt"+tt.target, strings.NewReader(`{"longURL":"http://example.com"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			if tt.method == "PUT" {
+				handler.UpsertShortenedURL(rr, req)
+			} else {
+				handler.CreateShortenedURL(rr, req)
+			}
+
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestLocationHeaders tests that created short URLs point at the short link and its record when enabled.
+func TestLocationHeaders(t *testing.T) {
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			return "jR", nil
+		},
+		UpsertShortenedURLFunc: func(shortURL, longURL string) (string, bool, error) {
+			return shortURL, shortURL == "new", nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService).(*ShortenedURLHandlerImpl)
+
+	tests := []struct {
+		name                    string
+		enabled                 bool
+		method                  string
+		target                  string
+		expectedStatus          int
+		expectedLocation        string
+		expectedContentLocation string
+	}{
+		{"create", true, "POST", "/v1/shorten", http.StatusCreated, "/v1/shorten/jR", "/v1/shorten/jR/record"},
+		{"upsert created", true, "PUT", "/v1/shorten/new", http.StatusCreated, "/v1/shorten/new", "/v1/shorten/new/record"},
+		{"upsert replaced", true, "PUT", "/v1/shorten/docs", http.StatusOK, "", ""},
+		{"disabled", false, "POST", "/v1/shorten", http.StatusCreated, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetLocationHeaders(tt.enabled)
+			defer SetLocationHeaders(false)
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{"longURL":"http://example.com"}`))
+			rr := httptest.NewRecorder()
+			if tt.method == "PUT" {
+				handler.UpsertShortenedURL(rr, req)
+			} else {
+				handler.CreateShortenedURL(rr, req)
+			}
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("handler returned wrong Location: got %q want %q", location, tt.expectedLocation)
+			}
+			if contentLocation := rr.Header().Get("Content-Location"); contentLocation != tt.expectedContentLocation {
+				t.Errorf("handler returned wrong Content-Location: got %q want %q", contentLocation, tt.expectedContentLocation)
+			}
+		})
+	}
+}
+
+// TestBrandBaseURLs tests that full URLs use the base URL of the branded domain the request was sent to.
+func TestBrandBaseURLs(t *testing.T) {
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			return "jR", nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService).(*ShortenedURLHandlerImpl)
+
+	SetBaseURL("https://sho.rt")
+	defer SetBaseURL("")
+	SetBrandBaseURLs(map[string]string{"go.brand-a.com": "https://go.brand-a.com", "links.brand-b.com": "https://brand-b.link"})
+	defer SetBrandBaseURLs(nil)
+
+	tests := []struct {
+		name         string
+		host         string
+		expectedBody string
+	}{
+		{"first brand", "go.brand-a.com", `{"shortURL":"jR","url":"https://go.brand-a.com/v1/shorten/jR"}`},
+		{"second brand with port", "links.brand-b.com:8080", `{"shortURL":"jR","url":"https://brand-b.link/v1/shorten/jR"}`},
+		{"unbranded host", "api.internal", `{"shortURL":"jR","url":"https://sho.rt/v1/shorten/jR"}`},
+		{"spoofed host", "evil.example", `{"shortURL":"jR","url":"https://sho.rt/v1/shorten/jR"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/shorten?full=true", strings.NewReader(`{"longURL":"http://example.com"}`))
+			req.Host = tt.host
+
+			rr := httptest.NewRecorder()
+			handler.CreateShortenedURL(rr, req)
+
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestGetShortenedURLRecord tests that /record returns the record as JSON instead of redirecting.
+func TestGetShortenedURLRecord(t *testing.T) {
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockService := &MockURLService{
+		GetRecordFunc: func(shortURL string) (*types.URLRecord, error) {
+			if shortURL != "jR" {
+				return nil, types.NewAppError("Not Found", "Service failed to get URL record", http.StatusNotFound, nil)
+			}
+			return &types.URLRecord{ShortURL: shortURL, LongURL: "http://example.com", CreatedAt: &createdAt, Hits: 42}, nil
+		},
+		GetLinkPreviewFunc: func(longURL string) *types.LinkPreview {
+			return &types.LinkPreview{Title: "Example"}
+		},
+		GetLongURLFunc: func(shortURL string) (string, error) {
+			return "http://example.com/" + shortURL, nil
+		},
+		RecordVisitFunc: func(shortURL, longURL, ip string) {},
+	}
+	handler := NewShortenedURLHandler(mockService).(*ShortenedURLHandlerImpl)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"existing record without creation time and hits", "GET", "/v1/shorten/jR/record", http.StatusOK, `{"shortURL":"jR","longURL":"http://example.com"}`},
+		{"existing record with preview", "GET", "/v1/shorten/jR/record?preview=true", http.StatusOK, `{"shortURL":"jR","longURL":"http://example.com","preview":{"title":"Example"}}`},
+		{"code named record redirects", "GET", "/v1/shorten/record", http.StatusMovedPermanently, ""},
+		{"missing record", "GET", "/v1/shorten/missing/record", http.StatusNotFound, `{"message":"Not Found"}`},
+		{"wrong method", "PUT", "/v1/shorten/jR/record", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ShortenedURLResource(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if body := strings.TrimSpace(rr.Body.String()); tt.expectedBody != "" && body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestEpochTimestamps tests that creator responses carry the creation time as an RFC 3339 string
+// and, if enabled, as a matching Unix epoch integer, in both JSON casings.
+func TestEpochTimestamps(t *testing.T) {
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.FixedZone("NZDT", 13*3600))
+	mockService := &MockURLService{
+		GetCreatorFunc: func(shortURL string) (types.Creator, error) {
+			return types.Creator{IP: "203.0.113.7", CreatedAt: createdAt}, nil
+		},
+	}
+	admin := NewAdminHandler(mockService, "secret")
+	defer SetEpochTimestamps(false)
+	defer utils.SetJSONCasing("camel")
+
+	tests := []struct {
+		name      string
+		epoch     bool
+		casing    string
+		path      string
+		serve     http.HandlerFunc
+		timeKey   string
+		epochKey  string
+		wantEpoch bool
+	}{
+		{"creator disabled", false, "camel", "/admin/v1/creators/jR", admin.GetCreator, "createdAt", "createdAtUnix", false},
+		{"creator", true, "camel", "/admin/v1/creators/jR", admin.GetCreator, "createdAt", "createdAtUnix", true},
+		{"creator snake case", true, "snake", "/admin/v1/creators/jR", admin.GetCreator, "created_at", "created_at_unix", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetEpochTimestamps(tt.epoch)
+			if err := utils.SetJSONCasing(tt.casing); err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer secret")
+
+			rr := httptest.NewRecorder()
+			tt.serve(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v",
+					status, http.StatusOK)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			formatted, _ := body[tt.timeKey].(string)
+			parsed, err := time.Parse(time.RFC3339, formatted)
+			if err != nil || !parsed.Equal(createdAt) {
+				t.Errorf("handler returned wrong %v: got %v want %v", tt.timeKey, body[tt.timeKey], createdAt.Format(time.RFC3339))
+			}
+			epoch, ok := body[tt.epochKey].(float64)
+			if ok != tt.wantEpoch {
+				t.Fatalf("handler returned %v = %v, want present %v", tt.epochKey, body[tt.epochKey], tt.wantEpoch)
+			}
+			if ok && int64(epoch) != parsed.Unix() {
+				t.Errorf("handler returned %v = %v, want %v matching %v", tt.epochKey, int64(epoch), parsed.Unix(), tt.timeKey)
+			}
+		})
+	}
+}
+
+// TestGetShortenedURLCancelled tests that a cancelled request is neither looked up nor redirected.
+func TestGetShortenedURLCancelled(t *testing.T) {
+	tests := []struct {
+		name         string
+		cancelBefore bool
+		expectLookup bool
+	}{
+		{"cancelled before the lookup", true, false},
+		{"cancelled during the lookup", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelBefore {
+				cancel()
+			}
+
+			lookedUp := false
+			mockService := &MockURLService{
+				GetLongURLFunc: func(shortURL string) (string, error) {
+					lookedUp = true
+					cancel()
+					return "http://example.com", nil
+				},
+			}
+			handler := NewShortenedURLHandler(mockService)
+
+			req, err := http.NewRequestWithContext(ctx, "GET", "/"+types.APIVersion+"/shorten/abc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.GetShortenedURL(rr, req)
+
+			if lookedUp != tt.expectLookup {
+				t.Errorf("GetLongURL called = %v, want %v", lookedUp, tt.expectLookup)
+			}
+			if location := rr.Header().Get("Location"); location != "" || rr.Body.Len() != 0 {
+				t.Errorf("handler wrote a response for a cancelled request: Location %q, body %q", location, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestCreateShortenedURLIfNoneMatch tests conditional creation of an alias with If-None-Match: *.
+func TestCreateShortenedURLIfNoneMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		exists         bool
+		expectedStatus int
+	}{
+		{"absent alias", false, http.StatusCreated},
+		{"present alias", true, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockURLService{
+				CreateAliasedURLFunc: func(shortURL, longURL string) (string, error) {
+					if tt.exists {
+						conflict := types.NewConflictError(shortURL)
+						return "", types.NewAppError("Conflict", "Short URL already exists", http.StatusConflict, conflict)
+					}
+					return shortURL, nil
+				},
+			}
+			handler := NewShortenedURLHandler(mockService)
+
+			payload := strings.NewReader(`{"shortURL": "my-link", "longURL": "http://example.com"}`)
+			req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten", payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("If-None-Match", "*")
+
+			rr := httptest.NewRecorder()
+			handler.CreateShortenedURL(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+// TestCreateShortenedURLRecordsClientIP tests that the create handler records the client IP from the request context.
+func TestCreateShortenedURLRecordsClientIP(t *testing.T) {
+	var recorded string
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			return "abc", nil
+		},
+		RecordCreatorFunc: func(shortURL, ip string) error {
+			recorded = ip
+			return nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	payload := strings.NewReader(`{"longURL": "http://example.com"}`)
+	req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "203.0.113.7:1234"
+
+	rr := httptest.NewRecorder()
+	middleware.ClientIPMiddleware(nil)(http.HandlerFunc(handler.CreateShortenedURL)).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusCreated)
+	}
+	if recorded != "203.0.113.7" {
+		t.Errorf("RecordCreator() ip = %v, want 203.0.113.7", recorded)
+	}
+}
+
+// TestAdminGetCreator tests that the admin creator endpoint requires the admin token.
+func TestAdminGetCreator(t *testing.T) {
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockService := &MockURLService{
+		GetCreatorFunc: func(shortURL string) (types.Creator, error) {
+			return types.Creator{IP: "203.0.113.7", CreatedAt: createdAt}, nil
+		},
+	}
+	handler := NewAdminHandler(mockService, "secret")
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"valid token", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/"+types.APIVersion+"/creators/abc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.GetCreator(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			expected := `{"shortURL":"abc","ip":"203.0.113.7","createdAt":"2025-01-02T03:04:05Z"}`
+			if body := strings.TrimSpace(rr.Body.String()); body != expected {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					body, expected)
+			}
+		})
+	}
+}
+
+// TestAdminUI tests that the admin UI challenges for basic auth and is served with the admin token.
+func TestAdminUI(t *testing.T) {
+	handler := NewAdminHandler(&MockURLService{}, "secret")
+
+	tests := []struct {
+		name           string
+		authorization  func(r *http.Request)
+		expectedStatus int
+	}{
+		{"missing token", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, http.StatusUnauthorized},
+		{"basic auth", func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK},
+		{"bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.authorization(req)
+
+			rr := httptest.NewRecorder()
+			handler.AdminUI(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if challenge := rr.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "Basic ") {
+					t.Errorf("handler returned wrong WWW-Authenticate header: got %q", challenge)
+				}
+				return
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+				t.Errorf("handler returned wrong content type: got %v", contentType)
+			}
+			if !strings.Contains(rr.Body.String(), "/admin/v1/urls") {
+				t.Error("handler returned a page that does not use the admin API")
+			}
+		})
+	}
+}
+
+// TestAdminFetchURL tests that the fetch proxy requires the admin token, sandboxes the streamed response
+// and aborts a response exceeding the size limit instead of ending it as if complete.
+func TestAdminFetchURL(t *testing.T) {
+	mockService := &MockURLService{
+		FetchLongURLFunc: func(ctx context.Context, shortURL string) (*http.Response, error) {
+			switch shortURL {
+			case "page":
+				return &http.Response{
+					StatusCode:    http.StatusOK,
+					Header:        http.Header{"Content-Type": {"text/html"}},
+					Body:          io.NopCloser(strings.NewReader("<p>Hello</p>")),
+					ContentLength: -1,
+				}, nil
+			case "large":
+				return &http.Response{
+					StatusCode:    http.StatusOK,
+					Header:        http.Header{"Content-Type": {"text/plain"}},
+					Body:          io.NopCloser(io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(service.ErrFetchTooLarge))),
+					ContentLength: -1,
+				}, nil
+			}
+			return nil, types.NewAppError("Not Found", "Service failed to get URL record", http.StatusNotFound, nil)
+		},
+	}
+	mux := http.NewServeMux()
+	RegisterAPIRoutesWithMiddleware(mux, mockService)
+	RegisterAdminRoutes(mux, "secret", false).SetServiceURL(mockService)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		shortURL       string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"unauthorized", "page", "", http.StatusUnauthorized, ""},
+		{"authorized", "page", "secret", http.StatusOK, "<p>Hello</p>"},
+		{"not found", "missing", "secret", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", server.URL+"/"+types.APIVersion+"/shorten/"+tt.shortURL+"/fetch", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if status := resp.StatusCode; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if tt.expectedBody == "" {
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					string(body), tt.expectedBody)
+			}
+			if csp := resp.Header.Get("Content-Security-Policy"); csp != "sandbox" {
+				t.Errorf("handler returned wrong Content-Security-Policy header: got %v want sandbox", csp)
+			}
+		})
+	}
+
+	req, err := http.NewRequest("GET", server.URL+"/"+types.APIVersion+"/shorten/large/fetch", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	// Depending on buffering, the connection is aborted before or after the headers are sent
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+	}
+	if err == nil {
+		t.Error("reading an oversized proxied response succeeded, want the connection aborted")
+	}
+}
+
+// TestAdminLookupURL tests that the lookup by long URL requires the admin token and returns the existing short URLs or 404,
+// with camelCase or snake_case keys.
+func TestAdminLookupURL(t *testing.T) {
+	defer utils.SetJSONCasing("camel")
+
+	mockService := &MockURLService{
+		LookupLongURLFunc: func(longURL string) ([]string, error) {
+			if longURL == "http://example.com/known" {
+				return []string{"abc"}, nil
+			}
+			return nil, types.NewNotFoundAppError("No short URL for long URL", nil)
+		},
+	}
+	mux := http.NewServeMux()
+	RegisterAPIRoutesWithMiddleware(mux, mockService)
+	RegisterAdminRoutes(mux, "secret", false).SetServiceURL(mockService)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		query          string
+		token          string
+		casing         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"unauthorized", "?url=http://example.com/known", "", "camel", http.StatusUnauthorized, ""},
+		{"found", "?url=http://example.com/known", "secret", "camel", http.StatusOK, `{"longURL":"http://example.com/known","shortURLs":["abc"]}`},
+		{"found snake_case", "?url=http://example.com/known", "secret", "snake", http.StatusOK, `{"long_url":"http://example.com/known","short_urls":["abc"]}`},
+		{"not found", "?url=http://example.com/unknown", "secret", "camel", http.StatusNotFound, ""},
+		{"missing url", "", "secret", "camel", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := utils.SetJSONCasing(tt.casing); err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest("GET", server.URL+"/admin/"+types.APIVersion+"/lookup"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if status := resp.StatusCode; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if tt.expectedBody == "" {
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if strings.TrimSpace(string(body)) != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					string(body), tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestAdminEvents tests that a creation is streamed as a server-sent event to a connected admin client.
+func TestAdminEvents(t *testing.T) {
+	broker := service.NewEventBroker()
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			broker.Publish(types.Event{Type: types.EventCreated, ShortURL: "jR", LongURL: longURL})
+			return "jR", nil
+		},
+		SubscribeEventsFunc: broker.Subscribe,
+	}
+	mux := http.NewServeMux()
+	RegisterAdminRoutes(mux, "secret", false).SetServiceURL(mockService)
+	// The stream is exempt from the timeouts, which buffer responses
+	var root http.Handler = middleware.TimeoutMiddleware(100*time.Millisecond, AdminEventsPath)(mux)
+	root = middleware.ClientTimeoutMiddleware(100*time.Millisecond, AdminEventsPath)(root)
+	server := httptest.NewServer(root)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/admin/"+types.APIVersion+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(middleware.RequestTimeoutHeader, "50")
+
+	unauthorized, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unauthorized.Body.Close()
+	if status := unauthorized.StatusCode; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusUnauthorized)
+	}
+
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("handler returned wrong content type: got %v want text/event-stream", contentType)
+	}
+
+	handler := NewShortenedURLHandler(mockService)
+	rr := httptest.NewRecorder()
+	handler.CreateShortenedURL(rr, httptest.NewRequest("POST", "/v1/shorten", strings.NewReader(`{"longURL":"http://example.com"}`)))
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v",
+			status, http.StatusCreated)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	var lines []string
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	expected := []string{"event: created", `data: {"type":"created","shortURL":"jR","longURL":"http://example.com","time":"0001-01-01T00:00:00Z"}`}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("handler streamed unexpected event: got %q want %q", lines, expected)
+	}
+}
+
+// TestAdminListURLs tests the pagination envelope and Link header of the admin list endpoint across pages.
+func TestAdminListURLs(t *testing.T) {
+	entries := []types.URLEntry{
+		{ShortURL: "a", LongURL: "http://example.com/a"},
+		{ShortURL: "b", LongURL: "http://example.com/b"},
+		{ShortURL: "c", LongURL: "http://example.com/c"},
+		{ShortURL: "d", LongURL: "http://example.com/d"},
+		{ShortURL: "e", LongURL: "http://example.com/e"},
+	}
+	mockService := &MockURLService{
+		ListURLsFunc: func(limit, offset int) ([]types.URLEntry, int, error) {
+			offset = min(offset, len(entries))
+			return entries[offset:min(offset+limit, len(entries))], len(entries), nil
+		},
+	}
+	handler := NewAdminHandler(mockService, "secret")
+	path := "/admin/" + types.APIVersion + "/urls"
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedBody string
+		expectedLink string
+	}{
+		{
+			"first page",
+			"?limit=2",
+			`{"data":[{"shortURL":"a","longURL":"http://example.com/a"},{"shortURL":"b","longURL":"http://example.com/b"}],"total":5,"limit":2,"offset":0,"nextOffset":2}`,
+			`<` + path + `?limit=2&offset=2>; rel="next"`,
+		},
+		{
+			"middle page",
+			"?limit=2&offset=2",
+			`{"data":[{"shortURL":"c","longURL":"http://example.com/c"},{"shortURL":"d","longURL":"http://example.com/d"}],"total":5,"limit":2,"offset":2,"nextOffset":4}`,
+			`<` + path + `?limit=2&offset=4>; rel="next", <` + path + `?limit=2&offset=0>; rel="prev"`,
+		},
+		{
+			"last page",
+			"?limit=2&offset=4",
+			`{"data":[{"shortURL":"e","longURL":"http://example.com/e"}],"total":5,"limit":2,"offset":4,"nextOffset":null}`,
+			`<` + path + `?limit=2&offset=2>; rel="prev"`,
+		},
+		{
+			"single page",
+			"",
+			`{"data":[{"shortURL":"a","longURL":"http://example.com/a"},{"shortURL":"b","longURL":"http://example.com/b"},{"shortURL":"c","longURL":"http://example.com/c"},{"shortURL":"d","longURL":"http://example.com/d"},{"shortURL":"e","longURL":"http://example.com/e"}],"total":5,"limit":20,"offset":0,"nextOffset":null}`,
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", path+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer secret")
+
+			rr := httptest.NewRecorder()
+			handler.ListURLs(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, http.StatusOK)
+			}
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					body, tt.expectedBody)
+			}
+			if link := rr.Header().Get("Link"); link != tt.expectedLink {
+				t.Errorf("handler returned wrong Link header: got %v want %v",
+					link, tt.expectedLink)
+			}
+		})
+	}
+
+	// A non-integer limit is rejected before reaching the service
+	req, err := http.NewRequest("GET", path+"?limit=ten", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler.ListURLs(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusBadRequest)
+	}
+}
+
+// TestAdminListURLsAfter tests the cursor pagination envelope and Link header of the admin list endpoint.
+func TestAdminListURLsAfter(t *testing.T) {
+	entries := []types.URLEntry{
+		{ShortURL: "a", LongURL: "http://example.com/a"},
+		{ShortURL: "b", LongURL: "http://example.com/b"},
+		{ShortURL: "c", LongURL: "http://example.com/c"},
+	}
+	mockService := &MockURLService{
+		ListURLsAfterFunc: func(after string, limit int) ([]types.URLEntry, string, error) {
+			start := 0
+			for start < len(entries) && entries[start].ShortURL <= after {
+				start++
+			}
+			page := entries[start:min(start+limit, len(entries))]
+			if start+limit < len(entries) {
+				return page, page[len(page)-1].ShortURL, nil
+			}
+			return page, "", nil
+		},
+	}
+	handler := NewAdminHandler(mockService, "secret")
+	path := "/admin/" + types.APIVersion + "/urls"
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedBody string
+		expectedLink string
+	}{
+		{
+			"first page",
+			"?limit=2&after=",
+			`{"data":[{"shortURL":"a","longURL":"http://example.com/a"},{"shortURL":"b","longURL":"http://example.com/b"}],"limit":2,"after":"","nextCursor":"b"}`,
+			`<` + path + `?limit=2&after=b>; rel="next"`,
+		},
+		{
+			"last page",
+			"?limit=2&after=b",
+			`{"data":[{"shortURL":"c","longURL":"http://example.com/c"}],"limit":2,"after":"b","nextCursor":null}`,
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", path+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer secret")
+
+			rr := httptest.NewRecorder()
+			handler.ListURLs(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, http.StatusOK)
+			}
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					body, tt.expectedBody)
+			}
+			if link := rr.Header().Get("Link"); link != tt.expectedLink {
+				t.Errorf("handler returned wrong Link header: got %v want %v",
+					link, tt.expectedLink)
+			}
+		})
+	}
+}
+
+// TestAdminExport tests that exports in both formats are capped at the maximum rows and continue by cursor.
+func TestAdminExport(t *testing.T) {
+	entries := []types.URLEntry{
+		{ShortURL: "a", LongURL: "http://example.com/a"},
+		{ShortURL: "b", LongURL: "http://example.com/b,c"},
+		{ShortURL: "c", LongURL: "http://example.com/c"},
+	}
+	mockService := &MockURLService{
+		ListURLsAfterFunc: func(after string, limit int) ([]types.URLEntry, string, error) {
+			start := 0
+			for start < len(entries) && entries[start].ShortURL <= after {
+				start++
+			}
+			page := entries[start:min(start+limit, len(entries))]
+			if start+limit < len(entries) {
+				return page, page[len(page)-1].ShortURL, nil
+			}
+			return page, "", nil
+		},
+	}
+	handler := NewAdminHandler(mockService, "secret")
+	handler.SetExportMaxRows(2)
+	path := "/admin/" + types.APIVersion + "/export"
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+		expectedCursor string
+	}{
+		{
+			"jsonl first response",
+			"",
+			http.StatusOK,
+			`{"shortURL":"a","longURL":"http://example.com/a"}` + "\n" + `{"shortURL":"b","longURL":"http://example.com/b,c"}` + "\n",
+			"b",
+		},
+		{
+			"jsonl continuation",
+			"?after=b",
+			http.StatusOK,
+			`{"shortURL":"c","longURL":"http://example.com/c"}` + "\n",
+			"",
+		},
+		{
+			"csv first response",
+			"?format=csv",
+			http.StatusOK,
+			"shortURL,longURL\na,http://example.com/a\nb,\"http://example.com/b,c\"\n",
+			"b",
+		},
+		{
+			"csv continuation",
+			"?format=csv&after=b",
+			http.StatusOK,
+			"shortURL,longURL\nc,http://example.com/c\n",
+			"",
+		},
+		{"invalid format", "?format=xml", http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", path+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer secret")
+
+			rr := httptest.NewRecorder()
+			handler.Export(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if body := rr.Body.String(); body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q",
+					body, tt.expectedBody)
+			}
+			if cursor := rr.Header().Get("X-Next-Cursor"); cursor != tt.expectedCursor {
+				t.Errorf("handler returned wrong X-Next-Cursor header: got %v want %v",
+					cursor, tt.expectedCursor)
+			}
+		})
+	}
+
+	// Test case: Exports larger than a list page are collected across pages up to the maximum
+	handler.SetExportMaxRows(1000)
+	pages := 0
+	entries = nil
+	for i := 0; i < 250; i++ {
+		entries = append(entries, types.URLEntry{ShortURL: fmt.Sprintf("%03d", i), LongURL: "http://example.com"})
+	}
+	countingService := &MockURLService{
+		ListURLsAfterFunc: func(after string, limit int) ([]types.URLEntry, string, error) {
+			pages++
+			return mockService.ListURLsAfterFunc(after, limit)
+		},
+	}
+	handler.SetServiceURL(countingService)
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler.Export(rr, req)
+	if lines := strings.Count(rr.Body.String(), "\n"); lines != 250 {
+		t.Errorf("handler exported %v rows, want 250", lines)
+	}
+	if pages != 3 {
+		t.Errorf("handler listed %v pages, want 3", pages)
+	}
+	if cursor := rr.Header().Get("X-Next-Cursor"); cursor != "" {
+		t.Errorf("handler returned unexpected X-Next-Cursor header: %v", cursor)
+	}
+}
+
+// TestGetShortenedURLCacheControl tests that the redirect Cache-Control header is configurable.
+func TestGetShortenedURLCacheControl(t *testing.T) {
+	mockService := &MockURLService{
+		GetLongURLFunc: func(shortURL string) (string, error) {
+			return "http://example.com", nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"default", "", ""},
+		{"configured", "public, max-age=3600", "public, max-age=3600"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetRedirectCacheControl(tt.value)
+			defer SetRedirectCacheControl("")
+
+			req, err := http.NewRequest("GET", "/"+types.APIVersion+"/shorten/abc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.GetShortenedURL(rr, req)
+
+			if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != tt.expected {
+				t.Errorf("handler returned wrong Cache-Control header: got %v want %v",
+					cacheControl, tt.expected)
+			}
+		})
+	}
+}
+
+// TestGetShortenedURLInterstitial tests the direct redirect and the interstitial page modes.
+func TestGetShortenedURLInterstitial(t *testing.T) {
+	tests := []struct {
+		name           string
+		longURL        string
+		delay          int
+		expectedStatus int
+		expectedBody   []string
+		unexpectedBody []string
+	}{
+		{"direct redirect", "http://example.com/?a=1&b=2", 0, http.StatusMovedPermanently, nil, nil},
+		{
+			"interstitial", "http://example.com/?a=1&b=2", 5, http.StatusOK,
+			[]string{`<a href="http://example.com/?a=1&amp;b=2">`, `var destination = "http://example.com/?a=1\u0026b=2";`, `var remaining =  5 ;`},
+			[]string{`http-equiv="refresh"`},
+		},
+		{
+			"quotes escaped", `http://example.com/";alert(1);//`, 5, http.StatusOK,
+			[]string{`var destination = "http://example.com/\";alert(1);//";`},
+			[]string{`"http://example.com/";`},
+		},
+		{
+			"non-http destination not redirected", "javascript:alert(1)", 5, http.StatusOK,
+			[]string{"You are being redirected to"},
+			[]string{"<script>", "alert(1)\">"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewShortenedURLHandler(&MockURLService{
+				GetLongURLFunc: func(shortURL string) (string, error) {
+					return tt.longURL, nil
+				},
+			})
+			handler.SetInterstitialDelay(tt.delay)
+
+			req, err := http.NewRequest("GET", "/"+types.APIVersion+"/shorten/abc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.GetShortenedURL(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("handler returned unexpected body: got %v want %v",
+						rr.Body.String(), expected)
+				}
+			}
+			for _, unexpected := range tt.unexpectedBody {
+				if strings.Contains(rr.Body.String(), unexpected) {
+					t.Errorf("handler returned body containing %v: got %v", unexpected, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// TestGetShortenedURLNoIndex tests that redirects and interstitial pages carry X-Robots-Tag: noindex when enabled.
+func TestGetShortenedURLNoIndex(t *testing.T) {
+	mockService := &MockURLService{
+		GetLongURLFunc: func(shortURL string) (string, error) {
+			return "http://example.com", nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	tests := []struct {
+		name     string
+		noIndex  bool
+		delay    int
+		expected string
+	}{
+		{"redirect", true, 0, "noindex"},
+		{"interstitial", true, 5, "noindex"},
+		{"disabled", false, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetNoIndex(tt.noIndex)
+			handler.SetInterstitialDelay(tt.delay)
+			defer SetNoIndex(false)
+
+			req, err := http.NewRequest("GET", "/"+types.APIVersion+"/shorten/abc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.GetShortenedURL(rr, req)
+
+			if robotsTag := rr.Header().Get("X-Robots-Tag"); robotsTag != tt.expected {
+				t.Errorf("handler returned wrong X-Robots-Tag header: got %v want %v",
+					robotsTag, tt.expected)
+			}
+		})
+	}
+}
+
+// TestShortenedURLStats tests the ShortenedURLStats handler function.
+func TestShortenedURLStats(t *testing.T) {
+	mockService := &MockURLService{
+		GetHitsFunc: func(shortURLs []string) (map[string]uint64, error) {
+			return map[string]uint64{"abc": 3}, nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	payload := strings.NewReader(`{"shortURLs": ["abc", "missing"]}`)
+	req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten/stats", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ShortenedURLStats(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	expected := `{"abc":3}`
+	if body := strings.TrimSpace(rr.Body.String()); body != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v",
+			body, expected)
+	}
+}
+
+// TestCreateShortenedURLLegacyPayload tests that both the current and the legacy PascalCase payload keys decode,
+// and that only the legacy keys log a deprecation warning.
+func TestCreateShortenedURLLegacyPayload(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantWarning bool
+	}{
+		{"camelCase", `{"longURL": "http://example.com"}`, false},
+		{"PascalCase", `{"LongURL": "http://example.com"}`, true},
+		{"camelCase takes precedence", `{"longURL": "http://example.com", "LongURL": "http://example.org"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			defaultLogger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+			defer slog.SetDefault(defaultLogger)
+
+			var received string
+			mockService := &MockURLService{
+				CreateShortenedURLFunc: func(longURL string) (string, error) {
+					received = longURL
+					return "abc", nil
+				},
+			}
+			handler := NewShortenedURLHandler(mockService)
+
+			req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten", strings.NewReader(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.CreateShortenedURL(rr, req)
+
+			if status := rr.Code; status != http.StatusCreated {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, http.StatusCreated)
+			}
+			if received != "http://example.com" {
+				t.Errorf("CreateShortenedURL() longURL = %v, want %v", received, "http://example.com")
+			}
+			if warned := strings.Contains(buf.String(), "Deprecated PascalCase payload keys"); warned != tt.wantWarning {
+				t.Errorf("deprecation warning logged = %v, want %v, logs: %v", warned, tt.wantWarning, buf.String())
+			}
+		})
+	}
+}
+
+// TestGetShortenedURLRedirectStatus tests that the configured redirect status is used and 308 preserves POST.
+func TestGetShortenedURLRedirectStatus(t *testing.T) {
+	mockService := &MockURLService{
+		GetLongURLFunc: func(shortURL string) (string, error) {
+			return "http://example.com/api", nil
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	tests := []struct {
+		name           string
+		status         int
+		method         string
+		expectedStatus int
+	}{
+		{"default GET", http.StatusMovedPermanently, "GET", http.StatusMovedPermanently},
+		{"308 GET", http.StatusPermanentRedirect, "GET", http.StatusPermanentRedirect},
+		{"308 POST", http.StatusPermanentRedirect, "POST", http.StatusPermanentRedirect},
+		{"301 POST", http.StatusMovedPermanently, "POST", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetRedirectStatus(tt.status); err != nil {
+				t.Fatal(err)
+			}
+			defer SetRedirectStatus(http.StatusMovedPermanently)
+
+			req, err := http.NewRequest(tt.method, "/"+types.APIVersion+"/shorten/abc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ShortenedURLResource(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if tt.expectedStatus != http.StatusMethodNotAllowed {
+				if location := rr.Header().Get("Location"); location != "http://example.com/api" {
+					t.Errorf("handler returned wrong Location header: got %v want %v",
+						location, "http://example.com/api")
+				}
+			}
+		})
+	}
+
+	if err := SetRedirectStatus(http.StatusOK); err == nil {
+		t.Error("Expected an error for a non-redirect status, but got nil")
+	}
+}
+
+// TestCreateShortenedURLDebugCounters tests that the counters are only included in the create response in debug mode.
+func TestCreateShortenedURLDebugCounters(t *testing.T) {
+	mockService := &MockURLService{
+		CreateShortenedURLFunc: func(longURL string) (string, error) {
+			return "abc", nil
+		},
+		DecodeCountersFunc: func(shortURL string) []uint64 {
+			return []uint64{1, 2}
+		},
+	}
+	handler := NewShortenedURLHandler(mockService)
+
+	tests := []struct {
+		name     string
+		debug    bool
+		expected string
+	}{
+		{"debug disabled", false, `{"shortURL":"abc"}`},
+		{"debug enabled", true, `{"shortURL":"abc","counters":[1,2]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDebug(tt.debug)
+			defer SetDebug(false)
+
+			payload := strings.NewReader(`{"longURL": "http://example.com"}`)
+			req, err := http.NewRequest("POST", "/"+types.APIVersion+"/shorten", payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.CreateShortenedURL(rr, req)
+
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expected {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					body, tt.expected)
+			}
+		})
+	}
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/database"
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
+)
+
+// HealthHandler serves the liveness and readiness probes.
+// The database is set once the connection has been established, until then readyz reports 503.
+type HealthHandler struct {
+	mu        sync.RWMutex
+	db        database.HealthChecker
+	deepCheck bool          // Perform a write/read round trip instead of just a ping
+	cacheTTL  time.Duration // How long a check result is served before the database is checked again
+
+	checkMu   sync.Mutex // Serializes checks, so concurrent probes check the database once
+	checkedAt time.Time
+	checkErr  *types.AppError
+	now       func() time.Time
+}
+
+// NewHealthHandler creates a new instance of HealthHandler.
+// If deepCheck is true, readyz confirms the database accepts writes, which is more expensive than a ping.
+// The result of a check is served for cacheTTL, so frequent probes don't load the database, 0 checks on every probe.
+func NewHealthHandler(db database.HealthChecker, deepCheck bool, cacheTTL time.Duration) *HealthHandler {
+	return &HealthHandler{
+		db:        db,
+		deepCheck: deepCheck,
+		cacheTTL:  cacheTTL,
+		now:       time.Now,
+	}
+}
+
+// SetDatabase sets the database checked by the readiness probe and drops any cached result.
+func (h *HealthHandler) SetDatabase(db database.HealthChecker) {
+	h.mu.Lock()
+	h.db = db
+	h.mu.Unlock()
+
+	h.checkMu.Lock()
+	h.checkedAt = time.Time{}
+	h.checkMu.Unlock()
+}
+
+// Healthz reports that the process is alive.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	utils.JSONResponse(w, http.StatusOK, map[string]string{
+		"status": "ok",
+	})
+}
+
+// Readyz reports whether the service is ready to handle traffic.
+// It returns 503 if the database is not connected, does not answer a ping,
+// or (with the deep check enabled) does not accept writes.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	db := h.db
+	h.mu.RUnlock()
+
+	if db == nil {
+		utils.HandleError(w, types.NewUnavailableError("Database is not ready", nil))
+		return
+	}
+
+	if err := h.cachedCheck(db); err != nil {
+		utils.HandleError(w, err)
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]string{
+		"status": "ready",
+	})
+}
+
+// cachedCheck returns the result of the last check if it is younger than the cache TTL,
+// otherwise it checks the database and caches the result.
+func (h *HealthHandler) cachedCheck(db database.HealthChecker) *types.AppError {
+	h.checkMu.Lock()
+	defer h.checkMu.Unlock()
+
+	now := h.now()
+	if h.cacheTTL > 0 && !h.checkedAt.IsZero() && now.Sub(h.checkedAt) < h.cacheTTL {
+		return h.checkErr
+	}
+	h.checkErr = h.check(db)
+	h.checkedAt = now
+	return h.checkErr
+}
+
+// check pings the database and, with the deep check enabled, confirms it accepts writes.
+func (h *HealthHandler) check(db database.HealthChecker) *types.AppError {
+	if err := db.Ping(); err != nil {
+		return types.NewUnavailableError("Database failed to ping", err)
+	}
+
+	if h.deepCheck {
+		if err := db.CheckWrite(); err != nil {
+			return types.NewUnavailableError("Database failed write check", err)
+		}
+	}
+	return nil
+}
+
+// RegisterHealthRoutes registers the liveness and readiness probes, caching readiness results for cacheTTL.
+// The returned handler is used to set the database once it has connected.
+func RegisterHealthRoutes(mux *http.ServeMux, deepCheck bool, cacheTTL time.Duration) *HealthHandler {
+	healthHandler := NewHealthHandler(nil, deepCheck, cacheTTL)
+
+	mux.HandleFunc("/healthz", healthHandler.Healthz)
+	mux.HandleFunc("/readyz", healthHandler.Readyz)
+
+	return healthHandler
+}
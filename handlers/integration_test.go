@@ -5,12 +5,15 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/pizza-nz/url-shortener/config"
 	"github.com/pizza-nz/url-shortener/database"
 	"github.com/pizza-nz/url-shortener/service"
@@ -30,7 +33,7 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		panic(err)
 	}
-	db, err = database.StartNewDatabase(cfg.ConnectionString(), cfg.RedactedConnectionString())
+	db, err = database.StartNewDatabase(cfg)
 	if err != nil {
 		panic(err)
 	}
@@ -42,7 +45,7 @@ func TestMain(m *testing.M) {
 }
 
 func TestCreateShortenedURLIntegration(t *testing.T) {
-	urlService := service.NewURLService(db)
+	urlService := service.NewURLService(db, nil)
 
 	mux := http.NewServeMux()
 	RegisterAPIRoutesWithMiddleware(mux, urlService)
@@ -52,7 +55,7 @@ func TestCreateShortenedURLIntegration(t *testing.T) {
 
 	// Test case 1: Valid request
 	payload := map[string]string{"longURL": "http://example.com"}
-		jsonPayload, _ := json.Marshal(payload)
+	jsonPayload, _ := json.Marshal(payload)
 	req, _ := http.NewRequest("POST", server.URL+"/"+types.APIVersion+"/shorten", bytes.NewBuffer(jsonPayload))
 	req.Header.Set("Content-Type", "application/json")
 
@@ -89,3 +92,133 @@ func TestCreateShortenedURLIntegration(t *testing.T) {
 			resp.StatusCode, http.StatusMovedPermanently)
 	}
 }
+
+func TestShortenedURLStatsIntegration(t *testing.T) {
+	urlService := service.NewURLService(db, nil)
+
+	mux := http.NewServeMux()
+	RegisterAPIRoutesWithMiddleware(mux, urlService)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	shortURL, err := urlService.CreateShortenedURL("http://example.com/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := urlService.GetLongURL(shortURL); err != nil {
+		t.Fatal(err)
+	}
+
+	// Test case 1: One existing and one missing short URL in a single query
+	payload := map[string][]string{"shortURLs": {shortURL, "missing"}}
+	jsonPayload, _ := json.Marshal(payload)
+	resp, err := http.Post(server.URL+"/"+types.APIVersion+"/shorten/stats", "application/json", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			resp.StatusCode, http.StatusOK)
+	}
+
+	var hits map[string]uint64
+	json.NewDecoder(resp.Body).Decode(&hits)
+	if len(hits) != 1 || hits[shortURL] != 1 {
+		t.Errorf("handler returned unexpected hits: got %v want map[%v:1]", hits, shortURL)
+	}
+}
+
+func TestConcurrentAliasIntegration(t *testing.T) {
+	urlService := service.NewURLService(db, nil)
+
+	mux := http.NewServeMux()
+	RegisterAPIRoutesWithMiddleware(mux, urlService)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Two creations race for the same alias, exactly one may win
+	alias := "race-" + uuid.NewString()[:8]
+	statuses := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := map[string]string{"longURL": fmt.Sprintf("http://example.com/%d", i), "shortURL": alias}
+			jsonPayload, _ := json.Marshal(payload)
+			resp, err := http.Post(server.URL+"/"+types.APIVersion+"/shorten", "application/json", bytes.NewBuffer(jsonPayload))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}(i)
+	}
+	wg.Wait()
+
+	created, conflicts := 0, 0
+	for _, status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		}
+	}
+	if created != 1 || conflicts != 1 {
+		t.Errorf("handler returned wrong status codes: got %v want one %v and one %v",
+			statuses, http.StatusCreated, http.StatusConflict)
+	}
+}
+
+func TestCounterBlocksAcrossInstancesIntegration(t *testing.T) {
+	// A second connection pool stands in for another instance sharing the database
+	other, err := database.StartNewDatabase(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	const blockSize, blocks = 10, 20
+	instances := []database.Database{db, other}
+	allocated := make([][]uint64, len(instances))
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		counter, ok := instance.(database.BlockCounterDatabase)
+		if !ok {
+			t.Skip("database does not allocate counter blocks")
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for range blocks {
+				values, err := counter.GetAndIncreamentBy(blockSize)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(values) != blockSize {
+					t.Errorf("GetAndIncreamentBy() allocated %v values, want %v", len(values), blockSize)
+				}
+				allocated[i] = append(allocated[i], values...)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every counter value belongs to exactly one block of one instance
+	claimed := map[uint64]int{}
+	for i, values := range allocated {
+		for _, value := range values {
+			if owner, ok := claimed[value]; ok {
+				t.Fatalf("counter value %v allocated to instance %v and %v", value, owner, i)
+			}
+			claimed[value] = i
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// interstitialTemplate is the page showing the destination with a countdown before redirecting.
+// The destination is only ever written through html/template, as an escaped link and a JS string,
+// never into a meta refresh. Without JavaScript the page stays and the link is followed by hand.
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Redirecting</title>
+</head>
+<body>
+<p>You are being redirected to <a href="{{.LongURL}}">{{.LongURL}}</a>{{if .Redirect}} in <span id="countdown">{{.Delay}}</span> seconds{{end}}.</p>
+{{if .Redirect}}<script>
+var destination = {{.LongURL}};
+var remaining = {{.Delay}};
+setInterval(function () {
+	if (remaining > 0) {
+		remaining--;
+		document.getElementById("countdown").textContent = remaining;
+	}
+	if (remaining === 0) {
+		window.location.replace(destination);
+	}
+}, 1000);
+</script>
+{{end}}</body>
+</html>
+`))
+
+// SetInterstitialDelay sets the number of seconds the interstitial page is shown before redirecting.
+// 0 disables the interstitial page and redirects immediately, which is the default.
+func (h *ShortenedURLHandlerImpl) SetInterstitialDelay(seconds int) {
+	h.interstitialDelay = seconds
+}
+
+// writeInterstitial serves the interstitial page for longURL, redirecting after delay seconds.
+// Only http and https destinations are redirected to by script, anything else is just shown.
+func writeInterstitial(w http.ResponseWriter, longURL string, delay int) {
+	u, err := url.Parse(longURL)
+	redirect := err == nil && (u.Scheme == "http" || u.Scheme == "https")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	err = interstitialTemplate.Execute(w, struct {
+		LongURL  string
+		Delay    int
+		Redirect bool
+	}{
+		LongURL:  longURL,
+		Delay:    delay,
+		Redirect: redirect,
+	})
+	if err != nil {
+		slog.Error("Failed to render interstitial page", "error", err, "requestID", w.Header().Get(types.RequestIDHeader))
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pizza-nz/url-shortener/service"
+)
+
+// Metrics writes the application metrics in the Prometheus text exposition format.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintln(w, "# HELP url_shortener_counter_fallbacks_total Number of times the database counter failed and a random number was used.")
+	fmt.Fprintln(w, "# TYPE url_shortener_counter_fallbacks_total counter")
+	fmt.Fprintf(w, "url_shortener_counter_fallbacks_total %d\n", service.CounterFallbacks())
+}
+
+// RegisterMetricsRoutes registers the metrics endpoint.
+func RegisterMetricsRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/metrics", Metrics)
+}
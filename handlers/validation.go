@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
+)
+
+// validationLogger logs the details of validation failures, at most limit per second,
+// so operators can see what invalid input clients send without flooding the logs.
+type validationLogger struct {
+	mu          sync.Mutex
+	limit       int
+	windowStart time.Time
+	count       int
+	now         func() time.Time
+}
+
+// validationLog is the validation logger, nil while validation logging is disabled.
+var validationLog *validationLogger
+
+// SetValidationLogging sets whether validation failures are logged at debug level, at most perSecond per second.
+func SetValidationLogging(enabled bool, perSecond int) {
+	if !enabled {
+		validationLog = nil
+		return
+	}
+	validationLog = &validationLogger{limit: perSecond, now: time.Now}
+}
+
+// allow reports whether another failure may be logged in the current one second window.
+func (l *validationLogger) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !now.Before(l.windowStart.Add(time.Second)) {
+		l.windowStart = now
+		l.count = 0
+	}
+	if l.count >= l.limit {
+		return false
+	}
+	l.count++
+	return true
+}
+
+// logValidationFailure logs each detail of a BadRequestError in err at debug level, if validation logging is enabled.
+// The raw long URL is only logged in debug mode, as it may be sensitive.
+func logValidationFailure(w http.ResponseWriter, r *http.Request, err error, longURL string) {
+	var badRequest *types.BadRequestError
+	if validationLog == nil || !errors.As(err, &badRequest) || !validationLog.allow() {
+		return
+	}
+
+	for _, detail := range badRequest.Details {
+		attrs := []any{"field", detail.Field, "issue", detail.Issue, "path", r.URL.Path, "requestID", w.Header().Get(types.RequestIDHeader)}
+		if debug && longURL != "" {
+			attrs = append(attrs, "longURL", longURL)
+		}
+		slog.DebugContext(r.Context(), "Validation failed", attrs...)
+	}
+}
+
+// handleRequestError logs validation failures of the request and sends the error response.
+// If the request failed on the server side, e.g. storing the long URL, the long URL is logged for troubleshooting.
+func handleRequestError(w http.ResponseWriter, r *http.Request, err error, longURL string) {
+	logValidationFailure(w, r, err, longURL)
+	var appErr *types.AppError
+	if longURL != "" && (!errors.As(err, &appErr) || appErr.HTTPStatus >= http.StatusInternalServerError) {
+		slog.ErrorContext(r.Context(), "Request for long URL failed", "longURL", longURL, "path", r.URL.Path, "requestID", w.Header().Get(types.RequestIDHeader))
+	}
+	utils.HandleError(w, err)
+}
@@ -1,25 +1,134 @@
 package logging
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/pizza-nz/url-shortener/config"
+	"github.com/pizza-nz/url-shortener/types"
 )
 
-// NewLogger creates a new logger that writes to a file.
-func NewLogger(env string) *slog.Logger {
+// NewLogger creates a new logger that writes to a file, honoring the configured level and format.
+// It is meant to be called once at startup; the returned logger can be injected or set as the default.
+func NewLogger(env string, cfg *config.LogConfig) (*slog.Logger, error) {
 	logDir := "logs"
 	if err := os.MkdirAll(logDir, 0755); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	logFile := fmt.Sprintf("%s/%s-%s.log", logDir, time.Now().Format("2006-01-02-15-04-05"), env)
 
 	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	handler, err := newHandler(file, cfg)
+	if err != nil {
+		file.Close()
+		os.Remove(logFile)
+		return nil, err
+	}
+	return slog.New(handler), nil
+}
+
+// newHandler creates a slog.Handler writing to w with the configured level and format.
+func newHandler(w io.Writer, cfg *config.LogConfig) (slog.Handler, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, types.NewConfigError("LOGLEVEL must be one of debug, info, warn or error", err)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.LogFormat) {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, types.NewConfigError("LOGFORMAT must be json or text", nil)
+	}
+
+	switch strings.ToLower(cfg.LogURLs) {
+	case "always", "":
+	case "errors":
+		handler = &errorURLHandler{Handler: handler}
+	default:
+		return nil, types.NewConfigError("LOGURLS must be always or errors", nil)
+	}
+
+	if cfg.LogTraceIDs {
+		handler = &traceHandler{Handler: handler}
+	}
+	return handler, nil
+}
+
+// urlKeys are the attributes carrying long URLs, either directly, in a raw request body
+// or in the query string of a request, e.g. a lookup by long URL.
+// Code logging a long URL uses one of these keys, so LOGURLS=errors covers it.
+var urlKeys = map[string]bool{"longURL": true, "body": true, "query": true}
+
+// errorURLHandler drops long URL attributes from records below warning level, so long URLs are only logged
+// when something went wrong, e.g. a failed write, and not for every successful redirect or creation.
+// Attributes added with Logger.With are passed through, as they apply to records of every level.
+type errorURLHandler struct {
+	slog.Handler
+}
+
+// Handle removes the long URL attributes from records below warning level before passing them on.
+func (h *errorURLHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelWarn {
+		return h.Handler.Handle(ctx, record)
+	}
+
+	filtered := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		if !urlKeys[attr.Key] {
+			filtered.AddAttrs(attr)
+		}
+		return true
+	})
+	return h.Handler.Handle(ctx, filtered)
+}
+
+// WithAttrs returns an errorURLHandler wrapping the handler with the attributes added.
+func (h *errorURLHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &errorURLHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns an errorURLHandler wrapping the handler with the group added.
+func (h *errorURLHandler) WithGroup(name string) slog.Handler {
+	return &errorURLHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// traceHandler adds the trace and span IDs of the SpanContext in the context to every record,
+// correlating the logs of a request with its trace. Records logged without a context, e.g. with slog.Info
+// instead of slog.InfoContext, or outside of a traced request are passed through unchanged.
+type traceHandler struct {
+	slog.Handler
+}
+
+// Handle adds the traceID and spanID attributes to records logged with a SpanContext before passing them on.
+func (h *traceHandler) Handle(ctx context.Context, record slog.Record) error {
+	if span, ok := ctx.Value(types.SpanContextKey).(types.SpanContext); ok {
+		record = record.Clone()
+		record.AddAttrs(slog.String("traceID", span.TraceID), slog.String("spanID", span.SpanID))
 	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs returns a traceHandler wrapping the handler with the attributes added.
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
 
-	return slog.New(slog.NewJSONHandler(file, nil))
+// WithGroup returns a traceHandler wrapping the handler with the group added.
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return &traceHandler{Handler: h.Handler.WithGroup(name)}
 }
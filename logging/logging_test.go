@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pizza-nz/url-shortener/config"
+	"github.com/pizza-nz/url-shortener/database"
+	"github.com/pizza-nz/url-shortener/middleware"
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// TestNewHandlerLevel tests that the configured level filters lower level logs.
+func TestNewHandlerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := newHandler(&buf, &config.LogConfig{LogLevel: "info", LogFormat: "text"})
+	if err != nil {
+		t.Fatalf("newHandler() error = %v, wantErr nil", err)
+	}
+	logger := slog.New(handler)
+
+	logger.Debug("debug message")
+	logger.Info("info message")
+
+	if strings.Contains(buf.String(), "debug message") {
+		t.Errorf("Expected debug logs to be filtered, got %v", buf.String())
+	}
+	if !strings.Contains(buf.String(), "info message") {
+		t.Errorf("Expected info logs to be written, got %v", buf.String())
+	}
+}
+
+// TestNewHandlerInvalidConfig tests that an invalid level or format is rejected.
+func TestNewHandlerInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.LogConfig
+	}{
+		{"invalid level", &config.LogConfig{LogLevel: "verbose", LogFormat: "json"}},
+		{"invalid format", &config.LogConfig{LogLevel: "info", LogFormat: "xml"}},
+		{"invalid url mode", &config.LogConfig{LogLevel: "info", LogFormat: "json", LogURLs: "never"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHandler(&bytes.Buffer{}, tt.cfg); err == nil {
+				t.Error("Expected an error, but got nil")
+			}
+		})
+	}
+}
+
+// TestNewHandlerLogURLs tests that with LOGURLS=errors long URLs are only logged on warnings and errors.
+func TestNewHandlerLogURLs(t *testing.T) {
+	tests := []struct {
+		name        string
+		logURLs     string
+		wantSuccess bool
+	}{
+		{"always", "always", true},
+		{"errors only", "errors", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			handler, err := newHandler(&buf, &config.LogConfig{LogLevel: "info", LogFormat: "text", LogURLs: tt.logURLs})
+			if err != nil {
+				t.Fatalf("newHandler() error = %v, wantErr nil", err)
+			}
+			logger := slog.New(handler)
+
+			logger.Info("Redirecting to long URL", "shortURL", "jR", "longURL", "http://example.com/success")
+			logger.Error("Request for long URL failed", "longURL", "http://example.com/failure")
+
+			if got := strings.Contains(buf.String(), "http://example.com/success"); got != tt.wantSuccess {
+				t.Errorf("Success log contains long URL = %v, want %v: %v", got, tt.wantSuccess, buf.String())
+			}
+			if !strings.Contains(buf.String(), "shortURL=jR") {
+				t.Errorf("Expected other attributes of the success log to be kept, got %v", buf.String())
+			}
+			if !strings.Contains(buf.String(), "http://example.com/failure") {
+				t.Errorf("Expected the long URL in the error log, got %v", buf.String())
+			}
+		})
+	}
+}
+
+// TestNewHandlerLogURLsCallers tests that with LOGURLS=errors the long URLs logged by the map backend
+// and in the query string of the request log are dropped from info logs.
+func TestNewHandlerLogURLsCallers(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := newHandler(&buf, &config.LogConfig{LogLevel: "info", LogFormat: "text", LogURLs: "errors"})
+	if err != nil {
+		t.Fatalf("newHandler() error = %v, wantErr nil", err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(handler))
+
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("abc", "http://example.com/set"); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/v1/lookup?url=http%3A%2F%2Fexample.com%2Fquery", nil)
+	middleware.RequestIDMiddleware(nil)(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+
+	if strings.Contains(buf.String(), "example.com") {
+		t.Errorf("Expected no long URL in info logs, got %v", buf.String())
+	}
+	if !strings.Contains(buf.String(), "key=abc") || !strings.Contains(buf.String(), "path=/admin/v1/lookup") {
+		t.Errorf("Expected the other attributes to be kept, got %v", buf.String())
+	}
+}
+
+// TestNewHandlerTraceIDs tests that with LOGTRACEIDS the trace and span IDs are logged within a span only.
+func TestNewHandlerTraceIDs(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := newHandler(&buf, &config.LogConfig{LogLevel: "info", LogFormat: "json", LogURLs: "errors", LogTraceIDs: true})
+	if err != nil {
+		t.Fatalf("newHandler() error = %v, wantErr nil", err)
+	}
+	logger := slog.New(handler).With("component", "test")
+
+	span := types.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	ctx := context.WithValue(context.Background(), types.SpanContextKey, span)
+	logger.InfoContext(ctx, "within span")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["traceID"] != span.TraceID || record["spanID"] != span.SpanID || record["component"] != "test" {
+		t.Errorf("Expected the trace and span IDs to be logged, got %v", buf.String())
+	}
+
+	buf.Reset()
+	logger.Info("outside span")
+	if strings.Contains(buf.String(), "traceID") {
+		t.Errorf("Expected no trace ID outside of a span, got %v", buf.String())
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
+)
+
+// RequestTimeoutHeader is the header clients use to cap how long they wait, in milliseconds.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// deadlineWriter buffers the response of a handler running under a client deadline,
+// so nothing reaches the client if the deadline passes first.
+type deadlineWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	timedOut bool
+}
+
+// Header returns the buffered header.
+func (d *deadlineWriter) Header() http.Header {
+	return d.header
+}
+
+// WriteHeader records the status code.
+func (d *deadlineWriter) WriteHeader(status int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.status == 0 {
+		d.status = status
+	}
+}
+
+// Write buffers the body, failing once the deadline has passed.
+func (d *deadlineWriter) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	return d.body.Write(b)
+}
+
+// ClientTimeoutMiddleware sets a per-request deadline from the X-Request-Timeout header, clamped to max,
+// and responds with 504 Gateway Timeout if the handler hasn't finished by then.
+// Requests without the header are served unchanged, an invalid value is rejected with 400 Bad Request.
+// A panic of the handler is re-raised on the serving goroutine, where net/http recovers it like any other handler panic.
+// The response is buffered until the handler finishes, so routes with a path starting with one of the exempt prefixes,
+// such as event streams, ignore the header.
+func ClientTimeoutMiddleware(max time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(RequestTimeoutHeader)
+			if value == "" || hasAnyPrefix(r.URL.Path, exempt) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ms, err := strconv.Atoi(value)
+			if err != nil || ms <= 0 {
+				badRequest := types.NewBadRequestError([]types.Details{
+					types.NewDetails(RequestTimeoutHeader, "must be a positive number of milliseconds"),
+				})
+				utils.HandleError(w, types.NewValidationError(badRequest.Error(), badRequest))
+				return
+			}
+			timeout := min(time.Duration(ms)*time.Millisecond, max)
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			// Headers already set, such as the request ID, stay visible to the handler
+			dw := &deadlineWriter{header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				// A panic would crash the process from this goroutine, so it is handed back to the serving goroutine
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(dw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				dw.mu.Lock()
+				defer dw.mu.Unlock()
+				for name, values := range dw.header {
+					w.Header()[name] = values
+				}
+				if dw.status == 0 {
+					dw.status = http.StatusOK
+				}
+				w.WriteHeader(dw.status)
+				w.Write(dw.body.Bytes())
+			case <-ctx.Done():
+				dw.mu.Lock()
+				dw.timedOut = true
+				dw.mu.Unlock()
+				utils.HandleError(w, types.NewAppError("Gateway Timeout", "Request exceeded the client timeout of "+timeout.String(), http.StatusGatewayTimeout, ctx.Err()))
+			}
+		})
+	}
+}
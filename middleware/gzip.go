@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
+)
+
+// DecompressMiddleware decodes request bodies sent with Content-Encoding: gzip, so large batch payloads can be compressed.
+// The decompressed body is capped at maxBytes, reading past it fails with *http.MaxBytesError, guarding against zip bombs.
+// A body that isn't gzip is rejected with 400 Bad Request and other encodings with 415 Unsupported Media Type.
+func DecompressMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			switch encoding {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip", "x-gzip":
+			default:
+				w.Header().Set("Accept-Encoding", "gzip")
+				utils.HandleError(w, types.NewAppError(
+					"Unsupported Content-Encoding "+encoding,
+					"Request body sent with unsupported Content-Encoding "+encoding,
+					http.StatusUnsupportedMediaType,
+					nil,
+				))
+				return
+			}
+
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				badRequest := types.NewBadRequestError([]types.Details{
+					types.NewDetails("body", "is not valid gzip"),
+				})
+				utils.HandleError(w, types.NewValidationError(badRequest.Error(), err))
+				return
+			}
+			defer gz.Close()
+
+			// The handler sees a plain body of unknown length
+			r.Body = http.MaxBytesReader(w, gz, maxBytes)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			next.ServeHTTP(w, r)
+		})
+	}
+}
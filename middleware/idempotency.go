@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
+)
+
+// IdempotencyKeyHeader is the header carrying the client chosen key that makes a creation safely retryable.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyCache stores the responses of creations by client and Idempotency-Key for a TTL,
+// so a retried request replays the original response instead of creating another short URL.
+// Each key also records a fingerprint of its request, so a key reused for a different request is refused,
+// and is claimed while its request is in flight, so a concurrent retry can't create a second short URL.
+// At most maxEntries keys are kept, the least recently used are evicted first.
+// Expired keys are dropped when they are looked up or evicted, so no operation scans the whole cache.
+type IdempotencyCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element // Elements of order holding an *idempotentEntry
+	order      *list.List               // Entries from most to least recently used
+	now        func() time.Time
+}
+
+// idempotentEntry is a claimed Idempotency-Key, its response is nil while the request is in flight.
+type idempotentEntry struct {
+	key         string
+	fingerprint string
+	response    *idempotentResponse
+	expires     time.Time
+}
+
+// idempotentResponse is a recorded response replayed for retries.
+type idempotentResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// NewIdempotencyCache creates a new instance of IdempotencyCache keeping at most maxEntries responses for ttl.
+func NewIdempotencyCache(ttl time.Duration, maxEntries int) *IdempotencyCache {
+	return &IdempotencyCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// begin claims key for the request with fingerprint. It returns the recorded response to replay if there is one,
+// or nil if the request is to be served, and then finish or abandon must be called.
+// A key in flight is refused with 409 Conflict, and a key used for a different request with 422 Unprocessable Entity.
+func (c *IdempotencyCache) begin(key, fingerprint string) (*idempotentResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*idempotentEntry)
+		if now.Before(entry.expires) {
+			c.order.MoveToFront(element)
+			switch {
+			case entry.fingerprint != fingerprint:
+				return nil, types.NewAppError("Idempotency-Key was used for a different request", "Idempotency-Key reused with another request", http.StatusUnprocessableEntity, nil)
+			case entry.response == nil:
+				return nil, types.NewConflictAppError("Request with the same Idempotency-Key is in flight", nil)
+			}
+			return entry.response, nil
+		}
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+
+	c.entries[key] = c.order.PushFront(&idempotentEntry{key: key, fingerprint: fingerprint, expires: now.Add(c.ttl)})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*idempotentEntry).key)
+	}
+	return nil, nil
+}
+
+// finish records the response of the request that claimed key, replayed for ttl.
+// A key evicted while its request was in flight is not recorded again.
+func (c *IdempotencyCache) finish(key string, response *idempotentResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*idempotentEntry)
+		entry.response = response
+		entry.expires = c.now().Add(c.ttl)
+	}
+}
+
+// abandon releases key without a response, so the request can be retried.
+func (c *IdempotencyCache) abandon(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok && element.Value.(*idempotentEntry).response == nil {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// requestFingerprint returns the hash identifying a creation request: its method, path and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder captures the status and body written by the next handler while passing them through.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status code.
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the body.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// IdempotencyMiddleware replays the recorded response of creation requests retried with the same Idempotency-Key,
+// keyed per client IP so clients cannot replay each other's responses. Server errors are not recorded.
+// A retry while the original request is in flight is answered with 409 Conflict,
+// and a key reused with a different method, path or body with 422 Unprocessable Entity.
+// If require is true, creation requests without an Idempotency-Key are rejected with 400 Bad Request.
+func IdempotencyMiddleware(cache *IdempotencyCache, proxies TrustedProxies, require bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isCreation(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+			if idempotencyKey == "" {
+				if require {
+					badRequest := types.NewBadRequestError([]types.Details{types.NewDetails(IdempotencyKeyHeader, "Idempotency-Key header is required")})
+					utils.HandleError(w, types.NewValidationError(badRequest.Error(), badRequest))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					badRequest := types.NewBadRequestError([]types.Details{
+						types.NewDetails("body", fmt.Sprintf("Body exceeds the maximum size of %d bytes", maxBytesErr.Limit)),
+					})
+					utils.HandleError(w, types.NewPayloadTooLargeError(badRequest.Error(), badRequest))
+					return
+				}
+				badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("body", "Failed to read body")})
+				utils.HandleError(w, types.NewValidationError(badRequest.Error(), badRequest))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := proxies.ClientIP(r) + "|" + idempotencyKey
+			response, err := cache.begin(key, requestFingerprint(r, body))
+			if err != nil {
+				utils.HandleError(w, err)
+				return
+			}
+			if response != nil {
+				for name, values := range response.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(response.status)
+				w.Write(response.body)
+				return
+			}
+
+			// The key is released if the request fails or panics, so it can be retried
+			recorded := false
+			defer func() {
+				if !recorded {
+					cache.abandon(key)
+				}
+			}()
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			if recorder.status != 0 && recorder.status < http.StatusInternalServerError {
+				header := w.Header().Clone()
+				header.Del(types.RequestIDHeader)
+				cache.finish(key, &idempotentResponse{
+					status: recorder.status,
+					header: header,
+					body:   recorder.body.Bytes(),
+				})
+				recorded = true
+			}
+		})
+	}
+}
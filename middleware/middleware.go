@@ -1,36 +1,191 @@
 package middleware
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/pizza-nz/url-shortener/database"
 	"github.com/pizza-nz/url-shortener/types"
 	"github.com/pizza-nz/url-shortener/utils"
 )
 
-// RequestIDMiddleware is a middleware that generates a unique request ID for each incoming HTTP request.
-// It adds the request ID to the response header and logs the request details.
-func RequestIDMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := uuid.New().String()
+// maxRequestIDLength is the maximum length of a request ID accepted from the client.
+const maxRequestIDLength = 128
 
-		w.Header().Set("X-Request-ID", requestID)
-		slog.Info("Received request", "requestID", requestID, "method", r.Method, "url", r.URL.String())
+// RequestIDMiddleware is a middleware that assigns a request ID to each incoming HTTP request.
+// The ID is read from the types.RequestIDHeader request header if present and valid, otherwise a new one is generated.
+// It adds the request ID to the response header and logs the request details, except for requests
+// whose path starts with one of skipLog, such as health probes and metrics scrapes, which are still served.
+func RequestIDMiddleware(skipLog []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(types.RequestIDHeader)
+			if !isValidRequestID(requestID) {
+				requestID = uuid.New().String()
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			w.Header().Set(types.RequestIDHeader, requestID)
+			if !hasAnyPrefix(r.URL.Path, skipLog) {
+				slog.InfoContext(r.Context(), "Received request", "requestID", requestID, "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasAnyPrefix reports whether s starts with any of prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidRequestID reports whether a client supplied request ID is safe to propagate and log.
+// It must be non-empty, bounded in length and contain only printable ASCII characters.
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// BackendMiddleware attaches the storage backend type serving the request to the request context.
+// backend is called per request, so the backend may be connected after the routes are registered.
+func BackendMiddleware(backend func() string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), types.BackendContextKey, backend())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
 
-// DBReadyMiddleware checks if the database is connected.
+// BackendFromContext returns the storage backend type attached by BackendMiddleware, or "" if none.
+func BackendFromContext(ctx context.Context) string {
+	backend, _ := ctx.Value(types.BackendContextKey).(string)
+	return backend
+}
+
+// DBReadyMiddleware checks if the database serving the request is ready.
 // If not, it returns a 503 Service Unavailable error.
-func DBReadyMiddleware(next http.Handler) http.Handler {
+// ready is called per request, so the database may be connected after the routes are registered.
+func DBReadyMiddleware(ready func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ready() {
+				utils.HandleError(w, types.NewUnavailableError("Database is not ready", nil))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HTTPSRedirectMiddleware redirects plain HTTP requests to the same URL on the https scheme with a 301.
+// Requests are considered secure if they arrived over TLS or a trusted proxy reports https via X-Forwarded-Proto.
+func HTTPSRedirectMiddleware(proxies TrustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if proxies.IsSecure(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			target := "https://" + r.Host + r.URL.RequestURI()
+			slog.InfoContext(r.Context(), "Redirecting to HTTPS", "requestID", w.Header().Get(types.RequestIDHeader), "target", target)
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		})
+	}
+}
+
+// HSTSMiddleware adds a Strict-Transport-Security header with maxAge seconds to responses of secure requests,
+// so browsers only use HTTPS for the host afterwards. Plain HTTP responses never carry it, as browsers ignore it there.
+// Requests are considered secure as in HTTPSRedirectMiddleware.
+func HSTSMiddleware(proxies TrustedProxies, maxAge int, includeSubDomains bool) func(http.Handler) http.Handler {
+	value := "max-age=" + strconv.Itoa(maxAge)
+	if includeSubDomains {
+		value += "; includeSubDomains"
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if proxies.IsSecure(r) {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TimeoutMiddleware wraps the handler in http.TimeoutHandler, so a handler that hangs returns
+// 503 Service Unavailable with a JSON message after timeout instead of holding the connection open
+// until the server write timeout.
+// http.TimeoutHandler buffers responses and can't flush, so routes with a path starting with one of the exempt
+// prefixes, such as event streams, are served without the timeout.
+func TimeoutMiddleware(timeout time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		timed := http.TimeoutHandler(next, timeout, `{"message":"Request timed out"}`)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hasAnyPrefix(r.URL.Path, exempt) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timed.ServeHTTP(&timeoutWriter{ResponseWriter: w}, r)
+		})
+	}
+}
+
+// timeoutWriter labels the timeout message of http.TimeoutHandler as JSON, which it writes without a Content-Type.
+type timeoutWriter struct {
+	http.ResponseWriter
+}
+
+// WriteHeader sets the JSON Content-Type on a 503 Service Unavailable without one.
+func (t *timeoutWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && t.Header().Get("Content-Type") == "" {
+		t.Header().Set("Content-Type", "application/json")
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (t *timeoutWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// CleanPathMiddleware normalizes the request path with path.Clean before routing, collapsing duplicate slashes,
+// dropping trailing slashes and resolving dot segments, so /v1//shorten/abc/ routes like /v1/shorten/abc.
+// The path is rewritten in place rather than redirected, so POST and PUT bodies are kept.
+// Short codes never contain slashes or dots, so their meaning is unchanged.
+func CleanPathMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !database.IsDBReady() {
-			utils.HandleError(w, types.NewAppError("Service Not Available", "Database is not ready", http.StatusServiceUnavailable, nil))
-			return
+		if cleaned := cleanPath(r.URL.Path); cleaned != r.URL.Path {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = cleaned
+			r2.URL.RawPath = ""
+			r = r2
 		}
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// cleanPath returns the canonical form of a request path, rooted and without trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return path.Clean("/" + p)
+}
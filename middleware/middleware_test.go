@@ -0,0 +1,873 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// okHandler is a handler that always responds with 200 OK.
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+var createdHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusCreated)
+})
+
+// TestHTTPSRedirectMiddleware tests the HTTPSRedirectMiddleware with forwarded and direct requests.
+func TestHTTPSRedirectMiddleware(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedProto string
+		tls            bool
+		want           int
+	}{
+		{"trusted proxy forwarded https", "10.1.2.3:4567", "https", false, http.StatusOK},
+		{"trusted proxy forwarded http", "192.168.1.1:4567", "http", false, http.StatusMovedPermanently},
+		{"untrusted client spoofing https", "203.0.113.7:4567", "https", false, http.StatusMovedPermanently},
+		{"direct plain http", "203.0.113.7:4567", "", false, http.StatusMovedPermanently},
+		{"direct tls", "203.0.113.7:4567", "", true, http.StatusOK},
+	}
+
+	handler := HTTPSRedirectMiddleware(proxies)(okHandler)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://sho.rt/v1/shorten/abc?x=1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.want {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.want)
+			}
+			if tt.want == http.StatusMovedPermanently {
+				if location := rr.Header().Get("Location"); location != "https://sho.rt/v1/shorten/abc?x=1" {
+					t.Errorf("handler returned wrong location: got %v want %v",
+						location, "https://sho.rt/v1/shorten/abc?x=1")
+				}
+			}
+		})
+	}
+}
+
+// TestHSTSMiddleware tests that Strict-Transport-Security is only sent on secure requests.
+func TestHSTSMiddleware(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		remoteAddr        string
+		forwardedProto    string
+		tls               bool
+		includeSubDomains bool
+		want              string
+	}{
+		{"direct tls", "203.0.113.7:4567", "", true, false, "max-age=31536000"},
+		{"direct tls with subdomains", "203.0.113.7:4567", "", true, true, "max-age=31536000; includeSubDomains"},
+		{"trusted proxy forwarded https", "10.1.2.3:4567", "https", false, false, "max-age=31536000"},
+		{"untrusted client spoofing https", "203.0.113.7:4567", "https", false, false, ""},
+		{"direct plain http", "203.0.113.7:4567", "", false, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://sho.rt/v1/shorten/abc", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			rr := httptest.NewRecorder()
+			HSTSMiddleware(proxies, 31536000, tt.includeSubDomains)(okHandler).ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, http.StatusOK)
+			}
+			if hsts := rr.Header().Get("Strict-Transport-Security"); hsts != tt.want {
+				t.Errorf("handler returned wrong Strict-Transport-Security: got %q want %q", hsts, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseTrustedProxiesInvalid tests that invalid entries are rejected.
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	if _, err := ParseTrustedProxies("10.0.0.0/8,not-an-ip"); err == nil {
+		t.Error("Expected an error for an invalid trusted proxy, but got nil")
+	}
+}
+
+// TestDBReadyMiddleware tests that requests are rejected with 503 while the database is not ready.
+func TestDBReadyMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		ready          bool
+		expectedStatus int
+	}{
+		{"ready", true, http.StatusOK},
+		{"not ready", false, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/shorten/jR", nil)
+			rr := httptest.NewRecorder()
+			DBReadyMiddleware(func() bool { return tt.ready })(okHandler).ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+// TestRequestIDMiddlewareSkipLog tests that requests on skipped paths are served but not logged.
+func TestRequestIDMiddlewareSkipLog(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	handler := RequestIDMiddleware([]string{"/healthz", "/readyz", "/metrics"})(okHandler)
+
+	tests := []struct {
+		path       string
+		wantLogged bool
+	}{
+		{"/healthz", false},
+		{"/readyz", false},
+		{"/metrics", false},
+		{"/v1/shorten/jR", true},
+		{"/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest("GET", tt.path, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, http.StatusOK)
+			}
+			if logged := strings.Contains(buf.String(), "Received request"); logged != tt.wantLogged {
+				t.Errorf("request logged = %v, want %v: %q", logged, tt.wantLogged, buf.String())
+			}
+		})
+	}
+}
+
+// TestRequestIDMiddlewareCustomHeader tests reading and writing the request ID under a custom header name.
+func TestRequestIDMiddlewareCustomHeader(t *testing.T) {
+	previous := types.RequestIDHeader
+	types.RequestIDHeader = "X-Correlation-Id"
+	defer func() { types.RequestIDHeader = previous }()
+
+	handler := RequestIDMiddleware(nil)(okHandler)
+
+	// Test case 1: Incoming ID is propagated under the custom header
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Correlation-ID", "abc-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("X-Correlation-ID"); got != "abc-123" {
+		t.Errorf("middleware returned wrong request ID: got %v want %v", got, "abc-123")
+	}
+	if got := rr.Header().Get("X-Request-ID"); got != "" {
+		t.Errorf("middleware set the default header: got %v want empty", got)
+	}
+
+	// Test case 2: Missing ID is generated and written under the custom header
+	req = httptest.NewRequest("GET", "/", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if _, err := uuid.Parse(rr.Header().Get("X-Correlation-ID")); err != nil {
+		t.Errorf("middleware did not generate a request ID: %v", err)
+	}
+
+	// Test case 3: Invalid incoming ID is replaced
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Correlation-ID", "bad id\nwith newline")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if _, err := uuid.Parse(rr.Header().Get("X-Correlation-ID")); err != nil {
+		t.Errorf("middleware did not replace an invalid request ID: %v", err)
+	}
+}
+
+// TestCreationQuotaMiddleware tests quota exhaustion per IP and globally, and the window reset.
+func TestCreationQuotaMiddleware(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	quota := NewCreationQuota(2, 3, 24*time.Hour)
+	quota.now = func() time.Time { return now }
+
+	handler := CreationQuotaMiddleware(quota, TrustedProxies{}, false)(createdHandler)
+
+	create := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/shorten", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test case 1: Per IP quota is exhausted after two creations
+	for i := 0; i < 2; i++ {
+		if rr := create("203.0.113.1:1000"); rr.Code != http.StatusCreated {
+			t.Fatalf("creation %d returned %v, want %v", i+1, rr.Code, http.StatusCreated)
+		}
+	}
+	rr := create("203.0.113.1:1000")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "86401" {
+		t.Errorf("Retry-After = %v, want 86401", retryAfter)
+	}
+
+	// Test case 2: Global quota is exhausted by another IP
+	if rr := create("203.0.113.2:1000"); rr.Code != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if rr := create("203.0.113.3:1000"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+
+	// Test case 3: Quotas reset with the next window
+	now = now.Add(24 * time.Hour)
+	if rr := create("203.0.113.1:1000"); rr.Code != http.StatusCreated {
+		t.Errorf("handler returned wrong status code after reset: got %v want %v", rr.Code, http.StatusCreated)
+	}
+}
+
+// TestCreationQuotaHeaders tests that the rate limit headers count down the quota closest to exhaustion.
+func TestCreationQuotaHeaders(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	quota := NewCreationQuota(3, 4, time.Hour)
+	quota.now = func() time.Time { return now }
+
+	handler := CreationQuotaMiddleware(quota, TrustedProxies{}, true)(createdHandler)
+
+	tests := []struct {
+		remoteAddr    string
+		wantStatus    int
+		wantLimit     string
+		wantRemaining string
+	}{
+		{"203.0.113.1:1000", http.StatusCreated, "3", "2"},
+		{"203.0.113.1:1000", http.StatusCreated, "3", "1"},
+		{"203.0.113.2:1000", http.StatusCreated, "4", "1"},
+		{"203.0.113.1:1000", http.StatusCreated, "3", "0"},
+		{"203.0.113.1:1000", http.StatusTooManyRequests, "3", "0"},
+		{"203.0.113.2:1000", http.StatusTooManyRequests, "4", "0"},
+	}
+
+	for i, tt := range tests {
+		now = now.Add(time.Minute)
+		req := httptest.NewRequest("POST", "/v1/shorten", nil)
+		req.RemoteAddr = tt.remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("request %d: handler returned wrong status code: got %v want %v", i+1, rr.Code, tt.wantStatus)
+		}
+		if limit := rr.Header().Get("X-RateLimit-Limit"); limit != tt.wantLimit {
+			t.Errorf("request %d: X-RateLimit-Limit = %v, want %v", i+1, limit, tt.wantLimit)
+		}
+		if remaining := rr.Header().Get("X-RateLimit-Remaining"); remaining != tt.wantRemaining {
+			t.Errorf("request %d: X-RateLimit-Remaining = %v, want %v", i+1, remaining, tt.wantRemaining)
+		}
+		if reset := rr.Header().Get("X-RateLimit-Reset"); reset != strconv.Itoa(3600-60*i) {
+			t.Errorf("request %d: X-RateLimit-Reset = %v, want %v", i+1, reset, 3600-60*i)
+		}
+	}
+}
+
+// TestCreationQuotaRefund tests that requests not answered with 201 Created do not count against the quota.
+func TestCreationQuotaRefund(t *testing.T) {
+	quota := NewCreationQuota(1, 1, time.Hour)
+	status := http.StatusBadRequest
+	handler := CreationQuotaMiddleware(quota, TrustedProxies{}, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	create := func() int {
+		req := httptest.NewRequest("POST", "/v1/shorten", nil)
+		req.RemoteAddr = "203.0.113.1:1000"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for _, want := range []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusOK} {
+		status = want
+		if code := create(); code != want {
+			t.Fatalf("handler returned wrong status code: got %v want %v", code, want)
+		}
+	}
+	status = http.StatusCreated
+	if code := create(); code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", code, http.StatusCreated)
+	}
+	if code := create(); code != http.StatusTooManyRequests {
+		t.Errorf("handler returned wrong status code: got %v want %v", code, http.StatusTooManyRequests)
+	}
+}
+
+// TestCreationQuotaErrorBody tests that a throttled request is answered with the standard AppError body.
+func TestCreationQuotaErrorBody(t *testing.T) {
+	handler := CreationQuotaMiddleware(NewCreationQuota(1, 0, time.Hour), TrustedProxies{}, false)(createdHandler)
+
+	var rr *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/v1/shorten", nil)
+		req.RemoteAddr = "203.0.113.1:1000"
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+	}
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %v, want application/json", contentType)
+	}
+	if retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retryAfter <= 0 {
+		t.Errorf("Retry-After = %q, want a positive number of seconds", rr.Header().Get("Retry-After"))
+	}
+
+	var body map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode the response body: %v", err)
+	}
+	if body["code"] != types.ErrorCodeRateLimited {
+		t.Errorf("code = %v, want %v", body["code"], types.ErrorCodeRateLimited)
+	}
+	if !strings.HasPrefix(body["message"], "Creation quota exceeded") {
+		t.Errorf("message = %v, want the creation quota message", body["message"])
+	}
+}
+
+// TestTraceContextMiddleware tests that a valid traceparent continues the trace in a new span.
+func TestTraceContextMiddleware(t *testing.T) {
+	var span types.SpanContext
+	handler := TraceContextMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, _ = SpanContextFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name        string
+		traceParent string
+		wantTraceID string
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"missing", "", ""},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", ""},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(TraceParentHeader, tt.traceParent)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if len(span.TraceID) != 32 || len(span.SpanID) != 16 || span.SpanID == "00f067aa0ba902b7" {
+				t.Fatalf("SpanContextFromContext() = %+v, want a new span", span)
+			}
+			if tt.wantTraceID != "" && span.TraceID != tt.wantTraceID {
+				t.Errorf("TraceID = %v, want %v", span.TraceID, tt.wantTraceID)
+			}
+			if tt.wantTraceID == "" && strings.Contains(tt.traceParent, span.TraceID) {
+				t.Errorf("TraceID = %v, want a new trace", span.TraceID)
+			}
+			if want := "00-" + span.TraceID + "-" + span.SpanID + "-01"; rr.Header().Get(TraceParentHeader) != want {
+				t.Errorf("traceparent = %v, want %v", rr.Header().Get(TraceParentHeader), want)
+			}
+		})
+	}
+}
+
+// TestClientIP tests that X-Forwarded-For is only honored from trusted proxies.
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.5, 10.0.0.2")
+	if ip := proxies.ClientIP(req); ip != "203.0.113.5" {
+		t.Errorf("ClientIP() = %v, want %v", ip, "203.0.113.5")
+	}
+
+	req.RemoteAddr = "203.0.113.7:1000"
+	if ip := proxies.ClientIP(req); ip != "203.0.113.7" {
+		t.Errorf("ClientIP() = %v, want %v", ip, "203.0.113.7")
+	}
+}
+
+// TestTimeoutMiddleware tests that a deliberately slow handler returns a 503 JSON timeout response,
+// while exempt routes are served unbuffered and can flush.
+func TestTimeoutMiddleware(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	slowHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	})
+
+	handler := TimeoutMiddleware(10*time.Millisecond, "/admin/v1/events")(slowHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+	if body := rr.Body.String(); body != `{"message":"Request timed out"}` {
+		t.Errorf("handler returned unexpected body: got %v", body)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("handler returned wrong content type: got %v want %v", contentType, "application/json")
+	}
+
+	req = httptest.NewRequest("GET", "/admin/v1/events", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("exempt route returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+}
+
+// TestClientTimeoutMiddleware tests that X-Request-Timeout sets a clamped deadline answered with 504 when exceeded.
+func TestClientTimeoutMiddleware(t *testing.T) {
+	slowHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			w.Header().Set("X-Slow", "done")
+			w.WriteHeader(http.StatusCreated)
+		case <-r.Context().Done():
+		}
+	})
+	handler := ClientTimeoutMiddleware(time.Second)(slowHandler)
+
+	tests := []struct {
+		name           string
+		timeout        string
+		expectedStatus int
+	}{
+		{"no header", "", http.StatusCreated},
+		{"short client timeout", "10", http.StatusGatewayTimeout},
+		{"long client timeout", "500", http.StatusCreated},
+		{"invalid header", "soon", http.StatusBadRequest},
+		{"non-positive header", "0", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/shorten", nil)
+			if tt.timeout != "" {
+				req.Header.Set(RequestTimeoutHeader, tt.timeout)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if tt.expectedStatus == http.StatusCreated && rr.Header().Get("X-Slow") != "done" {
+				t.Errorf("handler headers were not passed through: got %v", rr.Header())
+			}
+		})
+	}
+
+	// A client timeout over the server maximum is clamped
+	clamped := ClientTimeoutMiddleware(10 * time.Millisecond)(slowHandler)
+	req := httptest.NewRequest("POST", "/v1/shorten", nil)
+	req.Header.Set(RequestTimeoutHeader, "60000")
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	clamped.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusGatewayTimeout {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusGatewayTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("clamped request took %v, want about 10ms", elapsed)
+	}
+
+	// A handler panic is re-raised on the serving goroutine instead of crashing the process
+	panicking := ClientTimeoutMiddleware(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	req = httptest.NewRequest("POST", "/v1/shorten", nil)
+	req.Header.Set(RequestTimeoutHeader, "500")
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want the handler panic re-raised", p)
+			}
+		}()
+		panicking.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+}
+
+// TestCleanPathMiddleware tests that doubled and trailing slashes are normalized before routing, keeping the method.
+func TestCleanPathMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/shorten", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("create " + r.Method))
+	})
+	mux.HandleFunc("/v1/shorten/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("resource " + r.Method + " " + r.URL.Path))
+	})
+	handler := CleanPathMiddleware(mux)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		expectedBody string
+	}{
+		{"canonical path", "GET", "/v1/shorten/abc", "resource GET /v1/shorten/abc"},
+		{"doubled slash in prefix", "GET", "/v1//shorten/abc", "resource GET /v1/shorten/abc"},
+		{"doubled slash before code", "GET", "/v1/shorten//abc", "resource GET /v1/shorten/abc"},
+		{"trailing slash", "GET", "/v1/shorten/abc/", "resource GET /v1/shorten/abc"},
+		{"many slashes", "PUT", "//v1///shorten///abc//", "resource PUT /v1/shorten/abc"},
+		{"create with doubled slash", "POST", "/v1//shorten", "create POST"},
+		{"create with trailing slash", "POST", "/v1/shorten/", "create POST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+			if body := rr.Body.String(); body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestAcceptVersionMiddleware tests that the path segment and the Accept header versioning reach the same handler,
+// while unversioned requests without a versioned media type are routed unchanged.
+func TestAcceptVersionMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/shorten/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("resource " + r.Method + " " + r.URL.Path))
+	})
+	mux.HandleFunc("/admin/v1/urls", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("admin " + r.URL.Path))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("redirect " + r.URL.Path))
+	})
+	handler := AcceptVersionMiddleware(mux)
+
+	tests := []struct {
+		name           string
+		path           string
+		accept         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"path versioning", "/v1/shorten/abc", "", http.StatusOK, "resource GET /v1/shorten/abc"},
+		{"path versioning with header", "/v1/shorten/abc", VersionedMediaType, http.StatusOK, "resource GET /v1/shorten/abc"},
+		{"header versioning", "/shorten/abc", VersionedMediaType, http.StatusOK, "resource GET /v1/shorten/abc"},
+		{"header versioning among media types", "/shorten/abc", "application/json;q=0.9, " + VersionedMediaType, http.StatusOK, "resource GET /v1/shorten/abc"},
+		{"header versioning of admin path", "/admin/urls", VersionedMediaType, http.StatusOK, "admin /admin/v1/urls"},
+		{"unsupported version", "/shorten/abc", "application/vnd.shortener.v2+json", http.StatusNotAcceptable, ""},
+		{"unversioned redirect", "/abc", "text/html", http.StatusOK, "redirect /abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+			}
+			if tt.expectedBody == "" {
+				return
+			}
+			if body := rr.Body.String(); body != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v", body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+// TestIdempotencyMiddleware tests Idempotency-Key enforcement and the replay of retried creations.
+func TestIdempotencyMiddleware(t *testing.T) {
+	created := 0
+	createHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		created++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"shortURL":"abc"}`))
+	})
+
+	tests := []struct {
+		name           string
+		require        bool
+		key            string
+		expectedStatus int
+		expectedCreate int
+	}{
+		{"missing key rejected when required", true, "", http.StatusBadRequest, 0},
+		{"missing key allowed by default", false, "", http.StatusCreated, 1},
+		{"key present when required", true, "retry-1", http.StatusCreated, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created = 0
+			handler := IdempotencyMiddleware(NewIdempotencyCache(time.Hour, 100), nil, tt.require)(createHandler)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/shorten", nil)
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if created != tt.expectedCreate {
+				t.Errorf("handler created %v short URLs, want %v", created, tt.expectedCreate)
+			}
+		})
+	}
+
+	// Test case: A retry with the same key replays the response without creating again
+	created = 0
+	handler := IdempotencyMiddleware(NewIdempotencyCache(time.Hour, 100), nil, true)(createHandler)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/shorten", nil)
+		req.Header.Set(IdempotencyKeyHeader, "retry-2")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusCreated {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusCreated)
+		}
+		if body := rr.Body.String(); body != `{"shortURL":"abc"}` {
+			t.Errorf("handler returned unexpected body: got %v want %v",
+				body, `{"shortURL":"abc"}`)
+		}
+	}
+	if created != 1 {
+		t.Errorf("handler created %v short URLs, want 1", created)
+	}
+
+	// Test case: A key reused with a different body is refused
+	req := httptest.NewRequest(http.MethodPost, "/v1/shorten", strings.NewReader(`{"longURL":"http://example.org"}`))
+	req.Header.Set(IdempotencyKeyHeader, "retry-2")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusUnprocessableEntity)
+	}
+}
+
+// TestIdempotencyInFlight tests that a retry while the original request is in flight is refused,
+// and that a failed request releases its key.
+func TestIdempotencyInFlight(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	status := http.StatusInternalServerError
+	handler := IdempotencyMiddleware(NewIdempotencyCache(time.Hour, 100), nil, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(status)
+	}))
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/shorten", strings.NewReader(`{"longURL":"http://example.com"}`))
+		req.Header.Set(IdempotencyKeyHeader, "slow")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- send() }()
+	<-entered
+	if got := send(); got != http.StatusConflict {
+		t.Errorf("retry in flight returned status %v, want %v", got, http.StatusConflict)
+	}
+	release <- struct{}{}
+	if got := <-done; got != http.StatusInternalServerError {
+		t.Errorf("original request returned status %v, want %v", got, http.StatusInternalServerError)
+	}
+
+	// The server error isn't recorded, so the retry is served
+	status = http.StatusCreated
+	go func() { done <- send() }()
+	<-entered
+	release <- struct{}{}
+	if got := <-done; got != http.StatusCreated {
+		t.Errorf("retry after a server error returned status %v, want %v", got, http.StatusCreated)
+	}
+}
+
+// TestIdempotencyCacheBounded tests that the cache evicts the least recently used keys beyond its maximum
+// and drops expired keys when they are looked up.
+func TestIdempotencyCacheBounded(t *testing.T) {
+	cache := NewIdempotencyCache(time.Minute, 2)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	record := func(key string) {
+		if response, err := cache.begin(key, "fingerprint"); response != nil || err != nil {
+			t.Fatalf("begin(%v) = %v, %v, want a new claim", key, response, err)
+		}
+		cache.finish(key, &idempotentResponse{status: http.StatusCreated})
+	}
+
+	record("a")
+	record("b")
+	record("c")
+	if len(cache.entries) != 2 || cache.order.Len() != 2 {
+		t.Errorf("cache holds %v entries, want 2", len(cache.entries))
+	}
+	if response, _ := cache.begin("a", "fingerprint"); response != nil {
+		t.Error("begin() replayed the evicted key a")
+	}
+	if response, _ := cache.begin("c", "fingerprint"); response == nil {
+		t.Error("begin() didn't replay the recent key c")
+	}
+
+	now = now.Add(time.Minute)
+	if response, _ := cache.begin("c", "fingerprint"); response != nil {
+		t.Error("begin() replayed the expired key c")
+	}
+}
+
+// TestDecompressMiddleware tests that gzip request bodies are decoded within the size limit and plain bodies pass through.
+func TestDecompressMiddleware(t *testing.T) {
+	gzipped := func(body string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(body))
+		gz.Close()
+		return buf.Bytes()
+	}
+	payload := `{"longURL":"https://example.com"}`
+	compressed := gzipped(payload)
+
+	// decodeHandler decodes the payload like the shorten handler, answering 400, or 413 for a body over the limit, if it can't
+	decodeHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := types.DecodePayload(r)
+		if appErr, ok := err.(*types.AppError); ok {
+			w.WriteHeader(appErr.HTTPStatus)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(p.LongURL))
+	})
+	handler := DecompressMiddleware(64)(decodeHandler)
+
+	tests := []struct {
+		name           string
+		encoding       string
+		body           []byte
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"plain", "", []byte(payload), http.StatusOK, "https://example.com"},
+		{"identity", "identity", []byte(payload), http.StatusOK, "https://example.com"},
+		{"gzip", "gzip", compressed, http.StatusOK, "https://example.com"},
+		{"gzip mixed case", "GZip", compressed, http.StatusOK, "https://example.com"},
+		{"not gzip", "gzip", []byte(payload), http.StatusBadRequest, ""},
+		{"truncated gzip", "gzip", compressed[:len(compressed)-6], http.StatusBadRequest, ""},
+		{"too large once decompressed", "gzip", gzipped(`{"longURL":"https://example.com/` + strings.Repeat("a", 1000) + `"}`), http.StatusRequestEntityTooLarge, ""},
+		{"unsupported encoding", "br", []byte(payload), http.StatusUnsupportedMediaType, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/shorten", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q",
+					rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// TrustedProxies is a list of networks whose forwarding headers (e.g. X-Forwarded-Proto) are trusted.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs or plain IPs into TrustedProxies.
+// An empty string returns an empty list, meaning no proxy is trusted.
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	proxies := TrustedProxies{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, types.NewConfigError("Invalid trusted proxy IP: "+entry, nil)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, types.NewConfigError("Invalid trusted proxy CIDR: "+entry, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// IsTrusted reports whether the request came directly from a trusted proxy.
+func (t TrustedProxies) IsTrusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return t.contains(ip)
+}
+
+// IsSecure reports whether the request reached us over HTTPS.
+// X-Forwarded-Proto is only honored when the request came from a trusted proxy.
+func (t TrustedProxies) IsSecure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if t.IsTrusted(r) {
+		return strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client that made the request.
+// If the request came from a trusted proxy, the right-most untrusted address in X-Forwarded-For is used,
+// otherwise the remote address, so clients cannot spoof their IP by setting the header themselves.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !t.IsTrusted(r) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		if !t.contains(ip) {
+			return ip.String()
+		}
+		host = ip.String()
+	}
+	return host
+}
+
+// contains reports whether ip is in one of the trusted networks.
+func (t TrustedProxies) contains(ip net.IP) bool {
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIPMiddleware attaches the client IP, as returned by ClientIP, to the request context.
+func ClientIPMiddleware(proxies TrustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), types.ClientIPContextKey, proxies.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIPFromContext returns the client IP attached by ClientIPMiddleware, or "" if none.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(types.ClientIPContextKey).(string)
+	return ip
+}
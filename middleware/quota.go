@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
+)
+
+// CreationQuota tracks the number of short URLs created per client IP and globally within a fixed window,
+// e.g. 1000 creations per IP per day. Unlike rate limiting it caps volume, not velocity.
+// A limit of 0 disables that quota. Counts are kept in memory per instance, so behind a load balancer
+// with n instances a client may create up to n times the configured quotas.
+type CreationQuota struct {
+	mu          sync.Mutex
+	perIP       int
+	global      int
+	window      time.Duration
+	windowStart time.Time
+	counts      map[string]int
+	total       int
+	now         func() time.Time
+}
+
+// NewCreationQuota creates a new instance of CreationQuota.
+func NewCreationQuota(perIP, global int, window time.Duration) *CreationQuota {
+	return &CreationQuota{
+		perIP:  perIP,
+		global: global,
+		window: window,
+		counts: make(map[string]int),
+		now:    time.Now,
+	}
+}
+
+// QuotaStatus is the outcome of CreationQuota.Allow.
+// Limit and Remaining are those of the quota closest to exhaustion for the client, per IP or global.
+type QuotaStatus struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time // When the current window resets
+
+	windowStart time.Time // Start of the window the creation was recorded in, for refund
+}
+
+// Allow records a creation by ip if neither quota is exhausted.
+// It returns whether the creation is allowed, the remaining creations and when the current window resets.
+func (q *CreationQuota) Allow(ip string) QuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	if q.windowStart.IsZero() || !now.Before(q.windowStart.Add(q.window)) {
+		q.windowStart = now
+		q.counts = make(map[string]int)
+		q.total = 0
+	}
+	status := QuotaStatus{Reset: q.windowStart.Add(q.window), windowStart: q.windowStart}
+
+	exhausted := q.global > 0 && q.total >= q.global || q.perIP > 0 && q.counts[ip] >= q.perIP
+	if !exhausted {
+		q.counts[ip]++
+		q.total++
+		status.Allowed = true
+	}
+
+	status.Limit, status.Remaining = -1, -1
+	if q.perIP > 0 {
+		status.Limit, status.Remaining = q.perIP, max(q.perIP-q.counts[ip], 0)
+	}
+	if remaining := max(q.global-q.total, 0); q.global > 0 && (status.Remaining < 0 || remaining < status.Remaining) {
+		status.Limit, status.Remaining = q.global, remaining
+	}
+	return status
+}
+
+// refund takes back a creation by ip recorded by Allow that did not create a shortened URL.
+// Creations recorded in an earlier window are already forgotten and are not refunded.
+func (q *CreationQuota) refund(ip string, windowStart time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.windowStart.Equal(windowStart) || q.counts[ip] == 0 {
+		return
+	}
+	q.counts[ip]--
+	q.total--
+	if q.counts[ip] == 0 {
+		delete(q.counts, ip)
+	}
+}
+
+// statusWriter records the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code and passes it on.
+func (s *statusWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Write records an implicit 200 OK and passes the data on.
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// isCreation reports whether r may create a shortened URL, by POST or PUT.
+func isCreation(r *http.Request) bool {
+	return r.Method == http.MethodPost || r.Method == http.MethodPut
+}
+
+// CreationQuotaMiddleware rejects creation requests with 429 Too Many Requests once the creation quota is exhausted.
+// The response is a rate limited AppError, its Retry-After header and message carry the time the quota resets.
+// Only requests answered with 201 Created count against the quota, so invalid requests and existing short URLs
+// are free.
+// If headers is true, every creation response carries X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset,
+// the seconds until the window resets, so clients can slow down before they are rejected.
+func CreationQuotaMiddleware(quota *CreationQuota, proxies TrustedProxies, headers bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isCreation(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ip := proxies.ClientIP(r)
+			status := quota.Allow(ip)
+			reset := status.Reset
+			if headers && status.Limit > 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+				w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(reset.Sub(quota.now()).Seconds())))
+			}
+			if !status.Allowed {
+				appErr := types.NewRateLimitError("Creation quota exhausted for "+ip, nil)
+				appErr.Message = "Creation quota exceeded, resets at " + reset.UTC().Format(time.RFC3339)
+				appErr.RetryAfter = reset.Sub(quota.now())
+				utils.HandleError(w, appErr)
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if sw.status != http.StatusCreated {
+				quota.refund(ip, status.windowStart)
+			}
+		})
+	}
+}
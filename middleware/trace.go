@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// TraceParentHeader is the W3C Trace Context header propagating the trace of a request.
+const TraceParentHeader = "traceparent"
+
+// TraceContextMiddleware attaches a SpanContext to the request context, so logs written with it can be
+// correlated with traces. The trace ID is continued from a valid traceparent request header, e.g. set by
+// an OpenTelemetry instrumented client or proxy, otherwise a new trace is started. Each request is a new span,
+// sent back in the traceparent response header.
+func TraceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID, ok := parseTraceParent(r.Header.Get(TraceParentHeader))
+		if !ok {
+			traceID = randomHex(16)
+		}
+		span := types.SpanContext{TraceID: traceID, SpanID: randomHex(8)}
+
+		w.Header().Set(TraceParentHeader, "00-"+span.TraceID+"-"+span.SpanID+"-01")
+		ctx := context.WithValue(r.Context(), types.SpanContextKey, span)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SpanContextFromContext returns the SpanContext attached by TraceContextMiddleware, and whether there is one.
+func SpanContextFromContext(ctx context.Context) (types.SpanContext, bool) {
+	span, ok := ctx.Value(types.SpanContextKey).(types.SpanContext)
+	return span, ok
+}
+
+// parseTraceParent returns the trace ID of a traceparent header value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", and whether it is valid.
+// All-zero IDs are invalid, and later versions are accepted if they start with the version 00 fields.
+func parseTraceParent(value string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return "", false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || !isLowerHex(version) || version == "ff" || version == "00" && len(parts) != 4 {
+		return "", false
+	}
+	if len(flags) != 2 || !isLowerHex(flags) {
+		return "", false
+	}
+	if len(traceID) != 32 || !isLowerHex(traceID) || strings.Trim(traceID, "0") == "" {
+		return "", false
+	}
+	if len(parentID) != 16 || !isLowerHex(parentID) || strings.Trim(parentID, "0") == "" {
+		return "", false
+	}
+	return traceID, true
+}
+
+// isLowerHex reports whether s only contains lowercase hex digits.
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex returns n random bytes as lowercase hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+	"github.com/pizza-nz/url-shortener/utils"
+)
+
+const (
+	// APIVersioningPath selects the API version by the path segment only, e.g. /v1/shorten.
+	APIVersioningPath = "path"
+	// APIVersioningHeader also selects the API version by the Accept header, e.g. /shorten with VersionedMediaType.
+	APIVersioningHeader = "header"
+)
+
+// versionMediaPrefix and versionMediaSuffix enclose the API version in a versioned Accept media type.
+const (
+	versionMediaPrefix = "application/vnd.shortener."
+	versionMediaSuffix = "+json"
+)
+
+// VersionedMediaType is the Accept media type selecting the current API version without the version path segment.
+var VersionedMediaType = versionMediaPrefix + types.APIVersion + versionMediaSuffix
+
+// AcceptVersionMiddleware routes requests without the version path segment that accept a versioned media type,
+// e.g. GET /shorten/abc with "Accept: application/vnd.shortener.v1+json", to the same handler as /v1/shorten/abc.
+// Admin paths get the version after /admin, so /admin/urls routes like /admin/v1/urls.
+// The path is rewritten in place, like CleanPathMiddleware. An unsupported version is answered with 406 Not Acceptable,
+// and requests without a versioned media type are passed on unchanged, so redirects keep working.
+func AcceptVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isVersionedPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The same unversioned path is a redirect or an API call depending on the Accept header
+		w.Header().Add("Vary", "Accept")
+		version, ok := acceptedVersion(r.Header.Values("Accept"))
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if version != types.APIVersion {
+			utils.HandleError(w, types.NewAppError("Not Acceptable", "Unsupported API version "+version, http.StatusNotAcceptable, nil))
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = versionPath(r.URL.Path)
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// isVersionedPath reports whether p already carries the API version path segment.
+func isVersionedPath(p string) bool {
+	for _, prefix := range []string{"/" + types.APIVersion, "/admin/" + types.APIVersion} {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// versionPath inserts the API version path segment into p, after /admin for admin paths.
+func versionPath(p string) string {
+	if rest, ok := strings.CutPrefix(p, "/admin/"); ok {
+		return "/admin/" + types.APIVersion + "/" + rest
+	}
+	return "/" + types.APIVersion + p
+}
+
+// acceptedVersion returns the API version of the first versioned media type in the Accept headers,
+// and false if none of them is one.
+func acceptedVersion(accept []string) (string, bool) {
+	for _, header := range accept {
+		for _, value := range strings.Split(header, ",") {
+			mediaType, _, err := mime.ParseMediaType(value)
+			if err != nil {
+				continue
+			}
+			version, ok := strings.CutPrefix(mediaType, versionMediaPrefix)
+			if !ok {
+				continue
+			}
+			if version, ok = strings.CutSuffix(version, versionMediaSuffix); ok && version != "" {
+				return version, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// defaultLanding is the landing page served at the root when no custom template is configured.
+//
+//go:embed landing.html
+var defaultLanding string
+
+// LandingData is the data a landing page template is executed with.
+type LandingData struct {
+	BaseURL    string // Public base URL, the configured one or derived from the request
+	APIVersion string // Version prefix of the API routes, such as v1
+	Version    string // Version of the running build
+}
+
+// LoadLandingTemplate parses the landing page template at path, or the embedded default if path is empty.
+// It is called at startup so a broken custom template fails fast rather than on the first request.
+func LoadLandingTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.New("landing").Parse(defaultLanding)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read landing template: %w", err)
+	}
+	tmpl, err := template.New("landing").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse landing template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// landingHandler serves the landing page rendered from tmpl, with baseURL or the request's own base URL if empty.
+// The page is rendered before writing, so a failing template returns 500 rather than a partial page.
+func landingHandler(tmpl *template.Template, baseURL string) http.HandlerFunc {
+	version := buildVersion()
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := LandingData{
+			BaseURL:    baseURL,
+			APIVersion: types.APIVersion,
+			Version:    version,
+		}
+		if data.BaseURL == "" {
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			data.BaseURL = scheme + "://" + r.Host
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			slog.Error("Failed to render landing page", "error", err, "requestID", w.Header().Get(types.RequestIDHeader))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+		slog.Info("Handled request", "requestID", w.Header().Get(types.RequestIDHeader), "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery)
+	}
+}
+
+// buildVersion returns the module version of the running build, with the VCS revision if recorded.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	if version == "" {
+		version = "(devel)"
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+			version += " " + setting.Value[:7]
+		}
+	}
+	return version
+}
@@ -1,23 +1,46 @@
 package routes
 
 import (
-	"log/slog"
+	"html/template"
 	"net/http"
 )
 
+const (
+	// robotsDisallow is the robots.txt served when indexing is disabled, disallowing all crawling.
+	robotsDisallow = "User-agent: *\nDisallow: /\n"
+	// robotsAllow is the robots.txt served when indexing is allowed.
+	robotsAllow = "User-agent: *\nDisallow:\n"
+)
+
 // RegisterStaticRoutes registers static routes for the web server.
-// This includes the favicon and a root handler.
-func RegisterStaticRoutes(mux *http.ServeMux) {
+// This includes the favicon, robots.txt and a root handler.
+// If noIndex is true, robots.txt disallows crawling so search engines don't index short links.
+// If serveStatic is false, only robots.txt is registered, so the API runs without the ./static directory.
+// The root serves landing, the embedded default page if nil, with baseURL or the request's base URL if empty.
+func RegisterStaticRoutes(mux *http.ServeMux, noIndex, serveStatic bool, landing *template.Template, baseURL string) {
+	// Robots route, generated rather than served from ./static
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if noIndex {
+			w.Write([]byte(robotsDisallow))
+		} else {
+			w.Write([]byte(robotsAllow))
+		}
+	})
+
+	if !serveStatic {
+		return
+	}
+
 	// Favicon route
 	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./static/favicon.ico")
 	})
 
 	// Root route
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Hello, World!"))
-		slog.Info("Handled request", "requestID", r.Context().Value(w.Header().Get("X-Request-ID")), "method", r.Method, "url", r.URL.String())
-	})
+	if landing == nil {
+		landing = template.Must(LoadLandingTemplate(""))
+	}
+	mux.HandleFunc("/", landingHandler(landing, baseURL))
 }
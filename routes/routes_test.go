@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRobots tests the robots.txt content with indexing disabled and allowed.
+func TestRobots(t *testing.T) {
+	tests := []struct {
+		name     string
+		noIndex  bool
+		expected string
+	}{
+		{"noindex", true, "User-agent: *\nDisallow: /\n"},
+		{"index", false, "User-agent: *\nDisallow:\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			RegisterStaticRoutes(mux, tt.noIndex, true, nil, "")
+
+			req, err := http.NewRequest("GET", "/robots.txt", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, http.StatusOK)
+			}
+			if body := rr.Body.String(); body != tt.expected {
+				t.Errorf("handler returned unexpected body: got %q want %q",
+					body, tt.expected)
+			}
+		})
+	}
+}
+
+// TestStaticRoutesDisabled tests that the favicon and root routes are not served when static routes are disabled.
+func TestStaticRoutesDisabled(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterStaticRoutes(mux, true, false, nil, "")
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/favicon.ico", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+		{"/robots.txt", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+// TestLandingPage tests the root page rendered from the embedded default and from a custom template.
+func TestLandingPage(t *testing.T) {
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "landing.html")
+	if err := os.WriteFile(custom, []byte(`<p>{{.BaseURL}}/{{.APIVersion}} {{.Version}}</p>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.html")
+	if err := os.WriteFile(broken, []byte(`<p>{{.BaseURL</p>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	failing := filepath.Join(dir, "failing.html")
+	if err := os.WriteFile(failing, []byte(`<p>{{.Missing}}</p>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		baseURL        string
+		expectLoadErr  bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"default", "", "", false, http.StatusOK, "POST http://example.com/v1/shorten"},
+		{"default with base URL", "", "https://sho.rt", false, http.StatusOK, "POST https://sho.rt/v1/shorten"},
+		{"custom", custom, "https://sho.rt", false, http.StatusOK, "<p>https://sho.rt/v1 " + buildVersion() + "</p>"},
+		{"missing file", filepath.Join(dir, "missing.html"), "", true, 0, ""},
+		{"parse error", broken, "", true, 0, ""},
+		{"execution error", failing, "", false, http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			landing, err := LoadLandingTemplate(tt.path)
+			if tt.expectLoadErr {
+				if err == nil {
+					t.Error("expected an error loading the template, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error loading the template: %v", err)
+			}
+
+			mux := http.NewServeMux()
+			RegisterStaticRoutes(mux, true, true, landing, tt.baseURL)
+
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tt.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("handler returned unexpected body: got %q want it to contain %q",
+					rr.Body.String(), tt.expectedBody)
+			}
+			if tt.expectedStatus == http.StatusOK && rr.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+				t.Errorf("handler returned wrong content type: got %q", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
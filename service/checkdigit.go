@@ -0,0 +1,60 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// codeAlphabet is the default sqids alphabet, used for check characters and hash based codes.
+const codeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// checkCharacter computes the Luhn mod N check character for code over codeAlphabet.
+// It returns false if code contains a character outside the alphabet.
+func checkCharacter(code string) (byte, bool) {
+	n := len(codeAlphabet)
+	factor := 2
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		codePoint := strings.IndexByte(codeAlphabet, code[i])
+		if codePoint < 0 {
+			return 0, false
+		}
+		addend := factor * codePoint
+		factor = 3 - factor
+		sum += addend/n + addend%n
+	}
+	return codeAlphabet[(n-sum%n)%n], true
+}
+
+// appendCheckCharacter appends the check character to a generated code.
+func appendCheckCharacter(code string) string {
+	check, ok := checkCharacter(code)
+	if !ok {
+		return code
+	}
+	return code + string(check)
+}
+
+// stripCheckCharacter validates the trailing check character of code and returns the code without it.
+// It returns a BadRequestError if the check character does not match, which catches most typos
+// (any single changed character and most swaps of adjacent characters) before a database lookup.
+func stripCheckCharacter(code string) (string, error) {
+	if len(code) < 2 {
+		return "", invalidCheckCharacterError()
+	}
+	base := code[:len(code)-1]
+	check, ok := checkCharacter(base)
+	if !ok || check != code[len(code)-1] {
+		return "", invalidCheckCharacterError()
+	}
+	return base, nil
+}
+
+// invalidCheckCharacterError returns the error for a short URL with a wrong check character.
+func invalidCheckCharacterError() error {
+	badRequest := types.NewBadRequestError([]types.Details{
+		types.NewDetails("shortURL", "check character does not match, the short URL was probably mistyped"),
+	})
+	return types.NewValidationError(badRequest.Error(), badRequest)
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"log/slog"
 	"math/big"
+	"sync"
+	"time"
 
 	"github.com/pizza-nz/url-shortener/database"
 	"github.com/pizza-nz/url-shortener/types"
@@ -19,10 +21,28 @@ var (
 
 	// bigIntMax is the maximum value for the random number generator.
 	bigIntMax = big.NewInt(2000301)
+
+	// counterFallbacks counts how often the database counter failed and a random number was used instead.
+	counterFallbacks = types.NewGlobalCounter()
+	// fallbackLogInterval is the minimum time between two fallback warnings.
+	fallbackLogInterval = time.Minute
+	// fallbackLogMu guards lastFallbackLog and suppressedFallbacks.
+	fallbackLogMu sync.Mutex
+	// lastFallbackLog is the time the last fallback warning was logged.
+	lastFallbackLog time.Time
+	// suppressedFallbacks is the number of fallbacks not logged since the last warning.
+	suppressedFallbacks uint64
 )
 
+// CounterFallbacks returns the number of times CountersArr fell back to a random number
+// because the database counter failed.
+func CounterFallbacks() uint64 {
+	return counterFallbacks.Count()
+}
+
 // CountersArr returns an array of two uint64 values for generating a unique ID.
 // The first value is from a local counter, and the second is from the database counter or a random number.
+// The configured counter offset is added to both counters, so codes after a reset are not tiny and guessable.
 func (s *URLServiceImpl) CountersArr() []uint64 {
 	if counterDB == nil && !isInit {
 		err := s.initCounterDB()
@@ -30,15 +50,24 @@ func (s *URLServiceImpl) CountersArr() []uint64 {
 			slog.Error("Error in getting CountersArr", "error", err)
 		}
 	}
+	offset := s.counterOffset()
 	if counterDB == nil {
-		return []uint64{counterLocal.GetAndIncrement(), generateRandomUInt64()}
+		return []uint64{counterLocal.GetAndIncrement() + offset, generateRandomUInt64()}
 	}
 	counterFromDB, err := counterDB.GetAndIncreament()
 	if err != nil {
-		slog.Error("Counters Arr failed to get counter from DB, generating random number to use", "error", err)
-		counterFromDB = generateRandomUInt64()
+		recordCounterFallback(err)
+		return []uint64{counterLocal.GetAndIncrement() + offset, generateRandomUInt64()}
+	}
+	return []uint64{counterLocal.GetAndIncrement() + offset, counterFromDB + offset}
+}
+
+// counterOffset returns the configured starting offset for the counters.
+func (s *URLServiceImpl) counterOffset() uint64 {
+	if s.Config == nil {
+		return 0
 	}
-	return []uint64{counterLocal.GetAndIncrement(), counterFromDB}
+	return s.Config.CounterOffset
 }
 
 // initCounterDB initializes the database-backed counter.
@@ -48,11 +77,14 @@ func (s *URLServiceImpl) initCounterDB() error {
 	switch v := s.DBURLs.(type) {
 	case *database.DatabaseURLPGImpl:
 		counterDB = v
+		if s.Config != nil && s.Config.CounterBlockSize > 1 {
+			counterDB = newCounterBlock(v, s.Config.CounterBlockSize)
+		}
 		return nil
 	case nil:
 		return types.NewDBError("Counter DB wants to init before main service package", nil)
 	default:
-		return types.NewAppError("Service DB does not support Counter DB", "Internal is using map not postgres", 501, nil)
+		return types.NewNotImplementedError("Service DB does not support Counter DB, internal is using map not postgres", nil)
 	}
 }
 
@@ -66,4 +98,22 @@ func generateRandomUInt64() uint64 {
 	}
 
 	return n.Uint64()
-}
\ No newline at end of file
+}
+
+// recordCounterFallback increments the fallback metric and logs a warning.
+// The warning is rate-limited to one per fallbackLogInterval to avoid spamming the logs
+// while the database counter is down, the number of suppressed fallbacks is included.
+func recordCounterFallback(err error) {
+	counterFallbacks.Increment()
+
+	fallbackLogMu.Lock()
+	defer fallbackLogMu.Unlock()
+	if time.Since(lastFallbackLog) < fallbackLogInterval {
+		suppressedFallbacks++
+		return
+	}
+	slog.Warn("Counters Arr failed to get counter from DB, generating random number to use",
+		"error", err, "suppressed", suppressedFallbacks, "total", counterFallbacks.Count())
+	lastFallbackLog = time.Now()
+	suppressedFallbacks = 0
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/pizza-nz/url-shortener/database"
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// counterBlock hands out counter values locally from blocks allocated in a single database round trip,
+// reducing the pressure of bursty creation traffic on the connection pool.
+// Values of a block not handed out before a crash are skipped, never reused.
+type counterBlock struct {
+	mu     sync.Mutex
+	db     database.BlockCounterDatabase
+	size   uint64
+	values []uint64 // Values of the current block not handed out yet
+}
+
+// newCounterBlock creates a counterBlock allocating size values per round trip from db.
+func newCounterBlock(db database.BlockCounterDatabase, size uint64) *counterBlock {
+	return &counterBlock{
+		db:   db,
+		size: size,
+	}
+}
+
+// GetAndIncreament returns the next counter value, allocating a new block when the current one is exhausted.
+// Allocations are serialized, so at most one database connection is used for the counter at a time.
+func (c *counterBlock) GetAndIncreament() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.values) == 0 {
+		values, err := c.db.GetAndIncreamentBy(c.size)
+		if err != nil {
+			return 0, err
+		}
+		if len(values) == 0 {
+			return 0, types.NewDBError("Counter DB allocated an empty block", nil)
+		}
+		c.values = values
+	}
+	value := c.values[0]
+	c.values = c.values[1:]
+	return value, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/pizza-nz/url-shortener/database"
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// dedupIndex returns the database's dedup index if dedup is enabled and supported.
+func (s *URLServiceImpl) dedupIndex() (database.DedupIndex, bool) {
+	if !s.Config.Dedup {
+		return nil, false
+	}
+	index, ok := s.DBURLs.(database.DedupIndex)
+	return index, ok
+}
+
+// dedupHash returns the salted hash of the normalized longURL used as the dedup key,
+// so the index never holds the plaintext long URL and can't be reversed without the salt.
+func (s *URLServiceImpl) dedupHash(longURL string) string {
+	mac := hmac.New(sha256.New, []byte(s.Config.DedupSalt))
+	mac.Write([]byte(normalizeURL(longURL)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// indexLongURL indexes the new short key by the hash of its long URL if dedup is enabled,
+// so generated codes, aliases and upserts are all found by dedup and LookupLongURL.
+// A failure is logged, as the short URL has already been stored.
+func (s *URLServiceImpl) indexLongURL(key, longURL string) {
+	index, ok := s.dedupIndex()
+	if !ok {
+		return
+	}
+	if err := index.SetHash(key, s.dedupHash(longURL)); err != nil {
+		slog.Error("Failed to index long URL hash", "shortURL", key, "error", err)
+	}
+}
+
+// findDuplicate returns the existing short key of longURL, or "" if it wasn't shortened before.
+// Long URLs differing only in the case of the scheme and host are duplicates.
+// An indexed key whose long URL has since been replaced is ignored.
+func (s *URLServiceImpl) findDuplicate(index database.DedupIndex, hash, longURL string) (string, error) {
+	key, err := index.FindByHash(hash)
+	if err != nil {
+		if _, ok := err.(*types.NotFoundError); ok {
+			return "", nil
+		}
+		return "", types.NewInternalError("Failed to look up duplicate URL", err)
+	}
+
+	existing, err := s.DBURLs.Get(key)
+	if err != nil || !sameLongURL(existing, longURL) {
+		return "", nil
+	}
+	slog.Info("Returning existing short URL for duplicate long URL", "shortURL", key)
+	return key, nil
+}
+
+// LookupLongURL returns the existing short URL of longURL from the dedup index, so clients can check before creating one.
+// The long URL is prepared like on creation, e.g. with its redirects resolved, so it is found as it was stored.
+// The index holds a single key per hash, so at most one short URL is returned.
+// It returns 404 Not Found if Config.LongURLLookup is disabled or longURL wasn't shortened before.
+func (s *URLServiceImpl) LookupLongURL(longURL string) ([]string, error) {
+	index, ok := s.dedupIndex()
+	if !s.Config.LongURLLookup || !ok {
+		return nil, types.NewNotFoundAppError("Lookup by long URL is disabled", nil)
+	}
+
+	longURL, err := s.prepareLongURL(longURL)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.findDuplicate(index, s.dedupHash(longURL), longURL)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, types.NewNotFoundAppError("No short URL for long URL", nil)
+	}
+	return []string{s.publicURL(key)}, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// Resolver looks up the IP addresses of a host, net.DefaultResolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// dnsResult is a cached lookup, notFound is set for NXDOMAIN.
+type dnsResult struct {
+	addrs    []net.IPAddr
+	notFound bool
+	expires  time.Time
+}
+
+// HostResolver resolves long URL hosts with a timeout and caches the answers for ttl.
+// Only definite answers are cached, a timed out or failed lookup is retried on the next request.
+type HostResolver struct {
+	mu       sync.Mutex
+	resolver Resolver
+	timeout  time.Duration
+	ttl      time.Duration
+	cache    map[string]dnsResult
+	now      func() time.Time
+}
+
+// NewHostResolver creates a new HostResolver looking up hosts with resolver.
+func NewHostResolver(resolver Resolver, timeout, ttl time.Duration) *HostResolver {
+	return &HostResolver{
+		resolver: resolver,
+		timeout:  timeout,
+		ttl:      ttl,
+		cache:    make(map[string]dnsResult),
+		now:      time.Now,
+	}
+}
+
+// lookup returns the cached or freshly resolved answer for host.
+// A lookup error other than NXDOMAIN, e.g. a timeout, is returned as is and not cached.
+func (r *HostResolver) lookup(host string) (dnsResult, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && r.now().Before(cached.expires) {
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	addrs, err := r.resolver.LookupIPAddr(ctx, host)
+
+	result := dnsResult{addrs: addrs, expires: r.now().Add(r.ttl)}
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return dnsResult{}, err
+		}
+		result = dnsResult{notFound: true, expires: result.expires}
+	}
+
+	r.mu.Lock()
+	r.cache[host] = result
+	r.mu.Unlock()
+	return result, nil
+}
+
+// internalNets are the ranges not caught by the net.IP predicates used in isInternalIP.
+var internalNets = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"), // Carrier-grade NAT
+	mustParseCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustParseCIDR("198.18.0.0/15"), // Benchmarking
+	mustParseCIDR("64:ff9b::/96"),  // NAT64, may embed an internal IPv4 address
+}
+
+// mustParseCIDR parses a CIDR literal, panicking on invalid input.
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// isInternalIP reports whether ip is private, loopback, link-local, unspecified or otherwise internal,
+// e.g. RFC 1918, 127.0.0.0/8, 169.254.0.0/16, fc00::/7 and ::1.
+func isInternalIP(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, ipNet := range internalNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHost validates the host of a long URL as configured, rejecting with a BadRequestError:
+// with Config.ValidateDNS, a host that doesn't exist, and with Config.BlockPrivateIPs,
+// a host that is or resolves to an internal IP.
+// A slow or failing resolver lets the long URL through for DNS validation, so DNS outages don't block creation,
+// but is rejected when blocking private IPs, as the target can't be shown to be public.
+func (s *URLServiceImpl) validateHost(longURL string) error {
+	if s.Resolver == nil {
+		return nil
+	}
+	parsed, err := url.Parse(longURL)
+	if err != nil || parsed.Hostname() == "" {
+		return nil
+	}
+	host := parsed.Hostname()
+
+	if ip := net.ParseIP(host); ip != nil {
+		if s.Config.BlockPrivateIPs && isInternalIP(ip) {
+			return hostBadRequest("Long URL targets a private or internal address")
+		}
+		return nil
+	}
+
+	result, err := s.Resolver.lookup(host)
+	if err != nil {
+		if s.Config.BlockPrivateIPs {
+			slog.Warn("DNS lookup of long URL host failed, rejecting as it can't be checked", "host", host, "error", err)
+			return hostBadRequest("Long URL host could not be resolved")
+		}
+		slog.Warn("DNS lookup of long URL host failed, skipping validation", "host", host, "error", err)
+		return nil
+	}
+	if result.notFound {
+		if s.Config.ValidateDNS {
+			return hostBadRequest("Long URL host does not resolve")
+		}
+		return nil
+	}
+	if s.Config.BlockPrivateIPs {
+		for _, addr := range result.addrs {
+			if isInternalIP(addr.IP) {
+				slog.Warn("Rejected long URL host resolving to an internal address", "host", host, "ip", addr.IP.String())
+				return hostBadRequest("Long URL targets a private or internal address")
+			}
+		}
+	}
+	return nil
+}
+
+// hostBadRequest returns the BadRequestError for a long URL rejected by validateHost.
+func hostBadRequest(issue string) error {
+	badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", issue)})
+	return types.NewValidationError(badRequest.Error(), badRequest)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// eventBufferSize is the number of events buffered per subscriber before further events are dropped.
+const eventBufferSize = 64
+
+// EventBroker fans out events on the stored short URLs to subscribers, e.g. live dashboards.
+// Publishing never blocks: a subscriber whose buffer is full misses the event rather than slowing down creation.
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan types.Event]struct{}
+}
+
+// NewEventBroker creates a new instance of EventBroker without subscribers.
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: make(map[chan types.Event]struct{})}
+}
+
+// Subscribe returns a channel receiving every event published from now on, and a function to unsubscribe.
+// The channel is closed when unsubscribing.
+func (b *EventBroker) Subscribe() (<-chan types.Event, func()) {
+	ch := make(chan types.Event, eventBufferSize)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// HasSubscribers reports whether any subscriber would receive a published event,
+// so publishers can skip the work of building events nobody receives.
+func (b *EventBroker) HasSubscribers() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers) > 0
+}
+
+// Publish sends event to every subscriber with room in its buffer.
+func (b *EventBroker) Publish(event types.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.Debug("Dropped event for slow subscriber", "type", event.Type, "shortURL", event.ShortURL)
+		}
+	}
+}
+
+// publish publishes an event of eventType for the short URL stored at key.
+func (s *URLServiceImpl) publish(eventType, key, longURL string) {
+	if s.Events == nil {
+		return
+	}
+	s.Events.Publish(types.Event{Type: eventType, ShortURL: s.publicURL(key), LongURL: longURL, Time: time.Now().UTC()})
+}
+
+// SubscribeEvents returns a channel receiving the creation activity of the service, and a function to unsubscribe.
+func (s *URLServiceImpl) SubscribeEvents() (<-chan types.Event, func()) {
+	return s.Events.Subscribe()
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// errInternalTarget is returned when the fetch proxy refuses to connect to an internal address.
+var errInternalTarget = errors.New("target is a private or internal address")
+
+// ErrFetchTooLarge is returned reading a proxied response body beyond the configured maximum size.
+var ErrFetchTooLarge = errors.New("target response exceeds the maximum size")
+
+// TargetFetcher fetches long URLs server-side for clients that can't reach the internet directly.
+// Every connection, including those of redirects, is checked against the address actually dialed,
+// so a host can't pass validation and then resolve to an internal address (DNS rebinding).
+type TargetFetcher struct {
+	client       *http.Client
+	header       http.Header
+	maxBytes     int64
+	contentTypes []string
+}
+
+// NewTargetFetcher creates a new TargetFetcher fetching with timeout and the given outbound header.
+// Responses larger than maxBytes or with a media type outside contentTypes are refused.
+func NewTargetFetcher(timeout time.Duration, maxBytes int64, contentTypes []string, header http.Header) *TargetFetcher {
+	return newTargetFetcher(timeout, maxBytes, contentTypes, header, isInternalIP)
+}
+
+// newTargetFetcher creates a TargetFetcher refusing to connect to the addresses blocked reports.
+func newTargetFetcher(timeout time.Duration, maxBytes int64, contentTypes []string, header http.Header, blocked func(net.IP) bool) *TargetFetcher {
+	return &TargetFetcher{
+		client: &http.Client{
+			Transport: guardedTransport(timeout, blocked),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				return nil
+			},
+		},
+		header:       header,
+		maxBytes:     maxBytes,
+		contentTypes: contentTypes,
+	}
+}
+
+// guardedTransport creates the transport of server-side requests to long URLs, refusing with errInternalTarget
+// to connect to the addresses blocked reports. The check runs on the address actually dialed, for every connection.
+func guardedTransport(timeout time.Duration, blocked func(net.IP) bool) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blocked(ip) {
+				return errInternalTarget
+			}
+			return nil
+		},
+	}
+	// Environment proxies are not used, the dialed address must be the target
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+}
+
+// Fetch requests longURL and returns the response, with a body failing with ErrFetchTooLarge beyond the maximum size.
+// The caller must close the body.
+func (f *TargetFetcher) Fetch(ctx context.Context, longURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, longURL, nil)
+	if err != nil {
+		return nil, fetchError("Long URL can't be fetched", http.StatusBadGateway, err)
+	}
+	for name, values := range f.header {
+		req.Header[name] = values
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInternalTarget):
+			return nil, fetchError("Long URL targets a private or internal address", http.StatusForbidden, err)
+		case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+			return nil, fetchError("Long URL took too long to respond", http.StatusGatewayTimeout, err)
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, fetchError("Long URL took too long to respond", http.StatusGatewayTimeout, err)
+		}
+		return nil, fetchError("Long URL can't be fetched", http.StatusBadGateway, err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !slices.Contains(f.contentTypes, mediaType) {
+		resp.Body.Close()
+		return nil, fetchError(fmt.Sprintf("Long URL content type %q is not allowed", mediaType), http.StatusBadGateway, nil)
+	}
+	if resp.ContentLength > f.maxBytes {
+		resp.Body.Close()
+		return nil, fetchError("Long URL response is too large", http.StatusBadGateway, ErrFetchTooLarge)
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: f.maxBytes}
+	return resp, nil
+}
+
+// fetchError returns the AppError of a refused or failed fetch.
+func fetchError(message string, status int, err error) error {
+	return types.NewAppError(message, message, status, err)
+}
+
+// limitedBody is a response body failing with ErrFetchTooLarge once more than remaining bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrFetchTooLarge
+	}
+	// One byte past the limit tells a body of exactly the maximum size from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrFetchTooLarge
+	}
+	return n, err
+}
+
+// FetchLongURL fetches the long URL of a shortened URL server-side, without counting a hit.
+// It returns a 404 AppError if the fetch proxy is disabled. The caller must close the body of the response.
+func (s *URLServiceImpl) FetchLongURL(ctx context.Context, shortURL string) (*http.Response, error) {
+	if s.Fetcher == nil {
+		return nil, types.NewNotFoundAppError("Fetch proxy is disabled", nil)
+	}
+	record, err := s.GetRecord(shortURL)
+	if err != nil {
+		return nil, err
+	}
+	return s.Fetcher.Fetch(ctx, record.LongURL)
+}
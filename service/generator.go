@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+const (
+	// GeneratorSqids selects the default counter based sqids generator.
+	GeneratorSqids = "sqids"
+	// GeneratorHash selects the deterministic hash based generator.
+	GeneratorHash = "hash"
+	// GeneratorSequence selects the sequence generator, producing the same codes on every run for tests and demos.
+	GeneratorSequence = "sequence"
+
+	// defaultHashLength is the code length used by the hash generator when none is configured.
+	defaultHashLength = 7
+	// maxHashLength caps the base code length, leaving room in the ~43 character hash to extend on collisions.
+	maxHashLength = 32
+)
+
+// CodeGenerator generates the short code for a long URL.
+// Generate is called with attempt 0 first and again with an incremented attempt after each collision,
+// ok is false once the generator cannot produce another candidate.
+type CodeGenerator interface {
+	Generate(longURL string, attempt int) (code string, ok bool)
+
+	// Deterministic reports whether the same long URL always maps to the same code,
+	// in which case a collision with the same long URL is not a conflict.
+	Deterministic() bool
+}
+
+// maxBrandAttempts bounds the codes tried by the generator of a branded host before a collision is reported.
+const maxBrandAttempts = 5
+
+// sqidsGenerator generates codes from the counters with the sqids generator.
+// With the default alphabet it does not retry on collisions, as the counters are expected to be unique.
+// Branded alphabets share the counters, so a code of one alphabet can equal a code of another built from
+// different counters; a branded generator then retries with the next counters.
+type sqidsGenerator struct {
+	s     *URLServiceImpl
+	sqids *types.SqidsGen // Encoder of a branded host, nil uses the service's SqidsGen
+}
+
+// Generate returns a sqids code built from the next counters.
+func (g *sqidsGenerator) Generate(longURL string, attempt int) (string, bool) {
+	if attempt > 0 && (g.sqids == nil || attempt >= maxBrandAttempts) {
+		return "", false
+	}
+	sqids := g.sqids
+	if sqids == nil {
+		sqids = g.s.SqidsGen
+	}
+	return sqids.Generate(g.s.CountersArr()), true
+}
+
+// Deterministic returns false, as each call uses new counters.
+func (g *sqidsGenerator) Deterministic() bool {
+	return false
+}
+
+// sequenceGenerator generates sqids codes from a counter starting after a fixed value, without the database counter
+// or random component of sqidsGenerator, so every run produces the same sequence of codes.
+// It is meant for tests and demos, codes restart from the beginning after a restart and collide with stored ones.
+type sequenceGenerator struct {
+	sqids   *types.SqidsGen
+	start   uint64
+	counter *types.GlobalCounter
+}
+
+// NewSequenceGenerator creates a generator whose first code encodes start+1, the next start+2 and so on.
+func NewSequenceGenerator(start uint64) CodeGenerator {
+	return &sequenceGenerator{
+		sqids:   types.NewSqidsGen(),
+		start:   start,
+		counter: types.NewGlobalCounter(),
+	}
+}
+
+// Generate returns the sqids code of the next value in the sequence.
+func (g *sequenceGenerator) Generate(longURL string, attempt int) (string, bool) {
+	if attempt > 0 {
+		return "", false
+	}
+	return g.sqids.Generate([]uint64{g.start + g.counter.GetAndIncrement()}), true
+}
+
+// Deterministic returns false, as each call uses the next value.
+func (g *sequenceGenerator) Deterministic() bool {
+	return false
+}
+
+// hashGenerator derives codes from a truncated SHA-256 hash of the normalized long URL,
+// so identical URLs always map to the same code without a reverse lookup table.
+// Truncation collisions are handled by extending the code by one character per attempt.
+type hashGenerator struct {
+	length int
+}
+
+// newHashGenerator creates a hashGenerator producing codes of at least length characters.
+func newHashGenerator(length int) *hashGenerator {
+	if length <= 0 {
+		length = defaultHashLength
+	}
+	if length > maxHashLength {
+		length = maxHashLength
+	}
+	return &hashGenerator{length: length}
+}
+
+// Generate returns the hash of longURL truncated to the base length plus attempt characters.
+func (g *hashGenerator) Generate(longURL string, attempt int) (string, bool) {
+	encoded := hashEncode(normalizeURL(longURL))
+	n := g.length + attempt
+	if n > len(encoded) {
+		return "", false
+	}
+	return encoded[:n], true
+}
+
+// Deterministic returns true, as the code only depends on the long URL.
+func (g *hashGenerator) Deterministic() bool {
+	return true
+}
+
+// hashEncode returns the SHA-256 hash of s encoded with codeAlphabet.
+func hashEncode(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	n := new(big.Int).SetBytes(sum[:])
+	base := big.NewInt(int64(len(codeAlphabet)))
+	mod := new(big.Int)
+
+	var b strings.Builder
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		b.WriteByte(codeAlphabet[mod.Int64()])
+	}
+	return b.String()
+}
+
+// sameLongURL reports whether two long URLs are equivalent, comparing them in the normalized form codes are hashed from.
+func sameLongURL(a, b string) bool {
+	return normalizeURL(a) == normalizeURL(b)
+}
+
+// normalizeURL lowercases the scheme and host of a URL, so equivalent URLs hash to the same code.
+// URLs that fail to parse are returned unchanged.
+func normalizeURL(longURL string) string {
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return longURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
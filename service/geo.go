@@ -0,0 +1,257 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+const (
+	// GeoResolverNone disables resolving the client IP of visits.
+	GeoResolverNone = "none"
+	// GeoResolverMaxMind resolves the client IP of visits with the MaxMind GeoIP2 web service.
+	GeoResolverMaxMind = "maxmind"
+)
+
+// maxMindEndpoint is the GeoIP2 City web service, the client IP is appended to it.
+const maxMindEndpoint = "https://geoip.maxmind.com/geoip/v2.1/city/"
+
+// maxGeoResponseBytes bounds how much of a GeoIP response is read.
+const maxGeoResponseBytes = 64 << 10
+
+const (
+	// geoWorkers is the number of concurrent client IP lookups of visits.
+	geoWorkers = 4
+	// geoQueueSize is the number of visits waiting for a lookup before further visits are published without one.
+	geoQueueSize = 1024
+	// geoCacheSize is the number of client IPs whose location is cached.
+	geoCacheSize = 10000
+	// geoCacheTTL is how long the location of a client IP is cached.
+	geoCacheTTL = 24 * time.Hour
+)
+
+// GeoResolver resolves the country and network of client IPs, to annotate visit events for analytics.
+type GeoResolver interface {
+	// Lookup returns the location and network of ip, nil if it is unknown.
+	Lookup(ctx context.Context, ip net.IP) (*types.GeoInfo, error)
+}
+
+// NoopGeoResolver is a GeoResolver that knows no IP, visit events are published without annotation.
+type NoopGeoResolver struct{}
+
+// Lookup implements the GeoResolver interface for NoopGeoResolver.
+func (NoopGeoResolver) Lookup(ctx context.Context, ip net.IP) (*types.GeoInfo, error) {
+	return nil, nil
+}
+
+// MaxMindGeoResolver is a GeoResolver querying the MaxMind GeoIP2 web service.
+type MaxMindGeoResolver struct {
+	client     *http.Client
+	header     http.Header
+	endpoint   string
+	accountID  string
+	licenseKey string
+}
+
+// NewMaxMindGeoResolver creates a new MaxMindGeoResolver authenticating with accountID and licenseKey.
+// Requests time out after timeout and carry the given outbound header.
+func NewMaxMindGeoResolver(accountID, licenseKey string, timeout time.Duration, header http.Header) *MaxMindGeoResolver {
+	return &MaxMindGeoResolver{
+		client:     &http.Client{Timeout: timeout},
+		header:     header,
+		endpoint:   maxMindEndpoint,
+		accountID:  accountID,
+		licenseKey: licenseKey,
+	}
+}
+
+// maxMindResponse is the part of a GeoIP2 web service response used for visit events.
+type maxMindResponse struct {
+	Country struct {
+		ISOCode string `json:"iso_code"`
+	} `json:"country"`
+	Traits struct {
+		AutonomousSystemNumber uint32 `json:"autonomous_system_number"`
+	} `json:"traits"`
+}
+
+// Lookup implements the GeoResolver interface for MaxMindGeoResolver.
+// An IP unknown to MaxMind, e.g. a private one, is not an error.
+func (m *MaxMindGeoResolver) Lookup(ctx context.Context, ip net.IP) (*types.GeoInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint+url.PathEscape(ip.String()), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range m.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(m.accountID, m.licenseKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("GeoIP lookup of %s failed with status %d", ip, resp.StatusCode)
+	}
+
+	var body maxMindResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxGeoResponseBytes)).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.Country.ISOCode == "" && body.Traits.AutonomousSystemNumber == 0 {
+		return nil, nil
+	}
+	return &types.GeoInfo{Country: body.Country.ISOCode, ASN: body.Traits.AutonomousSystemNumber}, nil
+}
+
+// geoEntry is a cached location of a client IP, a nil geo records an IP unknown to the resolver.
+type geoEntry struct {
+	ip      string
+	geo     *types.GeoInfo
+	expires time.Time
+}
+
+// GeoCache caches the locations of client IPs for ttl, so repeat visitors don't cost another GeoIP lookup.
+// At most maxEntries IPs are kept, the least recently used are evicted first.
+type GeoCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element // Elements of order holding a *geoEntry
+	order      *list.List               // Entries from most to least recently used
+	now        func() time.Time
+}
+
+// NewGeoCache creates a new GeoCache keeping at most maxEntries locations for ttl.
+func NewGeoCache(ttl time.Duration, maxEntries int) *GeoCache {
+	return &GeoCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get returns the cached location of ip and whether it is cached, the location is nil for an IP unknown to the resolver.
+func (c *GeoCache) Get(ip string) (*types.GeoInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[ip]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*geoEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, ip)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.geo, true
+}
+
+// Add caches the location of ip, evicting the least recently used entries beyond the maximum.
+func (c *GeoCache) Add(ip string, geo *types.GeoInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &geoEntry{ip: ip, geo: geo, expires: c.now().Add(c.ttl)}
+	if element, ok := c.entries[ip]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[ip] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*geoEntry).ip)
+	}
+}
+
+// visitLookup is a visit event waiting for the location of its client IP.
+type visitLookup struct {
+	event types.Event
+	ip    net.IP
+}
+
+// RecordVisit publishes a visit event for a redirect of shortURL to longURL by the client at ip,
+// if visit events are enabled and anyone is subscribed to them.
+// With a GeoResolver, the event is annotated with the location of the client IP. Cached locations are used directly,
+// others are resolved in the background by geoWorkers workers so the redirect never waits for it.
+// Once geoQueueSize visits are waiting, further visits are published without a location rather than queued.
+// The IP itself is not part of the event. Queued visits only go to the event stream, which is closed on shutdown,
+// so they are abandoned rather than waited for.
+func (s *URLServiceImpl) RecordVisit(shortURL, longURL, ip string) {
+	if !s.Config.VisitEvents || s.Events == nil || !s.Events.HasSubscribers() {
+		return
+	}
+	event := types.Event{Type: types.EventVisited, ShortURL: shortURL, LongURL: longURL, Time: time.Now().UTC()}
+
+	clientIP := net.ParseIP(ip)
+	if _, noop := s.Geo.(NoopGeoResolver); s.Geo == nil || noop || clientIP == nil {
+		s.Events.Publish(event)
+		return
+	}
+	if geo, ok := s.geoCache.Get(clientIP.String()); ok {
+		event.Geo = geo
+		s.Events.Publish(event)
+		return
+	}
+
+	s.startGeoWorkers.Do(func() {
+		for i := 0; i < geoWorkers; i++ {
+			go s.resolveVisits()
+		}
+	})
+	select {
+	case s.geoQueue <- visitLookup{event: event, ip: clientIP}:
+	default:
+		slog.Debug("Visit lookup queue full, publishing without location", "shortURL", shortURL)
+		s.Events.Publish(event)
+	}
+}
+
+// resolveVisits annotates the queued visits with the location of their client IP and publishes them.
+func (s *URLServiceImpl) resolveVisits() {
+	for visit := range s.geoQueue {
+		visit.event.Geo = s.lookupGeo(visit.ip)
+		s.Events.Publish(visit.event)
+	}
+}
+
+// lookupGeo resolves the location of ip with the GeoResolver and caches it.
+// Only definite answers are cached, a failed lookup is retried on the next visit of the IP.
+func (s *URLServiceImpl) lookupGeo(ip net.IP) *types.GeoInfo {
+	ctx := context.Background()
+	if s.Config.GeoTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.Config.GeoTimeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	geo, err := s.Geo.Lookup(ctx, ip)
+	if err != nil {
+		slog.Warn("Failed to resolve the client IP of a visit", "error", err)
+		return nil
+	}
+	s.geoCache.Add(ip.String(), geo)
+	return geo
+}
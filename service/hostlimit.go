@@ -0,0 +1,94 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// HostRateLimiter limits the short URLs created per long URL host within a sliding window,
+// curbing abuse where one target domain is shortened thousands of times.
+// Counts are kept in memory, so each instance enforces the limit on its own: behind a load balancer
+// spreading creations over n instances, a host can create up to n times the limit.
+// The window slides by weighting the count of the previous fixed window by how much of it still overlaps,
+// so only the counts of two windows are kept, whatever the number of creations.
+type HostRateLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	start    time.Time      // Start of the current fixed window
+	current  map[string]int // Creations per host in the current window
+	previous map[string]int // Creations per host in the previous window
+	now      func() time.Time
+}
+
+// NewHostRateLimiter creates a new HostRateLimiter allowing limit creations per host within window.
+func NewHostRateLimiter(limit int, window time.Duration) *HostRateLimiter {
+	return &HostRateLimiter{
+		limit:    limit,
+		window:   window,
+		current:  make(map[string]int),
+		previous: make(map[string]int),
+		now:      time.Now,
+	}
+}
+
+// Allow records a creation for host if it is below the limit within the sliding window, and reports whether it is allowed.
+// A rejected creation also returns how long until the host is below the limit again.
+func (l *HostRateLimiter) Allow(host string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if elapsed := now.Sub(l.start); elapsed >= l.window {
+		if elapsed >= 2*l.window {
+			l.previous = make(map[string]int)
+		} else {
+			l.previous = l.current
+		}
+		l.current = make(map[string]int)
+		l.start = now.Truncate(l.window)
+	}
+
+	overlap := 1 - float64(now.Sub(l.start))/float64(l.window)
+	if float64(l.previous[host])*overlap+float64(l.current[host]) >= float64(l.limit) {
+		return false, l.retryAfter(now, host)
+	}
+	l.current[host]++
+	return true, 0
+}
+
+// retryAfter returns how long until the weighted count of host drops below the limit, l.mu must be held.
+// Below the limit in the current window, that is once enough of the previous window slid out;
+// otherwise the current window has to become the previous one and slide out far enough.
+func (l *HostRateLimiter) retryAfter(now time.Time, host string) time.Duration {
+	limit, previous, current := float64(l.limit), float64(l.previous[host]), float64(l.current[host])
+	at := l.start.Add(l.window).Add(time.Duration((1 - limit/current) * float64(l.window)))
+	if current < limit {
+		at = l.start.Add(time.Duration((1 - (limit-current)/previous) * float64(l.window)))
+	}
+	return at.Sub(now)
+}
+
+// limitHost records a creation for the host of longURL and rejects it with 429 Too Many Requests
+// once the host reached Config.HostCreationLimit. Long URLs without a host are not limited.
+func (s *URLServiceImpl) limitHost(longURL string) error {
+	if s.HostLimiter == nil {
+		return nil
+	}
+	parsed, err := url.Parse(longURL)
+	if err != nil || parsed.Hostname() == "" {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if ok, retryAfter := s.HostLimiter.Allow(host); !ok {
+		appErr := types.NewRateLimitError("Creation rate exceeded for long URL host "+host, nil)
+		appErr.Message = "Too many short URLs created for " + host + ", please retry later"
+		appErr.RetryAfter = retryAfter
+		return appErr
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"container/list"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// maxPreviewBytes bounds how much of a target page is read looking for OpenGraph tags,
+// they belong in the head so a large body is never needed.
+const maxPreviewBytes = 256 << 10
+
+// maxPreviewFieldLength bounds each returned OpenGraph value.
+const maxPreviewFieldLength = 1024
+
+var (
+	// metaTagPattern matches a meta tag, attribute values may contain '>' only if quoted.
+	metaTagPattern = regexp.MustCompile(`(?is)<meta\s(?:[^>"']|"[^"]*"|'[^']*')*>`)
+	// attrPattern matches an attribute with a double quoted, single quoted or unquoted value.
+	attrPattern = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// previewEntry is a cached preview, a nil preview records a target without OpenGraph tags or a failed fetch.
+type previewEntry struct {
+	longURL string
+	preview *types.LinkPreview
+	expires time.Time
+}
+
+// PreviewCache fetches the OpenGraph metadata of long URLs and caches it for ttl.
+// Failed fetches are cached as well, so an unreachable target isn't fetched again until the entry expires.
+// At most maxEntries previews are kept, the least recently used are evicted first.
+// Expired entries are dropped when they are looked up or evicted, so no operation scans the whole cache.
+type PreviewCache struct {
+	mu         sync.Mutex
+	client     *http.Client
+	header     http.Header
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element // Elements of order holding a *previewEntry
+	order      *list.List               // Entries from most to least recently used
+	now        func() time.Time
+}
+
+// NewPreviewCache creates a new PreviewCache fetching with timeout and the given outbound header,
+// caching at most maxEntries previews. Internal addresses are refused when dialed, like by the fetch proxy.
+// If validate is set, every redirect location is validated before it is followed.
+func NewPreviewCache(timeout, ttl time.Duration, maxEntries int, header http.Header, validate func(string) error) *PreviewCache {
+	return newPreviewCache(timeout, ttl, maxEntries, header, validate, isInternalIP)
+}
+
+// newPreviewCache creates a PreviewCache refusing to connect to the addresses blocked reports.
+func newPreviewCache(timeout, ttl time.Duration, maxEntries int, header http.Header, validate func(string) error, blocked func(net.IP) bool) *PreviewCache {
+	client := &http.Client{Transport: guardedTransport(timeout, blocked), Timeout: timeout}
+	if validate != nil {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return http.ErrUseLastResponse
+			}
+			return validate(req.URL.String())
+		}
+	}
+	return &PreviewCache{
+		client:     client,
+		header:     header,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get returns the cached preview of longURL without fetching it, so requests can't make the service fetch URLs.
+// It returns nil if the preview isn't cached or has expired, the target has no OpenGraph tags or couldn't be fetched.
+func (c *PreviewCache) Get(longURL string) *types.LinkPreview {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[longURL]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*previewEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, longURL)
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return entry.preview
+}
+
+// Fetch fetches the preview of longURL and caches it, evicting the least recently used entries beyond the maximum.
+func (c *PreviewCache) Fetch(longURL string) *types.LinkPreview {
+	preview, err := c.fetch(longURL)
+	if err != nil {
+		slog.Warn("Failed to fetch link preview", "longURL", longURL, "error", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &previewEntry{longURL: longURL, preview: preview, expires: c.now().Add(c.ttl)}
+	if element, ok := c.entries[longURL]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return preview
+	}
+	c.entries[longURL] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*previewEntry).longURL)
+	}
+	return preview
+}
+
+// Prefetch fetches the preview of longURL in the background.
+// The preview only fills the in-memory cache, so a fetch still running on shutdown is abandoned rather than waited for.
+func (c *PreviewCache) Prefetch(longURL string) {
+	go c.Fetch(longURL)
+}
+
+// fetch requests longURL and parses the OpenGraph tags of an HTML response.
+// A non-2xx or non-HTML response has no preview.
+func (c *PreviewCache) fetch(longURL string) (*types.LinkPreview, error) {
+	req, err := http.NewRequest(http.MethodGet, longURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, nil
+	}
+	return parseOpenGraph(io.LimitReader(resp.Body, maxPreviewBytes))
+}
+
+// parseOpenGraph reads the og:title, og:image and og:description meta tags from an HTML document.
+// The first occurrence of each tag wins. It returns nil if none of them are present.
+func parseOpenGraph(r io.Reader) (*types.LinkPreview, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &types.LinkPreview{}
+	for _, tag := range metaTagPattern.FindAll(body, -1) {
+		var property, content string
+		hasContent := false
+		for _, attr := range attrPattern.FindAllSubmatch(tag, -1) {
+			value := string(attr[2]) + string(attr[3]) + string(attr[4])
+			switch strings.ToLower(string(attr[1])) {
+			case "property", "name":
+				if property == "" {
+					property = strings.ToLower(value)
+				}
+			case "content":
+				content, hasContent = value, true
+			}
+		}
+		if !hasContent {
+			continue
+		}
+
+		var field *string
+		switch property {
+		case "og:title":
+			field = &preview.Title
+		case "og:image":
+			field = &preview.Image
+		case "og:description":
+			field = &preview.Description
+		default:
+			continue
+		}
+		if *field == "" {
+			*field = truncate(strings.TrimSpace(html.UnescapeString(content)), maxPreviewFieldLength)
+		}
+	}
+
+	if *preview == (types.LinkPreview{}) {
+		return nil, nil
+	}
+	return preview, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// prefetchPreview fetches the preview of a newly stored long URL in the background, if link previews are enabled.
+func (s *URLServiceImpl) prefetchPreview(longURL string) {
+	if s.Previews == nil {
+		return
+	}
+	s.Previews.Prefetch(longURL)
+}
+
+// GetLinkPreview returns the OpenGraph metadata of the long URL a shortened URL redirects to, as prefetched at creation.
+// It returns nil if link previews are disabled, the preview is no longer cached or the target has no OpenGraph tags.
+func (s *URLServiceImpl) GetLinkPreview(longURL string) *types.LinkPreview {
+	if s.Previews == nil {
+		return nil
+	}
+	return s.Previews.Get(longURL)
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// newReachabilityClient creates the client of reachability checks, which doesn't follow redirects
+// and refuses to connect to the addresses blocked reports, like the fetch proxy.
+func newReachabilityClient(timeout time.Duration, blocked func(net.IP) bool) *http.Client {
+	return &http.Client{
+		Transport: guardedTransport(timeout, blocked),
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkReachable sends a HEAD request to longURL, if Config.CheckReachable is set, and rejects it with a BadRequestError
+// if the target can't be reached or responds with a 4xx or 5xx status, so dead links aren't stored.
+// Redirects are not followed and count as reachable, as do 405 and 501 responses of servers that don't support HEAD.
+// Every failure gets the same error, so the check can't be used to probe which hosts and ports answer.
+func (s *URLServiceImpl) checkReachable(longURL string) error {
+	if s.Reachability == nil {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodHead, longURL, nil)
+	if err != nil {
+		return unreachableError()
+	}
+	for name, values := range s.Config.OutboundHeader {
+		req.Header[name] = values
+	}
+
+	resp, err := s.Reachability.Do(req)
+	if err != nil {
+		return unreachableError()
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		return nil
+	case resp.StatusCode >= 400:
+		return unreachableError()
+	}
+	return nil
+}
+
+// unreachableError returns the BadRequestError for a long URL failing the reachability check.
+func unreachableError() error {
+	badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Long URL is not reachable")})
+	return types.NewValidationError(badRequest.Error(), badRequest)
+}
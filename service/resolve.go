@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// resolveRedirects follows longURL through at most maxHops redirects and returns the final target,
+// so end users skip intermediate hops such as other shorteners.
+// A longer chain or a redirect loop, an unreachable target or a non-2xx final response
+// fails validation with a BadRequestError.
+// Only the configured header is sent, never headers of the incoming request.
+// If validate is set, every redirect location is validated before it is followed,
+// and if blocked is set, connections to the addresses it reports are refused when dialed, so a host can't pass
+// validation and then resolve to an internal address (DNS rebinding).
+func resolveRedirects(longURL string, maxHops int, timeout time.Duration, header http.Header, validate func(string) error, blocked func(net.IP) bool) (string, error) {
+	var redirectErr error
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			next := req.URL.String()
+			for _, previous := range via {
+				if previous.URL.String() == next {
+					redirectErr = resolveBadRequest("Long URL redirects in a loop")
+					return redirectErr
+				}
+			}
+			if len(via) > maxHops {
+				redirectErr = resolveBadRequest("Long URL redirects more than " + strconv.Itoa(maxHops) + " times")
+				return redirectErr
+			}
+			if validate != nil {
+				if err := validate(next); err != nil {
+					redirectErr = err
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	if blocked != nil {
+		client.Transport = guardedTransport(timeout, blocked)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, longURL, nil)
+	if err != nil {
+		return "", resolveBadRequest("Long URL could not be resolved")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if redirectErr != nil {
+			return "", redirectErr
+		}
+		if errors.Is(err, errInternalTarget) {
+			return "", resolveBadRequest("Long URL targets a private or internal address")
+		}
+		return "", resolveBadRequest("Long URL could not be resolved")
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", resolveBadRequest("Long URL responded with status " + strconv.Itoa(resp.StatusCode))
+	}
+	return resp.Request.URL.String(), nil
+}
+
+// resolveBadRequest returns the BadRequestError for a long URL failing redirect resolution.
+func resolveBadRequest(issue string) error {
+	return types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", issue)})
+}
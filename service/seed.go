@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pizza-nz/url-shortener/database"
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// Seed loads the short URLs of a seed file through the service, so operators can ship default links with the app.
+// Each entry is declared like PUT /v1/shorten/{shortURL}, so codes and long URLs are validated like any creation.
+// Codes that already exist are skipped, so seeding is idempotent across restarts, and so are rejected entries,
+// which are logged. Only a failure of the service itself, e.g. of the database, stops seeding.
+// It returns the number of added and skipped entries.
+func Seed(s URLService, path string) (added, skipped int, err error) {
+	entries, err := database.ReadSeedFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, entry := range entries {
+		_, created, err := s.UpsertShortenedURL(entry.ShortURL, entry.LongURL)
+		var appErr *types.AppError
+		switch {
+		case err == nil && created:
+			added++
+		case err == nil:
+			skipped++
+		case errors.As(err, &appErr) && appErr.HTTPStatus < http.StatusInternalServerError:
+			slog.Warn("Skipped seed entry", "shortURL", entry.ShortURL, "error", err)
+			skipped++
+		default:
+			return added, skipped, err
+		}
+	}
+	slog.Info("Database seeded", "file", path, "added", added, "skipped", skipped)
+
+	return added, skipped, nil
+}
@@ -1,9 +1,18 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/pizza-nz/url-shortener/config"
 	"github.com/pizza-nz/url-shortener/database"
 	"github.com/pizza-nz/url-shortener/types"
 )
@@ -14,50 +23,792 @@ type URLService interface {
 	// CreateShortenedURL creates a new shortened URL from a long URL.
 	CreateShortenedURL(longURL string) (string, error)
 
+	// CreateShortenedURLForHost creates a new shortened URL from a long URL requested on host,
+	// generated with the alphabet of the host if it is a branded domain.
+	CreateShortenedURLForHost(host, longURL string) (string, error)
+
 	// GetLongURL retrieves the long URL associated with a given shortened URL.
 	GetLongURL(shortURL string) (string, error)
+
+	// RecordHit counts a redirect of a shortened URL, if the backend counts hits.
+	RecordHit(shortURL string)
+
+	// CheckShortURLs reports the status of each of the given shortened URLs.
+	CheckShortURLs(shortURLs []string) (map[string]string, error)
+
+	// UpsertShortenedURL creates the shortened URL at the given code, or succeeds if it already has the same long URL.
+	// It returns the public short URL and whether it was created.
+	UpsertShortenedURL(shortURL, longURL string) (string, bool, error)
+
+	// CreateAliasedURL creates a shortened URL at a client chosen alias, failing if it already exists.
+	CreateAliasedURL(shortURL, longURL string) (string, error)
+
+	// RecordCreator records the IP that created the shortened URL, if recording is enabled.
+	RecordCreator(shortURL, ip string) error
+
+	// GetCreator retrieves the recorded creator of a shortened URL.
+	GetCreator(shortURL string) (types.Creator, error)
+
+	// GetHits reports the number of redirects of each of the given shortened URLs.
+	GetHits(shortURLs []string) (map[string]uint64, error)
+
+	// GetRecord returns the complete stored record of a shortened URL.
+	GetRecord(shortURL string) (*types.URLRecord, error)
+
+	// ListURLs returns a page of the stored shortened URLs and the total number of them.
+	ListURLs(limit, offset int) ([]types.URLEntry, int, error)
+
+	// ListURLsAfter returns a page of the stored shortened URLs after a cursor and the cursor of the next page.
+	ListURLsAfter(after string, limit int) ([]types.URLEntry, string, error)
+
+	// GetLinkPreview returns the cached OpenGraph metadata of a long URL, nil if link previews are disabled or it isn't cached.
+	GetLinkPreview(longURL string) *types.LinkPreview
+
+	// LookupLongURL returns the existing shortened URLs of a long URL, for clients checking before creating one.
+	LookupLongURL(longURL string) ([]string, error)
+
+	// FetchLongURL fetches the long URL of a shortened URL server-side, for clients that can't reach it.
+	FetchLongURL(ctx context.Context, shortURL string) (*http.Response, error)
+
+	// SubscribeEvents returns a channel receiving the creation activity of the service, and a function to unsubscribe.
+	SubscribeEvents() (<-chan types.Event, func())
+
+	// RecordVisit publishes a visit event for a redirect of a shortened URL by the client at ip, if enabled.
+	RecordVisit(shortURL, longURL, ip string)
+
+	// DecodeCounters returns the counter array a generated shortened URL was created from, for debugging.
+	DecodeCounters(shortURL string) []uint64
+
+	// BackendType returns the type of the storage backend used by the service.
+	BackendType() string
+
+	// Ready reports whether the storage backend is ready to serve queries.
+	Ready() bool
+}
+
+const (
+	// maxCheckBatchSize is the maximum number of short URLs accepted by CheckShortURLs.
+	maxCheckBatchSize = 100
+	// maxShortURLLength is the maximum length of a client chosen short URL.
+	maxShortURLLength = 64
+	// MaxListLimit is the maximum page size accepted by ListURLs.
+	MaxListLimit = 100
+
+	// InvalidCodesStrict rejects lookups of codes that can't exist with 400 Bad Request.
+	InvalidCodesStrict = "strict"
+	// InvalidCodesLenient answers lookups of codes that can't exist with 404 Not Found.
+	InvalidCodesLenient = "lenient"
+)
+
+// reservedShortURLs are the short URLs shadowed by fixed routes under /v1/shorten/, which could never be resolved.
+var reservedShortURLs = map[string]bool{
+	"check": true, // POST /v1/shorten/check
+	"stats": true, // POST /v1/shorten/stats
 }
 
 // URLServiceImpl is a concrete implementation of the URLService interface.
 // It uses a database for URL storage and a Sqids generator for creating short URLs.
 type URLServiceImpl struct {
-	DBURLs   database.Database // Database for storing URLs
-	SqidsGen *types.SqidsGen   // Sqids generator for creating short URLs
+	DBURLs    database.Database     // Database for storing URLs
+	SqidsGen  *types.SqidsGen       // Sqids generator for creating short URLs
+	Config    *config.ServiceConfig // Optional service behaviors
+	Generator CodeGenerator         // Generator for short codes, selected by Config.CodeGenerator
+	Resolver  *HostResolver         // Cached DNS resolver for long URL hosts, set if Config.ValidateDNS or Config.BlockPrivateIPs
+	Previews  *PreviewCache         // Cached OpenGraph metadata of long URLs, set if Config.LinkPreviews
+	Events    *EventBroker          // Subscribers to the creation activity
+	Fetcher   *TargetFetcher        // Server-side fetching of long URLs, set if Config.FetchProxy
+	Geo       GeoResolver           // Resolver annotating visit events, set if Config.VisitEvents
+
+	Reachability *http.Client               // Client of the long URL reachability check, set if Config.CheckReachable
+	HostLimiter  *HostRateLimiter           // Creation rate limit per long URL host, set if Config.HostCreationLimit
+	BrandSqids   map[string]*types.SqidsGen // Sqids generators of branded hosts, from Config.BrandAlphabetMap
+
+	geoQueue        chan visitLookup // Visits waiting for the location of their client IP
+	geoCache        *GeoCache        // Locations of recent client IPs
+	startGeoWorkers sync.Once        // Starts the workers of geoQueue on the first lookup
 }
 
 // NewURLService creates a new instance of URLService.
-// It initializes the URLServiceImpl with a database and a SqidsGen.
-func NewURLService(db database.Database) URLService {
-	return &URLServiceImpl{
-		DBURLs:   db,
-		SqidsGen: types.NewSqidsGen(),
+// It initializes the URLServiceImpl with a database, a SqidsGen and the service configuration.
+// A nil cfg uses the defaults, with every optional behavior disabled.
+func NewURLService(db database.Database, cfg *config.ServiceConfig) URLService {
+	return NewURLServiceWithGenerator(db, cfg, nil)
+}
+
+// NewURLServiceWithGenerator creates a new instance of URLService generating short codes with generator,
+// e.g. a NewSequenceGenerator for tests asserting exact codes. A nil generator uses the one selected by cfg.
+func NewURLServiceWithGenerator(db database.Database, cfg *config.ServiceConfig, generator CodeGenerator) URLService {
+	if cfg == nil {
+		cfg = &config.ServiceConfig{}
+	}
+	s := &URLServiceImpl{
+		DBURLs:    db,
+		SqidsGen:  types.NewSqidsGen(),
+		Config:    cfg,
+		Generator: generator,
+		Events:    NewEventBroker(),
+	}
+	switch {
+	case s.Generator != nil:
+	case cfg.CodeGenerator == GeneratorHash:
+		s.Generator = newHashGenerator(cfg.HashLength)
+	case cfg.CodeGenerator == GeneratorSequence:
+		s.Generator = NewSequenceGenerator(cfg.CounterOffset)
+	default:
+		s.Generator = &sqidsGenerator{s: s}
 	}
+	if cfg.ValidateDNS || cfg.BlockPrivateIPs {
+		s.Resolver = NewHostResolver(net.DefaultResolver, time.Duration(cfg.DNSTimeout)*time.Millisecond, time.Duration(cfg.DNSCacheTTL)*time.Second)
+	}
+	if cfg.LinkPreviews {
+		s.Previews = NewPreviewCache(time.Duration(cfg.LinkPreviewTimeout)*time.Millisecond, time.Duration(cfg.LinkPreviewTTL)*time.Second, cfg.LinkPreviewMax, cfg.OutboundHeader, s.validateHost)
+	}
+	if cfg.CheckReachable {
+		s.Reachability = newReachabilityClient(time.Duration(cfg.ReachableTimeout)*time.Millisecond, isInternalIP)
+	}
+	if cfg.FetchProxy {
+		s.Fetcher = NewTargetFetcher(time.Duration(cfg.FetchProxyTimeout)*time.Millisecond, cfg.FetchProxyMaxBytes, cfg.FetchProxyTypeList, cfg.OutboundHeader)
+	}
+	if cfg.HostCreationLimit > 0 {
+		s.HostLimiter = NewHostRateLimiter(cfg.HostCreationLimit, time.Duration(cfg.HostCreationWindow)*time.Millisecond)
+	}
+	if cfg.VisitEvents {
+		switch cfg.GeoResolver {
+		case GeoResolverMaxMind:
+			s.Geo = NewMaxMindGeoResolver(cfg.MaxMindAccountID, cfg.MaxMindLicenseKey, time.Duration(cfg.GeoTimeout)*time.Millisecond, cfg.OutboundHeader)
+		default:
+			s.Geo = NoopGeoResolver{}
+		}
+		s.geoQueue = make(chan visitLookup, geoQueueSize)
+		s.geoCache = NewGeoCache(geoCacheTTL, geoCacheSize)
+	}
+	for host, alphabet := range cfg.BrandAlphabetMap {
+		gen, err := types.NewSqidsGenWithAlphabet(alphabet)
+		if err != nil {
+			slog.Error("Invalid brand alphabet, using the default alphabet", "host", host, "error", err)
+			continue
+		}
+		if s.BrandSqids == nil {
+			s.BrandSqids = map[string]*types.SqidsGen{}
+		}
+		s.BrandSqids[host] = gen
+	}
+	return s
 }
 
 // CreateShortenedURL creates a new shortened URL from a long URL.
 // It generates a short URL, stores it in the database, and returns the short URL.
+// If the short URL already exists, the returned error wraps a ConflictError carrying the existing long URL.
+// With a deterministic generator, an existing code for the same long URL is returned as is,
+// and collisions with other long URLs are retried with the next candidate.
+// With dedup enabled, a long URL shortened before returns its existing short URL.
 func (s *URLServiceImpl) CreateShortenedURL(longURL string) (string, error) {
-	shortURL := s.SqidsGen.Generate(s.CountersArr())
-	if err := s.DBURLs.Set(shortURL, longURL); err != nil {
-		if _, ok := err.(*types.BadRequestError); ok {
-			return "", types.NewAppError("Bad request", "Invalid input data", http.StatusBadRequest, err)
+	return s.CreateShortenedURLForHost("", longURL)
+}
+
+// CreateShortenedURLForHost creates a new shortened URL from a long URL like CreateShortenedURL,
+// generating the code with the sqids alphabet of host if it is a branded domain, so its codes look distinct.
+// Codes are stored by their string, so they resolve on any host regardless of the alphabet.
+func (s *URLServiceImpl) CreateShortenedURLForHost(host, longURL string) (string, error) {
+	longURL, err := s.prepareLongURL(longURL)
+	if err != nil {
+		return "", err
+	}
+
+	index, dedup := s.dedupIndex()
+	var hash, shortURL string
+	if dedup {
+		hash = s.dedupHash(longURL)
+		if shortURL, err = s.findDuplicate(index, hash, longURL); err != nil {
+			return "", err
+		}
+	}
+
+	if shortURL == "" {
+		if err := s.limitHost(longURL); err != nil {
+			return "", err
+		}
+		if shortURL, err = s.storeShortenedURL(longURL, s.generatorFor(host)); err != nil {
+			return "", err
+		}
+		s.prefetchPreview(longURL)
+		s.publish(types.EventCreated, shortURL, longURL)
+		s.indexLongURL(shortURL, longURL)
+	}
+
+	return s.publicURL(shortURL), nil
+}
+
+// CreateAliasedURL creates a shortened URL at a client chosen alias.
+// Unlike UpsertShortenedURL it also rejects an existing alias with the same long URL, the returned error then wraps
+// a ConflictError carrying the existing long URL. The alias is given unsigned, the returned public short URL is signed
+// if SIGNCODES is on.
+func (s *URLServiceImpl) CreateAliasedURL(shortURL, longURL string) (string, error) {
+	if err := validateShortURL(shortURL); err != nil {
+		return "", types.NewValidationError(err.Error(), err)
+	}
+	key, err := s.aliasKey(shortURL)
+	if err != nil {
+		return "", err
+	}
+
+	longURL, err = s.prepareLongURL(longURL)
+	if err != nil {
+		return "", err
+	}
+	if err := s.limitHost(longURL); err != nil {
+		return "", err
+	}
+
+	if err := s.DBURLs.Set(key, longURL); err != nil {
+		if conflict, ok := err.(*types.ConflictError); ok {
+			return "", s.conflictError(conflict, key)
+		}
+		return "", writeError(err, "Failed to set URL")
+	}
+	slog.Info("Aliased URL created", "shortURL", shortURL, "longURL", longURL)
+	s.prefetchPreview(longURL)
+	s.publish(types.EventCreated, key, longURL)
+	s.indexLongURL(key, longURL)
+
+	return s.publicURL(key), nil
+}
+
+// UpsertShortenedURL declares the shortened URL at the given code idempotently: it creates the code,
+// or succeeds unchanged if the code already points at the same long URL.
+// An existing code is never replaced, so links can't be hijacked; the returned error then wraps a ConflictError
+// carrying the existing long URL. It returns the public short URL, signed if SIGNCODES is on, and whether it was created.
+func (s *URLServiceImpl) UpsertShortenedURL(shortURL, longURL string) (string, bool, error) {
+	if err := validateShortURL(shortURL); err != nil {
+		return "", false, types.NewValidationError(err.Error(), err)
+	}
+	key, err := s.aliasKey(shortURL)
+	if err != nil {
+		return "", false, err
+	}
+
+	longURL, err = s.prepareLongURL(longURL)
+	if err != nil {
+		return "", false, err
+	}
+
+	if existing, err := s.DBURLs.Get(key); err == nil {
+		if existing == longURL {
+			return s.publicURL(key), false, nil
+		}
+		return "", false, s.conflictError(types.NewConflictError(key), key)
+	} else if _, ok := err.(*types.NotFoundError); !ok {
+		return "", false, types.NewInternalError("Failed to get the existing URL", err)
+	}
+
+	if err := s.limitHost(longURL); err != nil {
+		return "", false, err
+	}
+	if err := s.DBURLs.Set(key, longURL); err != nil {
+		if conflict, ok := err.(*types.ConflictError); ok {
+			return "", false, s.conflictError(conflict, key)
+		}
+		return "", false, writeError(err, "Failed to set URL")
+	}
+	slog.Info("Shortened URL declared", "shortURL", shortURL, "longURL", longURL)
+	s.prefetchPreview(longURL)
+	s.publish(types.EventCreated, key, longURL)
+	s.indexLongURL(key, longURL)
+
+	return s.publicURL(key), true, nil
+}
+
+// generatorFor returns the code generator for requests on host: the sqids generator with the alphabet of host
+// if it is a branded domain, otherwise the service's generator. Other generators don't use an alphabet.
+func (s *URLServiceImpl) generatorFor(host string) CodeGenerator {
+	generator, ok := s.Generator.(*sqidsGenerator)
+	if !ok || len(s.BrandSqids) == 0 {
+		return s.Generator
+	}
+	host = strings.ToLower(host)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if sqids, ok := s.BrandSqids[host]; ok {
+		return &sqidsGenerator{s: generator.s, sqids: sqids}
+	}
+	return s.Generator
+}
+
+// storeShortenedURL generates a code for longURL with generator and stores it, retrying on collisions while the generator allows.
+func (s *URLServiceImpl) storeShortenedURL(longURL string, generator CodeGenerator) (string, error) {
+	var conflict *types.ConflictError
+	var conflictURL string
+	for attempt := 0; ; attempt++ {
+		shortURL, ok := generator.Generate(longURL, attempt)
+		if !ok {
+			return "", s.conflictError(conflict, conflictURL)
+		}
+		err := s.DBURLs.Set(shortURL, longURL)
+		if err == nil {
+			slog.Info("Shortened URL created", "shortURL", shortURL, "longURL", longURL)
+			return shortURL, nil
+		}
+
+		if conflict, ok = err.(*types.ConflictError); !ok {
+			return "", writeError(err, "Failed to set URL")
+		}
+		conflictURL = shortURL
+		if !generator.Deterministic() {
+			slog.Warn("Short URL collision, generating another", "shortURL", shortURL, "attempt", attempt+1)
+			continue
+		}
+
+		existing, err := s.DBURLs.Get(shortURL)
+		if err != nil {
+			return "", types.NewInternalError("Failed to get the existing URL on conflict", err)
+		}
+		if sameLongURL(existing, longURL) {
+			return shortURL, nil
+		}
+		slog.Warn("Hash collision, extending short URL", "shortURL", shortURL, "attempt", attempt+1)
+	}
+}
+
+// conflictError looks up the long URL of the existing key and wraps the conflict in a 409 AppError,
+// so the handler can point the client to the existing resource.
+func (s *URLServiceImpl) conflictError(conflict *types.ConflictError, shortURL string) error {
+	existing, err := s.DBURLs.Get(conflict.Key)
+	if err != nil {
+		return types.NewInternalError("Failed to get the existing URL on conflict", err)
+	}
+	conflict.LongURL = existing
+	conflict.Key = s.publicURL(shortURL)
+	return types.NewConflictAppError("Short URL already exists", conflict)
+}
+
+// prepareLongURL applies the configured processing to a long URL before it is stored.
+// It rejects long URLs that are not valid UTF-8, as they break logging and storage,
+// and with DNS validation or private IP blocking enabled, long URLs failing validateHost.
+func (s *URLServiceImpl) prepareLongURL(longURL string) (string, error) {
+	if !utf8.ValidString(longURL) {
+		badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Long URL is not valid UTF-8")})
+		return "", types.NewValidationError(badRequest.Error(), badRequest)
+	}
+
+	if err := s.rejectShortURL(longURL); err != nil {
+		return "", err
+	}
+
+	if err := s.validateHost(longURL); err != nil {
+		return "", err
+	}
+
+	if s.Config.ResolveRedirects > 0 {
+		var blocked func(net.IP) bool
+		if s.Config.BlockPrivateIPs {
+			blocked = isInternalIP
+		}
+		resolved, err := resolveRedirects(longURL, s.Config.ResolveRedirects, time.Duration(s.Config.ResolveTimeout)*time.Millisecond, s.Config.OutboundHeader, s.validateHost, blocked)
+		if err != nil {
+			return "", types.NewValidationError("Failed to resolve long URL redirects", err)
+		}
+		// Resolving already rejects targets that can't be reached
+		return resolved, nil
+	}
+
+	if err := s.checkReachable(longURL); err != nil {
+		return "", err
+	}
+	return longURL, nil
+}
+
+// rejectShortURL rejects a long URL on this service's own domain or a known shortener's with a BadRequestError,
+// if Config.RejectShortURLs is set, so short links don't chain through several redirects.
+// Subdomains of the listed domains are rejected as well.
+func (s *URLServiceImpl) rejectShortURL(longURL string) error {
+	if !s.Config.RejectShortURLs {
+		return nil
+	}
+	parsed, err := url.Parse(longURL)
+	if err != nil {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	for _, domain := range s.Config.ShortenerDomainList {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Long URL is already a short URL")})
+			return types.NewValidationError(badRequest.Error(), badRequest)
+		}
+	}
+	return nil
+}
+
+// writeError maps an error storing a URL to the response: a BadRequestError for a value the database rejected
+// becomes 400 Bad Request, a database outage keeps its 503 Service Unavailable and anything else is a 500.
+func writeError(err error, message string) error {
+	if _, ok := err.(*types.BadRequestError); ok {
+		return types.NewValidationError("Invalid input data", err)
+	}
+	if appErr, ok := err.(*types.AppError); ok && appErr.HTTPStatus == http.StatusServiceUnavailable {
+		return appErr
+	}
+	return types.NewInternalError(message, err)
+}
+
+// publicURL returns the public short URL of a database key, with the check character and signature, if enabled.
+func (s *URLServiceImpl) publicURL(key string) string {
+	if s.Config.CheckDigit {
+		key = appendCheckCharacter(key)
+	}
+	if s.Config.SignCodes {
+		key += s.codeSignature(key)
+	}
+	return key
+}
+
+// lookupKey returns the database key for a public short URL.
+// With signed codes or check digits enabled, the signature and check character are validated and stripped
+// before any database lookup.
+func (s *URLServiceImpl) lookupKey(shortURL string) (string, error) {
+	if s.Config.SignCodes {
+		var err error
+		if shortURL, err = s.stripSignature(shortURL); err != nil {
+			return "", err
+		}
+	}
+	if !s.Config.CheckDigit {
+		return shortURL, nil
+	}
+	return stripCheckCharacter(shortURL)
+}
+
+// aliasKey returns the database key of a client chosen short URL.
+// Clients can't compute code signatures, so an alias is given unsigned and signed by publicURL;
+// with check digits it must carry a valid check character, which clients can compute.
+// The check character counts towards maxShortURLLength, so the public short URL is at most that long before signing.
+func (s *URLServiceImpl) aliasKey(shortURL string) (string, error) {
+	if !s.Config.CheckDigit {
+		return shortURL, nil
+	}
+	return stripCheckCharacter(shortURL)
+}
+
+// validateShortURL checks that a client chosen short URL is non-empty, bounded in length
+// and only uses letters, digits, '-' and '_', so it is safe as a single path segment.
+// Codes in the reserved namespace, such as the health check sentinel, are rejected so clients can't claim them,
+// as are the reservedShortURLs shadowed by fixed routes.
+func validateShortURL(shortURL string) *types.BadRequestError {
+	if shortURL == "" || len(shortURL) > maxShortURLLength {
+		return types.NewBadRequestError([]types.Details{
+			types.NewDetails("shortURL", fmt.Sprintf("must be between 1 and %d characters", maxShortURLLength)),
+		})
+	}
+	if strings.HasPrefix(shortURL, database.ReservedPrefix) {
+		return types.NewBadRequestError([]types.Details{
+			types.NewDetails("shortURL", "may not start with "+database.ReservedPrefix+", it is reserved"),
+		})
+	}
+	if reservedShortURLs[shortURL] {
+		return types.NewBadRequestError([]types.Details{
+			types.NewDetails("shortURL", shortURL+" is reserved"),
+		})
+	}
+	for _, c := range shortURL {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return types.NewBadRequestError([]types.Details{
+				types.NewDetails("shortURL", "may only contain letters, digits, '-' and '_'"),
+			})
 		}
-		return "", types.NewAppError("Failed to set URL", "Internal server error", http.StatusInternalServerError, err)
 	}
-	slog.Info("Shortened URL created", "shortURL", shortURL, "longURL", longURL)
+	return nil
+}
 
-	return shortURL, nil
+// lookupExistingKey returns the database key of a shortened URL to look up.
+// A code that can't exist, as no generator or alias produces its length or characters, is rejected
+// without a database lookup: with 400 Bad Request if Config.InvalidCodes is strict, otherwise with 404 Not Found.
+// The signature is stripped first, as it is added to aliases after their validation.
+func (s *URLServiceImpl) lookupExistingKey(shortURL string) (string, error) {
+	code := shortURL
+	if s.Config.SignCodes {
+		var err error
+		if code, err = s.stripSignature(shortURL); err != nil {
+			return "", err
+		}
+	}
+	if badRequest := validateShortURL(code); badRequest != nil {
+		if s.Config.InvalidCodes == InvalidCodesStrict {
+			return "", types.NewValidationError(badRequest.Error(), badRequest)
+		}
+		return "", types.NewNotFoundAppError("Short URL can't exist", types.NewNotFoundError(shortURL))
+	}
+	if !s.Config.CheckDigit {
+		return code, nil
+	}
+	return stripCheckCharacter(code)
 }
 
 // GetLongURL retrieves the long URL associated with a given shortened URL.
-// It fetches the URL from the database and returns it.
+// It fetches the URL from the database and returns it, without counting a hit; see RecordHit.
 func (s *URLServiceImpl) GetLongURL(shortURL string) (string, error) {
+	shortURL, err := s.lookupExistingKey(shortURL)
+	if err != nil {
+		return "", err
+	}
+
 	URL, err := s.DBURLs.Get(shortURL)
 	if err != nil {
 		if _, ok := err.(*types.NotFoundError); ok {
-			return "", types.NewAppError("Not Found", "Service failed to get URL from map", http.StatusNotFound, err)
+			return "", types.NewNotFoundAppError("Service failed to get URL from map", err)
 		}
-		return "", types.NewAppError("Internal Server Error", "Failed to retrieve URL", http.StatusInternalServerError, err)
+		return "", types.NewInternalError("Failed to retrieve URL", err)
 	}
 	return URL, nil
-}
\ No newline at end of file
+}
+
+// RecordHit counts a redirect of shortURL if the backend is a HitCounter.
+// It is called by the redirect handler once the redirect is served, so lookups that aren't visits don't count.
+// Failures are logged, as the redirect has already been served.
+func (s *URLServiceImpl) RecordHit(shortURL string) {
+	counter, ok := s.DBURLs.(database.HitCounter)
+	if !ok {
+		return
+	}
+	key, err := s.lookupKey(shortURL)
+	if err != nil {
+		return
+	}
+	if err := counter.IncrementHits(key); err != nil {
+		slog.Error("Failed to increment hits", "shortURL", key, "error", err)
+	}
+}
+
+// CheckShortURLs reports the status of each of the given shortened URLs, active or not_found.
+// It uses the cheap Exists lookup and rejects empty batches or batches over maxCheckBatchSize.
+func (s *URLServiceImpl) CheckShortURLs(shortURLs []string) (map[string]string, error) {
+	if len(shortURLs) == 0 || len(shortURLs) > maxCheckBatchSize {
+		badRequest := types.NewBadRequestError([]types.Details{
+			types.NewDetails("shortURLs", fmt.Sprintf("must contain between 1 and %d short URLs", maxCheckBatchSize)),
+		})
+		return nil, types.NewValidationError(badRequest.Error(), badRequest)
+	}
+
+	results := make(map[string]string, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		key, err := s.lookupKey(shortURL)
+		if err != nil {
+			results[shortURL] = types.StatusNotFound
+			continue
+		}
+		exists, err := s.DBURLs.Exists(key)
+		if err != nil {
+			return nil, types.NewInternalError("Failed to check URL existence", err)
+		}
+		if exists {
+			results[shortURL] = types.StatusActive
+		} else {
+			results[shortURL] = types.StatusNotFound
+		}
+	}
+	return results, nil
+}
+
+// RecordCreator records the IP that created the shortened URL along with the current time.
+// Recording is opt-in for privacy, it is a no-op unless enabled and supported by the database.
+func (s *URLServiceImpl) RecordCreator(shortURL, ip string) error {
+	store, ok := s.DBURLs.(database.CreatorStore)
+	if !s.Config.RecordCreator || !ok {
+		return nil
+	}
+	key, err := s.lookupKey(shortURL)
+	if err != nil {
+		return err
+	}
+
+	if err := store.SetCreator(key, types.Creator{IP: ip, CreatedAt: time.Now().UTC()}); err != nil {
+		return types.NewInternalError("Failed to record creator", err)
+	}
+	return nil
+}
+
+// GetCreator retrieves the recorded creator of a shortened URL.
+// It returns a 404 AppError if no creator was recorded.
+func (s *URLServiceImpl) GetCreator(shortURL string) (types.Creator, error) {
+	key, err := s.lookupKey(shortURL)
+	if err != nil {
+		return types.Creator{}, err
+	}
+
+	store, ok := s.DBURLs.(database.CreatorStore)
+	if !ok {
+		return types.Creator{}, types.NewNotFoundAppError("Database does not record creators", nil)
+	}
+	creator, err := store.GetCreator(key)
+	if err != nil {
+		if _, ok := err.(*types.NotFoundError); ok {
+			return types.Creator{}, types.NewNotFoundAppError("No creator recorded for URL", err)
+		}
+		return types.Creator{}, types.NewInternalError("Failed to retrieve creator", err)
+	}
+	return creator, nil
+}
+
+// DecodeCounters returns the counter array a generated shortened URL was created from, for debugging.
+// It returns nil for codes not generated from counters, e.g. aliases or hash based codes.
+func (s *URLServiceImpl) DecodeCounters(shortURL string) []uint64 {
+	if _, ok := s.Generator.(*sqidsGenerator); !ok {
+		return nil
+	}
+	key, err := s.lookupKey(shortURL)
+	if err != nil {
+		return nil
+	}
+	return s.SqidsGen.Decode(key)
+}
+
+// BackendType returns the type of the storage backend used by the service.
+func (s *URLServiceImpl) BackendType() string {
+	return s.DBURLs.BackendType()
+}
+
+// Ready reports whether the storage backend is ready to serve queries.
+// Backends without a readiness state are always ready.
+func (s *URLServiceImpl) Ready() bool {
+	if readier, ok := s.DBURLs.(database.Readier); ok {
+		return readier.Ready()
+	}
+	return true
+}
+
+// GetHits reports the number of redirects of each of the given shortened URLs in one database call.
+// Short URLs that don't exist are omitted, and it rejects empty batches or batches over maxCheckBatchSize.
+func (s *URLServiceImpl) GetHits(shortURLs []string) (map[string]uint64, error) {
+	if len(shortURLs) == 0 || len(shortURLs) > maxCheckBatchSize {
+		badRequest := types.NewBadRequestError([]types.Details{
+			types.NewDetails("shortURLs", fmt.Sprintf("must contain between 1 and %d short URLs", maxCheckBatchSize)),
+		})
+		return nil, types.NewValidationError(badRequest.Error(), badRequest)
+	}
+
+	counter, ok := s.DBURLs.(database.HitCounter)
+	if !ok {
+		return nil, types.NewNotImplementedError("Database does not count hits", nil)
+	}
+
+	keys := make([]string, 0, len(shortURLs))
+	publicURLs := make(map[string]string, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		key, err := s.lookupKey(shortURL)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+		publicURLs[key] = shortURL
+	}
+
+	hits, err := counter.GetHits(keys)
+	if err != nil {
+		return nil, types.NewInternalError("Failed to get hits", err)
+	}
+
+	results := make(map[string]uint64, len(hits))
+	for key, count := range hits {
+		results[publicURLs[key]] = count
+	}
+	return results, nil
+}
+
+// ListURLs returns a page of the stored shortened URLs, ordered by code, and the total number of them.
+// It rejects a limit outside 1 to MaxListLimit or a negative offset.
+func (s *URLServiceImpl) ListURLs(limit, offset int) ([]types.URLEntry, int, error) {
+	details := []types.Details{}
+	if limit < 1 || limit > MaxListLimit {
+		details = append(details, types.NewDetails("limit", fmt.Sprintf("must be between 1 and %d", MaxListLimit)))
+	}
+	if offset < 0 {
+		details = append(details, types.NewDetails("offset", "cannot be negative"))
+	}
+	if len(details) > 0 {
+		badRequest := types.NewBadRequestError(details)
+		return nil, 0, types.NewValidationError(badRequest.Error(), badRequest)
+	}
+
+	lister, ok := s.DBURLs.(database.Lister)
+	if !ok {
+		return nil, 0, types.NewNotImplementedError("Database does not list URLs", nil)
+	}
+	entries, total, err := lister.List(limit, offset)
+	if err != nil {
+		return nil, 0, types.NewInternalError("Failed to list URLs", err)
+	}
+
+	for i := range entries {
+		entries[i].ShortURL = s.publicURL(entries[i].ShortURL)
+	}
+	return entries, total, nil
+}
+
+// ListURLsAfter returns up to limit stored shortened URLs ordered after the after cursor, a short URL,
+// with an empty cursor starting at the first. The returned cursor is the last short URL of the page,
+// or empty on the last page. Unlike offsets, cursors stay stable while URLs are created.
+// It rejects a limit outside 1 to MaxListLimit.
+func (s *URLServiceImpl) ListURLsAfter(after string, limit int) ([]types.URLEntry, string, error) {
+	if limit < 1 || limit > MaxListLimit {
+		badRequest := types.NewBadRequestError([]types.Details{
+			types.NewDetails("limit", fmt.Sprintf("must be between 1 and %d", MaxListLimit)),
+		})
+		return nil, "", types.NewValidationError(badRequest.Error(), badRequest)
+	}
+	if after != "" {
+		key, err := s.lookupKey(after)
+		if err != nil {
+			badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("after", "is not a short URL of a previous page")})
+			return nil, "", types.NewValidationError(badRequest.Error(), badRequest)
+		}
+		after = key
+	}
+
+	lister, ok := s.DBURLs.(database.Lister)
+	if !ok {
+		return nil, "", types.NewNotImplementedError("Database does not list URLs", nil)
+	}
+	// One extra entry tells whether there is a next page
+	entries, err := lister.ListAfter(after, limit+1)
+	if err != nil {
+		return nil, "", types.NewInternalError("Failed to list URLs", err)
+	}
+
+	next := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = entries[limit-1].ShortURL
+	}
+	for i := range entries {
+		entries[i].ShortURL = s.publicURL(entries[i].ShortURL)
+	}
+	if next != "" {
+		next = s.publicURL(next)
+	}
+	return entries, next, nil
+}
+
+// GetRecord returns the complete stored record of a shortened URL, without counting a hit.
+// Databases that can't return a full record report the long URL only.
+func (s *URLServiceImpl) GetRecord(shortURL string) (*types.URLRecord, error) {
+	key, err := s.lookupExistingKey(shortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var record *types.URLRecord
+	if store, ok := s.DBURLs.(database.RecordStore); ok {
+		record, err = store.GetRecord(key)
+	} else {
+		var longURL string
+		longURL, err = s.DBURLs.Get(key)
+		record = &types.URLRecord{LongURL: longURL}
+	}
+	if err != nil {
+		if _, ok := err.(*types.NotFoundError); ok {
+			return nil, types.NewNotFoundAppError("Service failed to get URL record", err)
+		}
+		return nil, types.NewInternalError("Failed to retrieve URL record", err)
+	}
+	record.ShortURL = shortURL
+	return record, nil
+}
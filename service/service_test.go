@@ -1,15 +1,30 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/pizza-nz/url-shortener/config"
+	"github.com/pizza-nz/url-shortener/database"
 	"github.com/pizza-nz/url-shortener/types"
 )
 
 // MockDatabase is a mock implementation of the Database interface for testing purposes.
 type MockDatabase struct {
-	GetFunc func(key string) (string, error)
-	SetFunc func(key, value string) error
+	GetFunc    func(key string) (string, error)
+	SetFunc    func(key, value string) error
+	ExistsFunc func(key string) (bool, error)
 }
 
 // Get mocks the Get method of the Database interface.
@@ -22,6 +37,21 @@ func (m *MockDatabase) Set(key, value string) error {
 	return m.SetFunc(key, value)
 }
 
+// Exists mocks the Exists method of the Database interface.
+func (m *MockDatabase) Exists(key string) (bool, error) {
+	return m.ExistsFunc(key)
+}
+
+// Close mocks the Close method of the Database interface.
+func (m *MockDatabase) Close() error {
+	return nil
+}
+
+// BackendType mocks the BackendType method of the Database interface.
+func (m *MockDatabase) BackendType() string {
+	return "mock"
+}
+
 // GetAndIncreament mocks the GetAndIncreament method of the CounterDatabase interface.
 func (m *MockDatabase) GetAndIncreament() (uint64, error) {
 	return 1, nil
@@ -35,7 +65,7 @@ func TestCreateShortenedURL(t *testing.T) {
 		},
 	}
 
-	service := NewURLService(mockDB)
+	service := NewURLService(mockDB, nil)
 
 	longURL := "http://example.com"
 	shortURL, err := service.CreateShortenedURL(longURL)
@@ -60,7 +90,7 @@ func TestGetLongURL(t *testing.T) {
 		},
 	}
 
-	service := NewURLService(mockDB)
+	service := NewURLService(mockDB, nil)
 
 	// Test case 1: Existing short URL
 	longURL, err := service.GetLongURL("exists")
@@ -79,8 +109,1862 @@ func TestGetLongURL(t *testing.T) {
 	}
 }
 
+// FailingCounterDatabase is a CounterDatabase whose counter always fails.
+type FailingCounterDatabase struct{}
+
+// GetAndIncreament always returns an error.
+func (f *FailingCounterDatabase) GetAndIncreament() (uint64, error) {
+	return 0, errors.New("counter table unavailable")
+}
+
+// TestCountersArrFallbackMetric tests that the fallback metric increments when the DB counter errors.
+func TestCountersArrFallbackMetric(t *testing.T) {
+	previous := counterDB
+	counterDB = &FailingCounterDatabase{}
+	defer func() { counterDB = previous }()
+
+	service := &URLServiceImpl{}
+	before := CounterFallbacks()
+
+	for i := 0; i < 3; i++ {
+		if arr := service.CountersArr(); len(arr) != 2 {
+			t.Fatalf("CountersArr() returned %d values, want 2", len(arr))
+		}
+	}
+
+	if got := CounterFallbacks() - before; got != 3 {
+		t.Errorf("CounterFallbacks() increased by %d, want 3", got)
+	}
+}
+
+// FixedCounterDatabase is a CounterDatabase that always returns the same value.
+type FixedCounterDatabase struct {
+	value uint64
+}
+
+// GetAndIncreament returns the fixed value.
+func (f *FixedCounterDatabase) GetAndIncreament() (uint64, error) {
+	return f.value, nil
+}
+
+// TestCountersArrOffset tests that the first code generated after a reset respects the counter offset.
+func TestCountersArrOffset(t *testing.T) {
+	previousLocal, previousDB := counterLocal, counterDB
+	defer func() { counterLocal, counterDB = previousLocal, previousDB }()
+
+	const offset = 1000000
+	generate := func(offset uint64) (string, []uint64) {
+		// Simulate a fresh deploy: both counters start at 1
+		counterLocal = types.NewGlobalCounter()
+		counterDB = &FixedCounterDatabase{value: 1}
+		service := NewURLService(nil, &config.ServiceConfig{CounterOffset: offset}).(*URLServiceImpl)
+		arr := service.CountersArr()
+		return service.SqidsGen.Generate(arr), arr
+	}
+
+	withoutOffset, _ := generate(0)
+	withOffset, arr := generate(offset)
+
+	if arr[0] != offset+1 || arr[1] != offset+1 {
+		t.Errorf("CountersArr() = %v, want [%d %d]", arr, offset+1, offset+1)
+	}
+	if len(withOffset) <= len(withoutOffset) {
+		t.Errorf("first code with offset %q is not longer than without %q", withOffset, withoutOffset)
+	}
+}
+
 // TestMain sets up the test environment.
 func TestMain(m *testing.M) {
 	isInit = true
 	m.Run()
-}
\ No newline at end of file
+}
+
+// TestCreateShortenedURLResolvesRedirects tests that redirect chains are resolved before storing,
+// and that chains longer than the maximum and loops are rejected.
+func TestCreateShortenedURLResolvesRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hop1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/hop2", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/hop2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop2", http.StatusFound)
+	})
+	mux.HandleFunc("/loop2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/missing", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		longURL  string
+		maxHops  int
+		expected string
+		wantErr  bool
+	}{
+		{"chain below max hops", server.URL + "/hop1", 5, server.URL + "/final", false},
+		{"chain at max hops", server.URL + "/hop1", 2, server.URL + "/final", false},
+		{"chain above max hops", server.URL + "/hop1", 1, "", true},
+		{"no redirect", server.URL + "/final", 1, server.URL + "/final", false},
+		{"fails on loop", server.URL + "/loop", 5, "", true},
+		{"fails on non-2xx termination", server.URL + "/broken", 5, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored string
+			mockDB := &MockDatabase{
+				SetFunc: func(key, value string) error {
+					stored = value
+					return nil
+				},
+			}
+			service := NewURLService(mockDB, &config.ServiceConfig{ResolveRedirects: tt.maxHops, ResolveTimeout: 1000})
+
+			_, err := service.CreateShortenedURL(tt.longURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateShortenedURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if stored != tt.expected {
+				t.Errorf("CreateShortenedURL() stored %v, want %v", stored, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCheckShortURLs tests the CheckShortURLs method of the URLService with existing and missing codes.
+func TestCheckShortURLs(t *testing.T) {
+	mockDB := &MockDatabase{
+		ExistsFunc: func(key string) (bool, error) {
+			return key == "exists" || key == "alsoexists", nil
+		},
+	}
+
+	service := NewURLService(mockDB, nil)
+
+	// Test case 1: Mix of existing and missing short URLs
+	results, err := service.CheckShortURLs([]string{"exists", "missing", "alsoexists"})
+	if err != nil {
+		t.Fatalf("CheckShortURLs() error = %v, wantErr nil", err)
+	}
+	expected := map[string]string{
+		"exists":     types.StatusActive,
+		"missing":    types.StatusNotFound,
+		"alsoexists": types.StatusActive,
+	}
+	for shortURL, want := range expected {
+		if got := results[shortURL]; got != want {
+			t.Errorf("CheckShortURLs()[%v] = %v, want %v", shortURL, got, want)
+		}
+	}
+
+	// Test case 2: Empty batch
+	if _, err := service.CheckShortURLs(nil); err == nil {
+		t.Error("Expected an error for an empty batch, but got nil")
+	}
+
+	// Test case 3: Batch over the limit
+	if _, err := service.CheckShortURLs(make([]string, maxCheckBatchSize+1)); err == nil {
+		t.Error("Expected an error for an oversized batch, but got nil")
+	}
+}
+
+// TestUpsertShortenedURLValidation tests that client chosen short URLs are validated before upserting.
+func TestUpsertShortenedURLValidation(t *testing.T) {
+	mockDB := &MockDatabase{
+		GetFunc: func(key string) (string, error) {
+			return "", types.NewNotFoundError(key)
+		},
+		SetFunc: func(key, value string) error {
+			return nil
+		},
+	}
+
+	service := NewURLService(mockDB, nil)
+
+	// Test case 1: Valid short URL
+	if _, _, err := service.UpsertShortenedURL("my-link_1", "http://example.com"); err != nil {
+		t.Errorf("UpsertShortenedURL() error = %v, wantErr nil", err)
+	}
+
+	// Test case 2: Invalid short URLs
+	for _, shortURL := range []string{"", "a/b", "with space", strings.Repeat("a", maxShortURLLength+1), "__healthcheck__", "__other", "check", "stats"} {
+		if _, _, err := service.UpsertShortenedURL(shortURL, "http://example.com"); err == nil {
+			t.Errorf("Expected an error for short URL %q, but got nil", shortURL)
+		}
+	}
+}
+
+// TestUpsertShortenedURLNoReplace tests that PUT declares codes idempotently but never replaces an existing target,
+// so anonymous clients can't hijack links.
+func TestUpsertShortenedURLNoReplace(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewURLService(db, nil)
+
+	if _, created, err := service.UpsertShortenedURL("docs", "http://example.com/v1"); err != nil || !created {
+		t.Fatalf("UpsertShortenedURL() = %v, %v, want created", created, err)
+	}
+	if _, created, err := service.UpsertShortenedURL("docs", "http://example.com/v1"); err != nil || created {
+		t.Errorf("UpsertShortenedURL() with the same long URL = %v, %v, want unchanged", created, err)
+	}
+
+	_, _, err = service.UpsertShortenedURL("docs", "http://attacker.example")
+	var conflict *types.ConflictError
+	if !errors.As(err, &conflict) || conflict.LongURL != "http://example.com/v1" {
+		t.Errorf("UpsertShortenedURL() with another long URL error = %v, want a conflict with the existing long URL", err)
+	}
+	if longURL, _ := service.GetLongURL("docs"); longURL != "http://example.com/v1" {
+		t.Errorf("GetLongURL() = %v, want the original long URL", longURL)
+	}
+}
+
+// TestCheckDigit tests that generated codes carry a check character and corrupted codes are rejected.
+func TestCheckDigit(t *testing.T) {
+	stored := map[string]string{}
+	mockDB := &MockDatabase{
+		SetFunc: func(key, value string) error {
+			stored[key] = value
+			return nil
+		},
+		GetFunc: func(key string) (string, error) {
+			if value, ok := stored[key]; ok {
+				return value, nil
+			}
+			return "", types.NewNotFoundError(key)
+		},
+	}
+
+	service := NewURLService(mockDB, &config.ServiceConfig{CheckDigit: true})
+
+	shortURL, err := service.CreateShortenedURL("http://example.com")
+	if err != nil {
+		t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+	if _, ok := stored[shortURL[:len(shortURL)-1]]; !ok {
+		t.Fatalf("CreateShortenedURL() = %v, expected the code without check character to be stored", shortURL)
+	}
+
+	// Test case 1: Valid code resolves
+	if longURL, err := service.GetLongURL(shortURL); err != nil || longURL != "http://example.com" {
+		t.Errorf("GetLongURL() = %v, %v, want %v, nil", longURL, err, "http://example.com")
+	}
+
+	// Test case 2: Corrupted codes are rejected with a 400 before the lookup
+	corrupted := []string{
+		shortURL[:len(shortURL)-1] + string(nextAlphabetChar(shortURL[len(shortURL)-1])), // wrong check character
+		string(nextAlphabetChar(shortURL[0])) + shortURL[1:],                             // mistyped first character
+	}
+	for _, code := range corrupted {
+		_, err := service.GetLongURL(code)
+		var appErr *types.AppError
+		if !errors.As(err, &appErr) || appErr.HTTPStatus != http.StatusBadRequest {
+			t.Errorf("GetLongURL(%v) error = %v, want a 400 AppError", code, err)
+		}
+	}
+}
+
+// nextAlphabetChar returns the character following c in the check digit alphabet.
+func nextAlphabetChar(c byte) byte {
+	i := strings.IndexByte(codeAlphabet, c)
+	return codeAlphabet[(i+1)%len(codeAlphabet)]
+}
+
+// TestCreateShortenedURLConflict tests that a colliding code returns a 409 pointing to the existing resource.
+func TestCreateShortenedURLConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		longURL  string
+	}{
+		{"matching target", "http://example.com", "http://example.com"},
+		{"differing target", "http://example.org", "http://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := &MockDatabase{
+				SetFunc: func(key, value string) error {
+					return types.NewConflictError(key)
+				},
+				GetFunc: func(key string) (string, error) {
+					return tt.existing, nil
+				},
+			}
+
+			service := NewURLService(mockDB, nil)
+
+			_, err := service.CreateShortenedURL(tt.longURL)
+			var appErr *types.AppError
+			if !errors.As(err, &appErr) || appErr.HTTPStatus != http.StatusConflict {
+				t.Fatalf("CreateShortenedURL() error = %v, want a 409 AppError", err)
+			}
+			var conflict *types.ConflictError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("CreateShortenedURL() error = %v, want a wrapped ConflictError", err)
+			}
+			if conflict.LongURL != tt.existing {
+				t.Errorf("ConflictError.LongURL = %v, want %v", conflict.LongURL, tt.existing)
+			}
+		})
+	}
+}
+
+// TestHashGeneratorDeterministic tests that the hash generator maps equivalent URLs to the same code.
+func TestHashGeneratorDeterministic(t *testing.T) {
+	mockDB := &MockDatabase{
+		SetFunc: func(key, value string) error {
+			return nil
+		},
+	}
+	service := NewURLService(mockDB, &config.ServiceConfig{CodeGenerator: GeneratorHash, HashLength: 8})
+
+	first, err := service.CreateShortenedURL("http://example.com/path")
+	if err != nil {
+		t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+	second, err := service.CreateShortenedURL("HTTP://EXAMPLE.com/path")
+	if err != nil {
+		t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+	if first != second {
+		t.Errorf("CreateShortenedURL() = %v and %v, want the same code", first, second)
+	}
+	if len(first) != 8 {
+		t.Errorf("CreateShortenedURL() = %v, want 8 characters", first)
+	}
+
+	other, _ := service.CreateShortenedURL("http://example.com/other")
+	if other == first {
+		t.Errorf("CreateShortenedURL() = %v for different URLs, want different codes", other)
+	}
+}
+
+// TestHashGeneratorCollision tests that the hash generator extends the code on truncation collisions
+// and returns the existing code when the same URL was already shortened.
+func TestHashGeneratorCollision(t *testing.T) {
+	cfg := &config.ServiceConfig{CodeGenerator: GeneratorHash}
+	longURL := "http://example.com"
+	stored := map[string]string{}
+	mockDB := &MockDatabase{
+		SetFunc: func(key, value string) error {
+			if _, ok := stored[key]; ok {
+				return types.NewConflictError(key)
+			}
+			stored[key] = value
+			return nil
+		},
+		GetFunc: func(key string) (string, error) {
+			return stored[key], nil
+		},
+	}
+	service := NewURLService(mockDB, cfg)
+
+	// Test case 1: A different URL already holds the truncated hash
+	base, _ := newHashGenerator(cfg.HashLength).Generate(longURL, 0)
+	stored[base] = "http://example.org"
+
+	shortURL, err := service.CreateShortenedURL(longURL)
+	if err != nil {
+		t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+	if len(shortURL) != len(base)+1 || shortURL[:len(base)] != base {
+		t.Errorf("CreateShortenedURL() = %v, want %v extended by one character", shortURL, base)
+	}
+
+	// Test case 2: Shortening the same URL again returns the existing code
+	again, err := service.CreateShortenedURL(longURL)
+	if err != nil {
+		t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+	if again != shortURL {
+		t.Errorf("CreateShortenedURL() = %v, want %v", again, shortURL)
+	}
+
+	// Test case 3: An equivalent URL hashes to the same code and is not taken for a collision
+	equivalent, err := service.CreateShortenedURL("HTTP://Example.COM")
+	if err != nil {
+		t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+	if equivalent != shortURL {
+		t.Errorf("CreateShortenedURL() of an equivalent URL = %v, want %v", equivalent, shortURL)
+	}
+}
+
+// TestSequenceGenerator tests that the sequence generator produces the same fixed codes on every run,
+// whether injected or selected by the configuration.
+func TestSequenceGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		service func(db database.Database) URLService
+		want    []string
+	}{
+		{"injected", func(db database.Database) URLService {
+			return NewURLServiceWithGenerator(db, nil, NewSequenceGenerator(0))
+		}, []string{"Uk", "gb", "Ef"}},
+		{"configured with offset", func(db database.Database) URLService {
+			return NewURLService(db, &config.ServiceConfig{CodeGenerator: GeneratorSequence, CounterOffset: 1000})
+		}, []string{"nIN", "9VT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for run := 0; run < 2; run++ {
+				db, err := database.StartNewDatabase(&config.DBConfig{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				service := tt.service(db)
+				for i, want := range tt.want {
+					shortURL, err := service.CreateShortenedURL("http://example.com/" + strconv.Itoa(i))
+					if err != nil {
+						t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+					}
+					if shortURL != want {
+						t.Errorf("CreateShortenedURL() run %d = %v, want %v", run, shortURL, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCreateAliasedURL tests that an alias is created at the given code and never replaces an existing one.
+func TestCreateAliasedURL(t *testing.T) {
+	stored := map[string]string{"taken": "http://example.org"}
+	mockDB := &MockDatabase{
+		SetFunc: func(key, value string) error {
+			if _, ok := stored[key]; ok {
+				return types.NewConflictError(key)
+			}
+			stored[key] = value
+			return nil
+		},
+		GetFunc: func(key string) (string, error) {
+			return stored[key], nil
+		},
+	}
+	service := NewURLService(mockDB, nil)
+
+	// Test case 1: Free alias
+	shortURL, err := service.CreateAliasedURL("my-link", "http://example.com")
+	if err != nil || shortURL != "my-link" || stored["my-link"] != "http://example.com" {
+		t.Errorf("CreateAliasedURL() = %v, %v, want my-link stored", shortURL, err)
+	}
+
+	// Test case 2: Taken alias
+	_, err = service.CreateAliasedURL("taken", "http://example.com")
+	var conflict *types.ConflictError
+	if !errors.As(err, &conflict) || conflict.LongURL != "http://example.org" {
+		t.Errorf("CreateAliasedURL() error = %v, want a ConflictError with the existing long URL", err)
+	}
+	if stored["taken"] != "http://example.org" {
+		t.Errorf("CreateAliasedURL() replaced an existing alias")
+	}
+
+	// Test case 3: Invalid alias
+	if _, err := service.CreateAliasedURL("bad alias", "http://example.com"); err == nil {
+		t.Error("Expected an error for an invalid alias, but got nil")
+	}
+
+	// Test case 4: Aliases shadowed by fixed routes are reserved
+	for _, alias := range []string{"check", "stats"} {
+		if _, err := service.CreateAliasedURL(alias, "http://example.com"); !hasStatus(err, http.StatusBadRequest) {
+			t.Errorf("CreateAliasedURL(%v) error = %v, want status %v", alias, err, http.StatusBadRequest)
+		}
+	}
+}
+
+// TestResolveRedirectsOutboundHeaders tests that outbound requests only carry the configured headers.
+func TestResolveRedirectsOutboundHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("X-Service-Token", "secret")
+
+	if _, err := resolveRedirects(server.URL, 1, time.Second, header, nil, nil); err != nil {
+		t.Fatalf("resolveRedirects() error = %v, wantErr nil", err)
+	}
+	if got := received.Get("X-Service-Token"); got != "secret" {
+		t.Errorf("X-Service-Token = %v, want secret", got)
+	}
+	for name := range received {
+		switch name {
+		case "X-Service-Token", "User-Agent", "Accept-Encoding":
+		default:
+			t.Errorf("Unexpected outbound header %v", name)
+		}
+	}
+}
+
+// TestResolveRedirectsBlocksInternal tests that a host passing validation but dialing an internal address,
+// as after DNS rebinding, is refused when the connection is made.
+func TestResolveRedirectsBlocksInternal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Internal target was requested")
+	}))
+	defer server.Close()
+
+	_, err := resolveRedirects(server.URL, 1, time.Second, nil, func(string) error { return nil }, isInternalIP)
+	var badRequest *types.BadRequestError
+	if !errors.As(err, &badRequest) || !strings.Contains(err.Error(), "private or internal address") {
+		t.Errorf("resolveRedirects() of a loopback address error = %v, want a BadRequestError for an internal address", err)
+	}
+}
+
+// TestRecordCreator tests that the creator is recorded when enabled and omitted when disabled.
+func TestRecordCreator(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{"enabled", true},
+		{"disabled", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.StartNewDatabase(&config.DBConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			service := NewURLService(db, &config.ServiceConfig{RecordCreator: tt.enabled})
+
+			shortURL, err := service.CreateAliasedURL("abc", "http://example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := service.RecordCreator(shortURL, "203.0.113.7"); err != nil {
+				t.Fatalf("RecordCreator() error = %v, wantErr nil", err)
+			}
+
+			creator, err := service.GetCreator(shortURL)
+			if tt.enabled {
+				if err != nil || creator.IP != "203.0.113.7" || creator.CreatedAt.IsZero() {
+					t.Errorf("GetCreator() = %v, %v, want the recorded IP and time", creator, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("GetCreator() = %v, want a not found error with recording disabled", creator)
+			}
+		})
+	}
+}
+
+// BlockCounterDatabase is a mock implementation of the BlockCounterDatabase interface counting round trips.
+type BlockCounterDatabase struct {
+	mu         sync.Mutex
+	counter    uint64
+	roundTrips int
+}
+
+// GetAndIncreamentBy mocks the GetAndIncreamentBy method of the BlockCounterDatabase interface.
+func (b *BlockCounterDatabase) GetAndIncreamentBy(n uint64) ([]uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roundTrips++
+	values := make([]uint64, n)
+	for i := range values {
+		b.counter++
+		values[i] = b.counter
+	}
+	return values, nil
+}
+
+// TestCounterBlock tests that block allocation hands out unique, consecutive values with one round trip per block.
+func TestCounterBlock(t *testing.T) {
+	db := &BlockCounterDatabase{counter: 1}
+	block := newCounterBlock(db, 10)
+
+	const workers, perWorker = 5, 20
+	values := make(chan uint64, workers*perWorker)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				value, err := block.GetAndIncreament()
+				if err != nil {
+					t.Errorf("GetAndIncreament() error = %v, wantErr nil", err)
+					return
+				}
+				values <- value
+			}
+		}()
+	}
+	wg.Wait()
+	close(values)
+
+	seen := map[uint64]bool{}
+	for value := range values {
+		if seen[value] {
+			t.Errorf("GetAndIncreament() returned %v twice", value)
+		}
+		seen[value] = true
+	}
+	for value := uint64(2); value < 2+workers*perWorker; value++ {
+		if !seen[value] {
+			t.Errorf("GetAndIncreament() never returned %v", value)
+		}
+	}
+	if db.roundTrips != workers*perWorker/10 {
+		t.Errorf("round trips = %v, want %v", db.roundTrips, workers*perWorker/10)
+	}
+}
+
+// BenchmarkCounterBlock benchmarks handing out counter values from blocks of different sizes.
+func BenchmarkCounterBlock(b *testing.B) {
+	for _, size := range []uint64{1, 100} {
+		b.Run(strconv.FormatUint(size, 10), func(b *testing.B) {
+			block := newCounterBlock(&BlockCounterDatabase{}, size)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := block.GetAndIncreament(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// TestGetHits tests that redirects are counted and reported in one batch.
+func TestGetHits(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewURLService(db, nil)
+	if _, err := service.CreateAliasedURL("abc", "http://example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.GetLongURL("abc"); err != nil {
+			t.Fatal(err)
+		}
+		service.RecordHit("abc")
+	}
+	// A lookup alone isn't a visit
+	if _, err := service.GetLongURL("abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := service.GetHits([]string{"abc", "missing"})
+	if err != nil {
+		t.Fatalf("GetHits() error = %v, wantErr nil", err)
+	}
+	if len(hits) != 1 || hits["abc"] != 2 {
+		t.Errorf("GetHits() = %v, want map[abc:2]", hits)
+	}
+
+	if _, err := service.GetHits(nil); err == nil {
+		t.Error("Expected an error for an empty batch, but got nil")
+	}
+}
+
+// TestDecodeCounters tests that generated codes decode to the counters they were created from.
+func TestDecodeCounters(t *testing.T) {
+	mockDB := &MockDatabase{
+		SetFunc: func(key, value string) error {
+			return nil
+		},
+	}
+	service := NewURLService(mockDB, nil).(*URLServiceImpl)
+
+	shortURL, err := service.CreateShortenedURL("http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters := service.DecodeCounters(shortURL)
+	if len(counters) != 2 || service.SqidsGen.Generate(counters) != shortURL {
+		t.Errorf("DecodeCounters(%v) = %v, want the counters the code was generated from", shortURL, counters)
+	}
+
+	if counters := service.DecodeCounters("my-link"); counters != nil {
+		t.Errorf("DecodeCounters(my-link) = %v, want nil", counters)
+	}
+}
+
+// TestCreateShortenedURLDedup tests that dedup returns the existing code via the salted hash, also for an equivalent
+// long URL, while the plaintext is retrievable.
+func TestCreateShortenedURLDedup(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewURLService(db, &config.ServiceConfig{Dedup: true, DedupSalt: "salt"}).(*URLServiceImpl)
+	longURL := "http://example.com/private"
+
+	first, err := service.CreateShortenedURL(longURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.CreateShortenedURL(longURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("CreateShortenedURL() = %v and %v, want the same code", first, second)
+	}
+	if equivalent, err := service.CreateShortenedURL("HTTP://Example.com/private"); err != nil || equivalent != first {
+		t.Errorf("CreateShortenedURL() of an equivalent URL = %v, %v, want %v", equivalent, err, first)
+	}
+
+	// The index only holds the salted hash, the plaintext stays in the primary record
+	hash := service.dedupHash(longURL)
+	if hash == longURL || strings.Contains(hash, "example.com") {
+		t.Errorf("dedupHash() = %v, want a hash not containing the long URL", hash)
+	}
+	if key, err := db.(database.DedupIndex).FindByHash(hash); err != nil || key != first {
+		t.Errorf("FindByHash() = %v, %v, want %v", key, err, first)
+	}
+	if got, err := service.GetLongURL(first); err != nil || got != longURL {
+		t.Errorf("GetLongURL() = %v, %v, want %v", got, err, longURL)
+	}
+
+	// A different salt doesn't find the existing code
+	other := NewURLService(db, &config.ServiceConfig{Dedup: true, DedupSalt: "other"}).(*URLServiceImpl)
+	if other.dedupHash(longURL) == hash {
+		t.Error("dedupHash() is the same for different salts")
+	}
+}
+
+// TestLookupLongURL tests that LookupLongURL finds the short URL of a long URL shortened before, and 404s otherwise.
+func TestLookupLongURL(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewURLService(db, &config.ServiceConfig{Dedup: true, DedupSalt: "salt", LongURLLookup: true})
+	longURL := "http://example.com/known"
+
+	shortURL, err := service.CreateShortenedURL(longURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := service.LookupLongURL(longURL); err != nil || len(got) != 1 || got[0] != shortURL {
+		t.Errorf("LookupLongURL() = %v, %v, want [%v]", got, err, shortURL)
+	}
+
+	_, err = service.LookupLongURL("http://example.com/unknown")
+	if appErr, ok := err.(*types.AppError); !ok || appErr.HTTPStatus != http.StatusNotFound {
+		t.Errorf("LookupLongURL() of an unknown long URL error = %v, want 404", err)
+	}
+
+	// Aliases and upserts are indexed like generated codes
+	if _, err := service.CreateAliasedURL("alias", "http://example.com/aliased"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := service.UpsertShortenedURL("declared", "http://example.com/declared"); err != nil {
+		t.Fatal(err)
+	}
+	for longURL, shortURL := range map[string]string{"HTTP://Example.com/aliased": "alias", "http://example.com/declared": "declared"} {
+		if got, err := service.LookupLongURL(longURL); err != nil || len(got) != 1 || got[0] != shortURL {
+			t.Errorf("LookupLongURL(%v) = %v, %v, want [%v]", longURL, got, err, shortURL)
+		}
+	}
+
+	// The long URL is validated like on creation
+	if _, err := service.LookupLongURL("http://example.com/\xff\xfe"); !hasStatus(err, http.StatusBadRequest) {
+		t.Errorf("LookupLongURL() of an invalid long URL error = %v, want 400", err)
+	}
+
+	// Without LongURLLookup, the dedup index isn't exposed
+	disabled := NewURLService(db, &config.ServiceConfig{Dedup: true, DedupSalt: "salt"})
+	_, err = disabled.LookupLongURL(longURL)
+	if appErr, ok := err.(*types.AppError); !ok || appErr.HTTPStatus != http.StatusNotFound {
+		t.Errorf("LookupLongURL() with lookup disabled error = %v, want 404", err)
+	}
+}
+
+// TestListURLs tests that ListURLs pages through the stored URLs in code order and validates the page.
+func TestListURLs(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"c", "a", "b"} {
+		if err := db.Set(key, "http://example.com/"+key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := NewURLService(db, nil)
+
+	entries, total, err := service.ListURLs(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(entries) != 2 || entries[0].ShortURL != "b" || entries[1].ShortURL != "c" {
+		t.Errorf("ListURLs(2, 1) = %v, %v, want [b c], 3", entries, total)
+	}
+	if entries[0].LongURL != "http://example.com/b" {
+		t.Errorf("ListURLs() long URL = %v, want http://example.com/b", entries[0].LongURL)
+	}
+
+	for _, page := range [][2]int{{0, 0}, {MaxListLimit + 1, 0}, {10, -1}} {
+		if _, _, err := service.ListURLs(page[0], page[1]); err == nil {
+			t.Errorf("ListURLs(%v, %v) error = nil, want a bad request", page[0], page[1])
+		}
+	}
+}
+
+// TestListURLsAfter tests that paging by cursor neither skips nor repeats URLs when URLs are created between pages.
+func TestListURLsAfter(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"b", "d", "f", "h"} {
+		if err := db.Set(key, "http://example.com/"+key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := NewURLService(db, nil)
+
+	seen := []string{}
+	after := ""
+	for page := 0; ; page++ {
+		entries, next, err := service.ListURLsAfter(after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			seen = append(seen, entry.ShortURL)
+		}
+		if page == 0 {
+			// One before and two after the cursor, the offset of every later URL shifts
+			for _, key := range []string{"a", "e", "i"} {
+				if err := db.Set(key, "http://example.com/"+key); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if next == "" {
+			break
+		}
+		after = next
+	}
+
+	want := "b d e f h i"
+	if strings.Join(seen, " ") != want {
+		t.Errorf("ListURLsAfter() pages = %v, want %v", seen, want)
+	}
+
+	if _, _, err := service.ListURLsAfter("", MaxListLimit+1); err == nil {
+		t.Errorf("ListURLsAfter(%v) error = nil, want a bad request", MaxListLimit+1)
+	}
+
+	// With check digits, the cursor is the public short URL
+	service = NewURLService(db, &config.ServiceConfig{CheckDigit: true})
+	entries, next, err := service.ListURLsAfter("", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != appendCheckCharacter("a") || entries[0].ShortURL != next {
+		t.Errorf("ListURLsAfter() = %v, %v, want the cursor %v", entries, next, appendCheckCharacter("a"))
+	}
+	if entries, _, err = service.ListURLsAfter(next, 1); err != nil || entries[0].ShortURL != appendCheckCharacter("b") {
+		t.Errorf("ListURLsAfter(%v) = %v, %v, want %v", next, entries, err, appendCheckCharacter("b"))
+	}
+	if _, _, err := service.ListURLsAfter("a", 1); err == nil {
+		t.Error("ListURLsAfter() with a wrong check character error = nil, want a bad request")
+	}
+}
+
+// TestPrefetchPreview tests that the link preview of a long URL is prefetched into the cache at creation.
+func TestPrefetchPreview(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<meta property="og:title" content="Prefetched">`))
+	}))
+	defer server.Close()
+
+	service := NewURLService(&MockDatabase{
+		SetFunc: func(key, value string) error { return nil },
+	}, &config.ServiceConfig{LinkPreviews: true, LinkPreviewTimeout: 5000, LinkPreviewTTL: 60}).(*URLServiceImpl)
+	// The test server listens on loopback, which the default cache refuses
+	service.Previews = newPreviewCache(5*time.Second, time.Minute, 10, nil, nil, func(net.IP) bool { return false })
+	if _, err := service.CreateShortenedURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for service.GetLinkPreview(server.URL) == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if preview := service.GetLinkPreview(server.URL); preview == nil || preview.Title != "Prefetched" {
+		t.Errorf("GetLinkPreview() = %v after creation, want the prefetched preview", preview)
+	}
+}
+
+// TestFetchLongURL tests that the fetch proxy enforces the size and content type limits and refuses internal addresses.
+func TestFetchLongURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(strings.Repeat("a", 64)))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(strings.Repeat("a", 65)))
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		// Flushing before the end hides the length, so the limit applies while reading
+		w.Write([]byte(strings.Repeat("a", 32)))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("a", 64)))
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	longURLs := map[string]string{}
+	for _, path := range []string{"/page", "/large", "/stream", "/binary"} {
+		longURLs[path] = server.URL + path
+	}
+	db := &MockDatabase{
+		GetFunc: func(key string) (string, error) {
+			if longURL, ok := longURLs["/"+key]; ok {
+				return longURL, nil
+			}
+			return "", types.NewNotFoundError(key)
+		},
+	}
+
+	service := NewURLService(db, &config.ServiceConfig{}).(*URLServiceImpl)
+	if _, err := service.FetchLongURL(context.Background(), "page"); !hasStatus(err, http.StatusNotFound) {
+		t.Errorf("FetchLongURL() with the proxy disabled error = %v, want status %v", err, http.StatusNotFound)
+	}
+
+	// The test server listens on loopback, which the default fetcher refuses
+	service.Fetcher = NewTargetFetcher(time.Second, 64, []string{"text/html", "text/plain"}, nil)
+	if _, err := service.FetchLongURL(context.Background(), "page"); !hasStatus(err, http.StatusForbidden) {
+		t.Errorf("FetchLongURL() of a loopback address error = %v, want status %v", err, http.StatusForbidden)
+	}
+
+	service.Fetcher = newTargetFetcher(time.Second, 64, []string{"text/html", "text/plain"}, nil, func(net.IP) bool { return false })
+	tests := []struct {
+		shortURL      string
+		expectedErr   int
+		expectedBody  int
+		expectedLimit bool
+	}{
+		{"page", 0, 64, false},
+		{"large", http.StatusBadGateway, 0, false},
+		{"stream", 0, 64, true},
+		{"binary", http.StatusBadGateway, 0, false},
+		{"missing", http.StatusNotFound, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shortURL, func(t *testing.T) {
+			resp, err := service.FetchLongURL(context.Background(), tt.shortURL)
+			if tt.expectedErr != 0 {
+				if !hasStatus(err, tt.expectedErr) {
+					t.Errorf("FetchLongURL() error = %v, want status %v", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchLongURL() error = %v, wantErr nil", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if len(body) != tt.expectedBody {
+				t.Errorf("FetchLongURL() body length = %v, want %v", len(body), tt.expectedBody)
+			}
+			if limited := errors.Is(err, ErrFetchTooLarge); limited != tt.expectedLimit {
+				t.Errorf("FetchLongURL() body error = %v, want ErrFetchTooLarge %v", err, tt.expectedLimit)
+			}
+		})
+	}
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestCheckReachable tests that long URLs failing a HEAD request or targeting internal addresses are rejected,
+// while redirects count as reachable.
+func TestCheckReachable(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("reachability check method = %v, want HEAD", r.Method)
+		}
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/missing", http.StatusFound)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	service := NewURLService(&MockDatabase{
+		SetFunc: func(key, value string) error { return nil },
+	}, &config.ServiceConfig{CheckReachable: true, ReachableTimeout: 50}).(*URLServiceImpl)
+
+	// The test server listens on loopback, which the default client refuses
+	if _, err := service.CreateShortenedURL(server.URL + "/ok"); !hasStatus(err, http.StatusBadRequest) {
+		t.Errorf("CreateShortenedURL() of a loopback address error = %v, want status %v", err, http.StatusBadRequest)
+	}
+
+	service.Reachability = newReachabilityClient(50*time.Millisecond, func(net.IP) bool { return false })
+	tests := []struct {
+		name    string
+		longURL string
+		wantErr bool
+	}{
+		{"reachable", server.URL + "/ok", false},
+		{"redirect", server.URL + "/moved", false},
+		{"HEAD not supported", server.URL + "/no-head", false},
+		{"not found", server.URL + "/missing", true},
+		{"server error", server.URL + "/broken", true},
+		{"timeout", server.URL + "/slow", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateShortenedURL(tt.longURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateShortenedURL(%v) error = %v, wantErr %v", tt.longURL, err, tt.wantErr)
+			}
+			if tt.wantErr && !hasStatus(err, http.StatusBadRequest) {
+				t.Errorf("CreateShortenedURL(%v) error = %v, want status %v", tt.longURL, err, http.StatusBadRequest)
+			}
+		})
+	}
+
+	// An unreachable target, through an injected client
+	service.Reachability = &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	})}
+	if _, err := service.CreateShortenedURL("http://unreachable.example.com"); !hasStatus(err, http.StatusBadRequest) {
+		t.Errorf("CreateShortenedURL() of an unreachable target error = %v, want status %v", err, http.StatusBadRequest)
+	}
+}
+
+// hasStatus reports whether err is an AppError with the given HTTP status.
+func hasStatus(err error, status int) bool {
+	var appErr *types.AppError
+	return errors.As(err, &appErr) && appErr.HTTPStatus == status
+}
+
+// fakeResolver resolves hosts from a fixed table, unknown hosts are NXDOMAIN.
+// A nil entry blocks until the lookup times out, like a slow resolver.
+type fakeResolver struct {
+	mu      sync.Mutex
+	hosts   map[string][]net.IPAddr
+	lookups int
+}
+
+// LookupIPAddr implements the Resolver interface.
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	r.lookups++
+	r.mu.Unlock()
+	addrs, ok := r.hosts[host]
+	switch {
+	case !ok:
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	case addrs == nil:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return addrs, nil
+}
+
+// TestValidateDNS tests that hosts that don't resolve are rejected, while slow resolvers let URLs through.
+func TestValidateDNS(t *testing.T) {
+	resolver := &fakeResolver{hosts: map[string][]net.IPAddr{
+		"example.com": {{IP: net.ParseIP("93.184.215.14")}},
+		"slow.test":   nil,
+	}}
+	service := NewURLService(&MockDatabase{
+		SetFunc: func(key, value string) error { return nil },
+	}, &config.ServiceConfig{ValidateDNS: true}).(*URLServiceImpl)
+	service.Resolver = NewHostResolver(resolver, 20*time.Millisecond, time.Minute)
+
+	tests := []struct {
+		name    string
+		longURL string
+		wantErr bool
+	}{
+		{"resolvable host", "http://example.com/page", false},
+		{"unresolvable host", "http://nxdomain.invalid/page", true},
+		{"slow resolver", "http://slow.test/page", false},
+		{"IP literal", "http://192.0.2.1/page", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateShortenedURL(tt.longURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateShortenedURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if appErr, ok := err.(*types.AppError); tt.wantErr && (!ok || appErr.HTTPStatus != http.StatusBadRequest) {
+				t.Errorf("CreateShortenedURL() error = %v, want a 400 AppError", err)
+			}
+		})
+	}
+
+	// Definite answers are cached, the timed out lookup is not
+	before := resolver.lookups
+	service.CreateShortenedURL("http://example.com/other")
+	service.CreateShortenedURL("http://nxdomain.invalid/other")
+	service.CreateShortenedURL("http://slow.test/other")
+	if got := resolver.lookups - before; got != 1 {
+		t.Errorf("resolver was called %v times, want 1", got)
+	}
+}
+
+// TestBlockPrivateIPs tests that long URLs targeting private or internal addresses are rejected.
+func TestBlockPrivateIPs(t *testing.T) {
+	resolver := &fakeResolver{hosts: map[string][]net.IPAddr{
+		"example.com":     {{IP: net.ParseIP("93.184.215.14")}},
+		"internal.test":   {{IP: net.ParseIP("10.0.0.5")}},
+		"mixed.test":      {{IP: net.ParseIP("93.184.215.14")}, {IP: net.ParseIP("127.0.0.1")}},
+		"metadata.test":   {{IP: net.ParseIP("169.254.169.254")}},
+		"v6-private.test": {{IP: net.ParseIP("fd00::1")}},
+		"v6-public.test":  {{IP: net.ParseIP("2606:2800:220:1::1")}},
+		"slow.test":       nil,
+	}}
+	service := NewURLService(&MockDatabase{
+		SetFunc: func(key, value string) error { return nil },
+	}, &config.ServiceConfig{BlockPrivateIPs: true}).(*URLServiceImpl)
+	service.Resolver = NewHostResolver(resolver, 20*time.Millisecond, time.Minute)
+
+	tests := []struct {
+		name    string
+		longURL string
+		wantErr bool
+	}{
+		{"public hostname", "http://example.com/page", false},
+		{"private hostname", "http://internal.test/page", true},
+		{"hostname with any private address", "http://mixed.test/page", true},
+		{"link-local hostname", "http://metadata.test/latest", true},
+		{"private IPv6 hostname", "http://v6-private.test/page", true},
+		{"public IPv6 hostname", "http://v6-public.test/page", false},
+		{"public IP", "http://93.184.215.14/page", false},
+		{"RFC 1918 IP", "http://192.168.1.1/admin", true},
+		{"loopback IP", "http://127.0.0.1:8080/page", true},
+		{"link-local IP", "http://169.254.169.254/latest", true},
+		{"IPv6 loopback", "http://[::1]/page", true},
+		{"unspecified IP", "http://0.0.0.0/page", true},
+		{"unresolvable without DNS validation", "http://nxdomain.invalid/page", false},
+		{"slow resolver", "http://slow.test/page", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateShortenedURL(tt.longURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateShortenedURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestLinkPreview tests that OpenGraph tags are parsed from HTML targets, and that lookups only serve cached previews,
+// which expire after the TTL and are evicted least recently used first beyond the maximum.
+func TestLinkPreview(t *testing.T) {
+	var fetches int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!DOCTYPE html><html><head>
+<meta property="og:title" content="Fish &amp; Chips">
+<meta content='A "great" dish' property='og:description'/>
+<meta property=og:image content=https://example.com/chips.png>
+<meta property="og:title" content="Ignored duplicate">
+</head><body></body></html>`))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>No tags</title></head></html>`))
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"og:title":"not html"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	service := NewURLService(&MockDatabase{}, &config.ServiceConfig{}).(*URLServiceImpl)
+	if preview := service.GetLinkPreview(server.URL + "/og"); preview != nil {
+		t.Errorf("GetLinkPreview() with previews disabled = %v, want nil", preview)
+	}
+
+	// The test server listens on loopback, which the default cache refuses
+	if preview := NewPreviewCache(time.Second, time.Minute, 10, nil, nil).Fetch(server.URL + "/og"); preview != nil || fetches != 0 {
+		t.Errorf("Fetch() of a loopback address = %v after %v fetches, want nil without fetching", preview, fetches)
+	}
+
+	now := time.Now()
+	service.Previews = newPreviewCache(time.Second, time.Minute, 10, nil, nil, func(net.IP) bool { return false })
+	service.Previews.now = func() time.Time { return now }
+
+	tests := []struct {
+		name string
+		path string
+		want *types.LinkPreview
+	}{
+		{"OpenGraph tags", "/og", &types.LinkPreview{Title: "Fish & Chips", Image: "https://example.com/chips.png", Description: `A "great" dish`}},
+		{"no OpenGraph tags", "/plain", nil},
+		{"not HTML", "/json", nil},
+		{"not found", "/missing", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service.Previews.Fetch(server.URL + tt.path)
+			got := service.GetLinkPreview(server.URL + tt.path)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("GetLinkPreview() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if preview := service.GetLinkPreview(server.URL + "/uncached"); preview != nil {
+		t.Errorf("GetLinkPreview() of an uncached long URL = %v, want nil", preview)
+	}
+	service.GetLinkPreview(server.URL + "/og")
+	if fetches != 1 {
+		t.Errorf("Fetches = %v, want 1, lookups must not fetch", fetches)
+	}
+	now = now.Add(2 * time.Minute)
+	if preview := service.GetLinkPreview(server.URL + "/og"); preview != nil || fetches != 1 {
+		t.Errorf("GetLinkPreview() after the TTL = %v after %v fetches, want nil without fetching", preview, fetches)
+	}
+
+	// The least recently used preview is evicted beyond the maximum
+	service.Previews = newPreviewCache(time.Second, time.Minute, 2, nil, nil, func(net.IP) bool { return false })
+	service.Previews.Fetch(server.URL + "/og")
+	service.Previews.Fetch(server.URL + "/plain")
+	service.GetLinkPreview(server.URL + "/og")
+	service.Previews.Fetch(server.URL + "/json")
+	if preview := service.GetLinkPreview(server.URL + "/og"); preview == nil {
+		t.Error("GetLinkPreview() of the recently used preview = nil, want it kept")
+	}
+	if _, ok := service.Previews.entries[server.URL+"/plain"]; ok {
+		t.Error("Least recently used preview was not evicted")
+	}
+}
+
+// TestRejectShortURLs tests that long URLs on the service's own domain or a known shortener are rejected.
+func TestRejectShortURLs(t *testing.T) {
+	service := NewURLService(&MockDatabase{
+		SetFunc: func(key, value string) error { return nil },
+	}, &config.ServiceConfig{
+		RejectShortURLs:     true,
+		ShortenerDomainList: []string{"bit.ly", "tinyurl.com", "sho.rt"},
+	})
+
+	tests := []struct {
+		name    string
+		longURL string
+		wantErr bool
+	}{
+		{"self domain", "https://sho.rt/jR", true},
+		{"self domain with port", "http://sho.rt:8080/jR", true},
+		{"known shortener", "https://bit.ly/abc", true},
+		{"known shortener subdomain", "https://preview.tinyurl.com/abc", true},
+		{"known shortener in upper case", "https://BIT.LY/abc", true},
+		{"similar domain", "https://notbit.ly/abc", false},
+		{"shortener in the path", "https://example.com/bit.ly", false},
+		{"other domain", "https://example.com/page", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateShortenedURL(tt.longURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateShortenedURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if appErr, ok := err.(*types.AppError); tt.wantErr && (!ok || appErr.HTTPStatus != http.StatusBadRequest) {
+				t.Errorf("CreateShortenedURL() error = %v, want a 400 AppError", err)
+			}
+		})
+	}
+}
+
+// TestSubscribeEvents tests that creations are published to subscribers without blocking on slow ones.
+func TestSubscribeEvents(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewURLService(db, nil)
+
+	events, unsubscribe := service.SubscribeEvents()
+	shortURL, err := service.CreateAliasedURL("abc", "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-events; event.Type != types.EventCreated || event.ShortURL != shortURL || event.LongURL != "http://example.com" {
+		t.Errorf("SubscribeEvents() received %+v, want a created event for %v", event, shortURL)
+	}
+	if _, _, err := service.UpsertShortenedURL("def", "http://example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-events; event.Type != types.EventCreated || event.ShortURL != "def" {
+		t.Errorf("SubscribeEvents() received %+v, want a created event for def", event)
+	}
+
+	// A subscriber that never reads misses events instead of blocking creation
+	for i := 0; i < eventBufferSize+10; i++ {
+		if _, err := service.CreateShortenedURL("http://example.com/" + strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(events) != eventBufferSize {
+		t.Errorf("Buffered events = %v, want %v", len(events), eventBufferSize)
+	}
+
+	unsubscribe()
+	for range events {
+	}
+}
+
+// TestHostCreationLimit tests that creations for one long URL host are limited within the sliding window
+// while other hosts are unaffected.
+func TestHostCreationLimit(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewURLService(db, &config.ServiceConfig{HostCreationLimit: 3, HostCreationWindow: 60000})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.(*URLServiceImpl).HostLimiter.now = func() time.Time { return now }
+
+	create := func(longURL string) error {
+		_, err := service.CreateShortenedURL(longURL)
+		return err
+	}
+
+	// Test case 1: The limit applies across paths and casing of one host
+	for i := 0; i < 3; i++ {
+		if err := create("http://SPAM.example.com/" + strconv.Itoa(i)); err != nil {
+			t.Fatalf("creation %d error = %v, wantErr nil", i+1, err)
+		}
+	}
+	err = create("http://spam.example.com/next")
+	var appErr *types.AppError
+	if !errors.As(err, &appErr) || appErr.HTTPStatus != http.StatusTooManyRequests || appErr.Code != types.ErrorCodeRateLimited {
+		t.Errorf("CreateShortenedURL() error = %v, want a rate limited AppError", err)
+	} else if appErr.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter = %v, want %v until the creations slide out of the next window", appErr.RetryAfter, time.Minute)
+	}
+	if _, err := service.CreateAliasedURL("alias", "http://spam.example.com/alias"); !errors.As(err, &appErr) || appErr.HTTPStatus != http.StatusTooManyRequests {
+		t.Errorf("CreateAliasedURL() error = %v, want a rate limited AppError", err)
+	}
+
+	// Test case 2: Another host is unaffected
+	if err := create("http://example.org/"); err != nil {
+		t.Errorf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+
+	// Test case 3: Half way into the next window, half of the previous creations still count
+	now = now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		if err := create("http://spam.example.com/later/" + strconv.Itoa(i)); err != nil {
+			t.Errorf("creation %d error = %v after the window slid, wantErr nil", i+1, err)
+		}
+	}
+	if err := create("http://spam.example.com/later/2"); !errors.As(err, &appErr) {
+		t.Errorf("CreateShortenedURL() error = %v, want a rate limited AppError while the previous window overlaps", err)
+	} else if appErr.RetryAfter != 10*time.Second {
+		t.Errorf("RetryAfter = %v, want %v until enough of the previous window slid out", appErr.RetryAfter, 10*time.Second)
+	}
+
+	// Test case 4: Creations older than the sliding window don't count
+	now = now.Add(2 * time.Minute)
+	if err := create("http://spam.example.com/much-later"); err != nil {
+		t.Errorf("CreateShortenedURL() error = %v after the window passed, wantErr nil", err)
+	}
+}
+
+// stubGeoResolver is a GeoResolver returning a fixed location and recording the looked up IPs.
+type stubGeoResolver struct {
+	mu  sync.Mutex
+	ips []string
+	geo *types.GeoInfo
+}
+
+// Lookup implements the GeoResolver interface for stubGeoResolver.
+func (r *stubGeoResolver) Lookup(ctx context.Context, ip net.IP) (*types.GeoInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ips = append(r.ips, ip.String())
+	return r.geo, nil
+}
+
+// TestRecordVisit tests that visit events are only published if enabled and are annotated by the GeoResolver.
+func TestRecordVisit(t *testing.T) {
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test case 1: Visits are not published by default
+	service := NewURLService(db, nil)
+	events, unsubscribe := service.SubscribeEvents()
+	service.RecordVisit("abc", "http://example.com", "203.0.113.1")
+	if len(events) != 0 {
+		t.Errorf("Buffered events = %v, want 0", len(events))
+	}
+	unsubscribe()
+
+	// Test case 2: Visits are annotated with the location of the client IP
+	service = NewURLService(db, &config.ServiceConfig{VisitEvents: true, GeoTimeout: 1000})
+	resolver := &stubGeoResolver{geo: &types.GeoInfo{Country: "NZ", ASN: 9500}}
+	service.(*URLServiceImpl).Geo = resolver
+	events, unsubscribe = service.SubscribeEvents()
+	defer unsubscribe()
+
+	service.RecordVisit("abc", "http://example.com", "203.0.113.1")
+	select {
+	case event := <-events:
+		if event.Type != types.EventVisited || event.ShortURL != "abc" || event.LongURL != "http://example.com" {
+			t.Errorf("SubscribeEvents() received %+v, want a visited event for abc", event)
+		}
+		if event.Geo == nil || *event.Geo != *resolver.geo {
+			t.Errorf("Event geo = %+v, want %+v", event.Geo, resolver.geo)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SubscribeEvents() received no visited event")
+	}
+	if len(resolver.ips) != 1 || resolver.ips[0] != "203.0.113.1" {
+		t.Errorf("Looked up IPs = %v, want [203.0.113.1]", resolver.ips)
+	}
+
+	// Test case 3: A visit without a client IP is published without annotation
+	service.RecordVisit("abc", "http://example.com", "")
+	if event := <-events; event.Type != types.EventVisited || event.Geo != nil {
+		t.Errorf("SubscribeEvents() received %+v, want a visited event without geo", event)
+	}
+
+	// Test case 4: A repeat visitor is annotated from the cache without another lookup
+	service.RecordVisit("abc", "http://example.com", "203.0.113.1")
+	if event := <-events; event.Geo == nil || *event.Geo != *resolver.geo {
+		t.Errorf("Event geo = %+v, want %+v", event.Geo, resolver.geo)
+	}
+	if len(resolver.ips) != 1 {
+		t.Errorf("Looked up IPs = %v, want only the first visit", resolver.ips)
+	}
+
+	// Test case 5: Without subscribers, visits are not looked up
+	unsubscribe()
+	service.RecordVisit("abc", "http://example.com", "203.0.113.2")
+	if len(resolver.ips) != 1 {
+		t.Errorf("Looked up IPs = %v, want no lookup without subscribers", resolver.ips)
+	}
+}
+
+// TestMaxMindGeoResolver tests that the GeoIP2 web service response is mapped to the country and ASN.
+func TestMaxMindGeoResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "42" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/city/203.0.113.1":
+			w.Write([]byte(`{"country":{"iso_code":"NZ"},"traits":{"autonomous_system_number":9500,"ip_address":"203.0.113.1"}}`))
+		case "/city/10.0.0.1":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	resolver := NewMaxMindGeoResolver("42", "secret", time.Second, nil)
+	resolver.endpoint = server.URL + "/city/"
+
+	geo, err := resolver.Lookup(context.Background(), net.ParseIP("203.0.113.1"))
+	if err != nil || geo == nil || geo.Country != "NZ" || geo.ASN != 9500 {
+		t.Errorf("Lookup() = %+v, %v, want NZ and 9500", geo, err)
+	}
+
+	// Test case 2: IPs unknown to MaxMind are not an error
+	if geo, err := resolver.Lookup(context.Background(), net.ParseIP("10.0.0.1")); err != nil || geo != nil {
+		t.Errorf("Lookup() = %+v, %v, want nil, nil", geo, err)
+	}
+
+	// Test case 3: Rejected lookups are errors
+	resolver.licenseKey = "wrong"
+	if _, err := resolver.Lookup(context.Background(), net.ParseIP("203.0.113.1")); err == nil {
+		t.Error("Expected an error for a rejected lookup, but got nil")
+	}
+}
+
+// TestCreateShortenedURLWriteErrors tests that rejected values and database outages keep their status codes.
+func TestCreateShortenedURLWriteErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"rejected value", types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Value is not accepted by the database")}), http.StatusBadRequest},
+		{"database unavailable", types.NewUnavailableError("Postgres DB failed to set new row", nil), http.StatusServiceUnavailable},
+		{"database failure", types.NewDBError("Postgres DB failed to set new row", nil), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewURLService(&MockDatabase{
+				SetFunc: func(key, value string) error { return tt.err },
+			}, nil)
+
+			_, err := service.CreateShortenedURL("http://example.com")
+			appErr, ok := err.(*types.AppError)
+			if !ok {
+				t.Fatalf("CreateShortenedURL() error = %T, want *types.AppError", err)
+			}
+			if appErr.HTTPStatus != tt.wantStatus {
+				t.Errorf("CreateShortenedURL() status = %v, want %v", appErr.HTTPStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// TestSignCodes tests that signed codes resolve, while tampered codes and codes signed with a different key
+// are rejected without a database query.
+func TestSignCodes(t *testing.T) {
+	stored := map[string]string{}
+	queried := false
+	mockDB := &MockDatabase{
+		SetFunc: func(key, value string) error {
+			stored[key] = value
+			return nil
+		},
+		GetFunc: func(key string) (string, error) {
+			queried = true
+			if value, ok := stored[key]; ok {
+				return value, nil
+			}
+			return "", types.NewNotFoundError(key)
+		},
+	}
+	cfg := &config.ServiceConfig{SignCodes: true, SigningKey: "secret", SignatureLength: 4, CheckDigit: true}
+	service := NewURLService(mockDB, cfg)
+
+	shortURL, err := service.CreateShortenedURL("http://example.com")
+	if err != nil {
+		t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+	if _, ok := stored[shortURL[:len(shortURL)-5]]; !ok {
+		t.Fatalf("CreateShortenedURL() = %v, expected the code without check character and signature to be stored", shortURL)
+	}
+
+	otherKey := NewURLService(mockDB, &config.ServiceConfig{SignCodes: true, SigningKey: "other", SignatureLength: 4, CheckDigit: true})
+	forged, err := otherKey.CreateShortenedURL("http://example.com/forged")
+	if err != nil {
+		t.Fatalf("CreateShortenedURL() error = %v, wantErr nil", err)
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		shortURL   string
+		wantStatus int
+	}{
+		{"valid", InvalidCodesLenient, shortURL, http.StatusOK},
+		{"tampered signature", InvalidCodesLenient, shortURL[:len(shortURL)-1] + string(nextAlphabetChar(shortURL[len(shortURL)-1])), http.StatusNotFound},
+		{"missing signature", InvalidCodesLenient, shortURL[:len(shortURL)-4], http.StatusNotFound},
+		{"different key", InvalidCodesLenient, forged, http.StatusNotFound},
+		{"different key strict", InvalidCodesStrict, forged, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.InvalidCodes = tt.mode
+			queried = false
+
+			longURL, err := service.GetLongURL(tt.shortURL)
+			if tt.wantStatus == http.StatusOK {
+				if err != nil || longURL != "http://example.com" {
+					t.Errorf("GetLongURL(%v) = %v, %v, want %v, nil", tt.shortURL, longURL, err, "http://example.com")
+				}
+				return
+			}
+			if !hasStatus(err, tt.wantStatus) {
+				t.Errorf("GetLongURL(%v) error = %v, want status %v", tt.shortURL, err, tt.wantStatus)
+			}
+			if queried {
+				t.Errorf("GetLongURL(%v) queried the database, want the code rejected before", tt.shortURL)
+			}
+		})
+	}
+}
+
+// TestSignCodesAliases tests that client chosen aliases are stored unsigned and answered with a signed code that resolves.
+func TestSignCodesAliases(t *testing.T) {
+	stored := map[string]string{}
+	mockDB := &MockDatabase{
+		SetFunc: func(key, value string) error {
+			if _, ok := stored[key]; ok {
+				return types.NewConflictError(key)
+			}
+			stored[key] = value
+			return nil
+		},
+		GetFunc: func(key string) (string, error) {
+			if value, ok := stored[key]; ok {
+				return value, nil
+			}
+			return "", types.NewNotFoundError(key)
+		},
+	}
+	service := NewURLService(mockDB, &config.ServiceConfig{SignCodes: true, SigningKey: "secret", SignatureLength: 4})
+
+	aliased, err := service.CreateAliasedURL("docs", "http://example.com/docs")
+	if err != nil {
+		t.Fatalf("CreateAliasedURL() error = %v, wantErr nil", err)
+	}
+	declared, _, err := service.UpsertShortenedURL("blog", "http://example.com/blog")
+	if err != nil {
+		t.Fatalf("UpsertShortenedURL() error = %v, wantErr nil", err)
+	}
+
+	for alias, shortURL := range map[string]string{"docs": aliased, "blog": declared} {
+		if _, ok := stored[alias]; !ok {
+			t.Errorf("alias %q was not stored unsigned, stored = %v", alias, stored)
+		}
+		if len(shortURL) != len(alias)+4 || shortURL[:len(alias)] != alias {
+			t.Errorf("alias %q answered with %q, want the alias with its signature", alias, shortURL)
+		}
+		if _, err := service.GetLongURL(shortURL); err != nil {
+			t.Errorf("GetLongURL(%v) error = %v, wantErr nil", shortURL, err)
+		}
+	}
+
+	// An alias of the maximum length resolves, although its signed code is longer
+	longest := strings.Repeat("a", maxShortURLLength)
+	shortURL, err := service.CreateAliasedURL(longest, "http://example.com/longest")
+	if err != nil {
+		t.Fatalf("CreateAliasedURL() error = %v, wantErr nil", err)
+	}
+	if longURL, err := service.GetLongURL(shortURL); err != nil || longURL != "http://example.com/longest" {
+		t.Errorf("GetLongURL(%v) = %v, %v, want %v, nil", shortURL, longURL, err, "http://example.com/longest")
+	}
+
+	// With check digits the alias carries its check character within the maximum length, the signature follows it
+	checked := NewURLService(mockDB, &config.ServiceConfig{SignCodes: true, SigningKey: "secret", SignatureLength: 4, CheckDigit: true})
+	longest = appendCheckCharacter(strings.Repeat("b", maxShortURLLength-1))
+	shortURL, _, err = checked.UpsertShortenedURL(longest, "http://example.com/checked")
+	if err != nil {
+		t.Fatalf("UpsertShortenedURL() error = %v, wantErr nil", err)
+	}
+	if len(shortURL) != maxShortURLLength+4 || shortURL[:maxShortURLLength] != longest {
+		t.Errorf("UpsertShortenedURL() = %v, want the alias with its signature", shortURL)
+	}
+	if longURL, err := checked.GetLongURL(shortURL); err != nil || longURL != "http://example.com/checked" {
+		t.Errorf("GetLongURL(%v) = %v, %v, want %v, nil", shortURL, longURL, err, "http://example.com/checked")
+	}
+}
+
+// TestInvalidCodes tests that codes that can't exist are rejected without a database lookup,
+// with 404 in lenient mode and 400 in strict mode.
+func TestInvalidCodes(t *testing.T) {
+	mockDB := &MockDatabase{
+		GetFunc: func(key string) (string, error) {
+			t.Errorf("Database queried for %q", key)
+			return "", types.NewNotFoundError(key)
+		},
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		shortURL   string
+		wantStatus int
+	}{
+		{"lenient invalid character", InvalidCodesLenient, "ab.c", http.StatusNotFound},
+		{"lenient too long", InvalidCodesLenient, strings.Repeat("a", maxShortURLLength+1), http.StatusNotFound},
+		{"default is lenient", "", "ab%c", http.StatusNotFound},
+		{"strict invalid character", InvalidCodesStrict, "ab.c", http.StatusBadRequest},
+		{"strict too long", InvalidCodesStrict, strings.Repeat("a", maxShortURLLength+1), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewURLService(mockDB, &config.ServiceConfig{InvalidCodes: tt.mode})
+
+			for _, lookup := range []func(string) error{
+				func(shortURL string) error { _, err := service.GetLongURL(shortURL); return err },
+				func(shortURL string) error { _, err := service.GetRecord(shortURL); return err },
+			} {
+				appErr, ok := lookup(tt.shortURL).(*types.AppError)
+				if !ok || appErr.HTTPStatus != tt.wantStatus {
+					t.Errorf("lookup error = %v, want status %v", appErr, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+// TestBrandAlphabets tests that branded hosts generate codes with their own alphabet and that all codes resolve on any host.
+func TestBrandAlphabets(t *testing.T) {
+	stored := map[string]string{}
+	mockDB := &MockDatabase{
+		SetFunc: func(key, value string) error {
+			if _, ok := stored[key]; ok {
+				return types.NewConflictError(key)
+			}
+			stored[key] = value
+			return nil
+		},
+		GetFunc: func(key string) (string, error) {
+			if value, ok := stored[key]; ok {
+				return value, nil
+			}
+			return "", types.NewNotFoundError(key)
+		},
+	}
+	cfg := &config.ServiceConfig{BrandAlphabetMap: map[string]string{
+		"digits.example":  "0123456789",
+		"letters.example": "abcdefghijklmnopqrstuvwxyz",
+	}}
+	service := NewURLService(mockDB, cfg)
+
+	tests := []struct {
+		name     string
+		host     string
+		alphabet string
+	}{
+		{"digits tenant", "digits.example", "0123456789"},
+		{"digits tenant with port", "Digits.Example:8080", "0123456789"},
+		{"letters tenant", "letters.example", "abcdefghijklmnopqrstuvwxyz"},
+		{"unbranded host", "other.example", codeAlphabet},
+		{"no host", "", codeAlphabet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			longURL := "http://example.com/" + strings.ReplaceAll(tt.name, " ", "-")
+			shortURL, err := service.CreateShortenedURLForHost(tt.host, longURL)
+			if err != nil {
+				t.Fatalf("CreateShortenedURLForHost() error = %v, wantErr nil", err)
+			}
+			if strings.Trim(shortURL, tt.alphabet) != "" {
+				t.Errorf("CreateShortenedURLForHost() = %v, want only characters of %v", shortURL, tt.alphabet)
+			}
+
+			got, err := service.GetLongURL(shortURL)
+			if err != nil {
+				t.Fatalf("GetLongURL() error = %v, wantErr nil", err)
+			}
+			if got != longURL {
+				t.Errorf("GetLongURL() = %v, want %v", got, longURL)
+			}
+		})
+	}
+
+	// A branded code taken by a code of another alphabet is retried with the next counters instead of a conflict
+	impl := service.(*URLServiceImpl)
+	taken, _ := impl.generatorFor("").Generate("http://example.com", 0)
+	stored[taken] = "http://example.com/other-tenant"
+	shortURL, err := impl.storeShortenedURL("http://example.com/retried", &collidingGenerator{CodeGenerator: impl.generatorFor("digits.example"), taken: taken})
+	if err != nil || shortURL == taken {
+		t.Errorf("storeShortenedURL() over a taken branded code = %v, %v, want another code", shortURL, err)
+	}
+	if _, err := impl.storeShortenedURL("http://example.com/conflict", &collidingGenerator{CodeGenerator: impl.Generator, taken: taken}); !hasStatus(err, http.StatusConflict) {
+		t.Errorf("storeShortenedURL() over a taken default code error = %v, want status %v", err, http.StatusConflict)
+	}
+}
+
+// collidingGenerator returns a taken code on the first attempt and defers to the wrapped generator afterwards.
+type collidingGenerator struct {
+	CodeGenerator
+	taken string
+}
+
+// Generate returns the taken code on attempt 0.
+func (g *collidingGenerator) Generate(longURL string, attempt int) (string, bool) {
+	if attempt == 0 {
+		return g.taken, true
+	}
+	return g.CodeGenerator.Generate(longURL, attempt)
+}
+
+// TestSeed tests that seeding declares the entries through the service, skipping existing codes and rejected entries.
+func TestSeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed.json")
+	content := `[{"shortURL": "docs", "longURL": "https://example.com/docs"}, {"shortURL": "blog", "longURL": "https://example.com/blog"},
+		{"shortURL": "bad code", "longURL": "https://example.com/bad"}, {"shortURL": "empty", "longURL": ""}]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.StartNewDatabase(&config.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewURLService(db, nil)
+
+	// Test case 1: First start adds the valid entries and skips the invalid ones
+	added, skipped, err := Seed(service, path)
+	if err != nil || added != 2 || skipped != 2 {
+		t.Fatalf("Seed() = %v, %v, %v, want 2, 2, nil", added, skipped, err)
+	}
+	if got, _ := db.Get("docs"); got != "https://example.com/docs" {
+		t.Errorf("Get() = %v, want %v", got, "https://example.com/docs")
+	}
+	if exists, _ := db.Exists("empty"); exists {
+		t.Error("Seed() stored an entry rejected by validation")
+	}
+
+	// Test case 2: Restart skips existing codes and keeps their targets, even if the seed file changed them
+	content = strings.Replace(content, "https://example.com/blog", "https://example.com/changed", 1)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	added, skipped, err = Seed(service, path)
+	if err != nil || added != 0 || skipped != 4 {
+		t.Fatalf("Seed() = %v, %v, %v, want 0, 4, nil", added, skipped, err)
+	}
+	if got, _ := db.Get("blog"); got != "https://example.com/blog" {
+		t.Errorf("Get() = %v, want %v", got, "https://example.com/blog")
+	}
+
+	// Test case 3: A missing file fails
+	if _, _, err := Seed(service, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing seed file, but got nil")
+	}
+}
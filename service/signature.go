@@ -0,0 +1,37 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// codeSignature computes the signature suffix of code, an HMAC-SHA256 keyed by Config.SigningKey
+// encoded over codeAlphabet and truncated to Config.SignatureLength characters.
+func (s *URLServiceImpl) codeSignature(code string) string {
+	mac := hmac.New(sha256.New, []byte(s.Config.SigningKey))
+	mac.Write([]byte(code))
+	sum := mac.Sum(nil)
+
+	signature := make([]byte, min(s.Config.SignatureLength, len(sum)))
+	for i := range signature {
+		signature[i] = codeAlphabet[int(sum[i])%len(codeAlphabet)]
+	}
+	return string(signature)
+}
+
+// stripSignature verifies the signature suffix of code and returns the code without it.
+// A forged or guessed code is rejected like a code that can't exist, see Config.InvalidCodes,
+// without revealing that it failed the signature rather than being missing.
+func (s *URLServiceImpl) stripSignature(code string) (string, error) {
+	n := len(code) - s.Config.SignatureLength
+	if n < 1 || !hmac.Equal([]byte(code[n:]), []byte(s.codeSignature(code[:n]))) {
+		if s.Config.InvalidCodes == InvalidCodesStrict {
+			badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("shortURL", "is not a valid short URL")})
+			return "", types.NewValidationError(badRequest.Error(), badRequest)
+		}
+		return "", types.NewNotFoundAppError("Short URL signature does not match", types.NewNotFoundError(code))
+	}
+	return code[:n], nil
+}
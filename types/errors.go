@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // Details is a struct used by BadRequestError to provide specific information
@@ -43,6 +44,23 @@ func NewNotFoundError(key string) *NotFoundError {
 	return &NotFoundError{key: key}
 }
 
+// ConflictError is used when a key cannot be created because it already exists.
+// LongURL is the long URL the existing key points to, if it has been looked up.
+type ConflictError struct {
+	Key     string
+	LongURL string
+}
+
+// Error implements the error interface for ConflictError.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("the requested key (%s) already exists", e.Key)
+}
+
+// NewConflictError creates a new ConflictError.
+func NewConflictError(key string) *ConflictError {
+	return &ConflictError{Key: key}
+}
+
 // BadRequestError is used for validation errors, providing detailed feedback
 // on which fields were incorrect.
 type BadRequestError struct {
@@ -74,13 +92,31 @@ func NewBadRequestError(details []Details) *BadRequestError {
 
 // --- Generic, Reusable Error Infrastructure ---
 
+// Stable error codes carried by AppError, for clients to branch on instead of parsing messages.
+const (
+	// ErrorCodeNotFound is the code of errors for resources that don't exist.
+	ErrorCodeNotFound = "not_found"
+	// ErrorCodeValidation is the code of errors for invalid requests.
+	ErrorCodeValidation = "validation_failed"
+	// ErrorCodeRateLimited is the code of errors for clients that sent too many requests.
+	ErrorCodeRateLimited = "rate_limited"
+	// ErrorCodeConflict is the code of errors for resources that already exist.
+	ErrorCodeConflict = "conflict"
+	// ErrorCodePayloadTooLarge is the code of errors for request bodies over the size limit.
+	ErrorCodePayloadTooLarge = "payload_too_large"
+)
+
 // AppError is a generic error type for the application.
 // It wraps underlying errors while adding context like an HTTP status code and user-facing messages.
+// Code is a stable, machine-readable identifier of the error kind, omitted if not set.
+// RetryAfter, if set, is sent as the Retry-After header, telling rate limited clients when to retry.
 type AppError struct {
-	Underlying      error `json:"-"`
-	HTTPStatus      int    `json:"-"`
-	Message         string `json:"message"`
-	InternalMessage string `json:"-"`
+	Underlying      error         `json:"-"`
+	HTTPStatus      int           `json:"-"`
+	Code            string        `json:"code,omitempty"`
+	Message         string        `json:"message"`
+	InternalMessage string        `json:"-"`
+	RetryAfter      time.Duration `json:"-"`
 }
 
 // Error implements the error interface, providing a detailed string representation for logging.
@@ -136,4 +172,57 @@ func NewAuthorizationError(internalMessage string, underlying error) *AppError {
 		http.StatusForbidden,
 		underlying,
 	)
-}
\ No newline at end of file
+}
+
+// newCodedAppError creates an AppError carrying one of the stable error codes.
+func newCodedAppError(code, message, internalMessage string, httpStatus int, underlying error) *AppError {
+	appErr := NewAppError(message, internalMessage, httpStatus, underlying)
+	appErr.Code = code
+	return appErr
+}
+
+// NewNotFoundAppError creates an AppError for resources that don't exist, usually wrapping a NotFoundError.
+func NewNotFoundAppError(internalMessage string, underlying error) *AppError {
+	return newCodedAppError(ErrorCodeNotFound, "Not Found", internalMessage, http.StatusNotFound, underlying)
+}
+
+// NewValidationError creates an AppError for invalid requests, usually wrapping a BadRequestError.
+func NewValidationError(internalMessage string, underlying error) *AppError {
+	return newCodedAppError(ErrorCodeValidation, "Bad Request", internalMessage, http.StatusBadRequest, underlying)
+}
+
+// NewRateLimitError creates an AppError for clients that exceeded a rate limit or quota.
+// Callers should set RetryAfter, or the Retry-After header, before handling it.
+func NewRateLimitError(internalMessage string, underlying error) *AppError {
+	return newCodedAppError(ErrorCodeRateLimited, "Too many requests, please retry later", internalMessage, http.StatusTooManyRequests, underlying)
+}
+
+// NewConflictAppError creates an AppError for resources that already exist, usually wrapping a ConflictError.
+func NewConflictAppError(internalMessage string, underlying error) *AppError {
+	return newCodedAppError(ErrorCodeConflict, "Conflict", internalMessage, http.StatusConflict, underlying)
+}
+
+// NewPayloadTooLargeError creates an AppError for request bodies over the size limit.
+func NewPayloadTooLargeError(internalMessage string, underlying error) *AppError {
+	return newCodedAppError(ErrorCodePayloadTooLarge, "Payload Too Large", internalMessage, http.StatusRequestEntityTooLarge, underlying)
+}
+
+// NewUnauthorizedError creates an AppError for requests without valid credentials.
+func NewUnauthorizedError(internalMessage string, underlying error) *AppError {
+	return NewAppError("Unauthorized", internalMessage, http.StatusUnauthorized, underlying)
+}
+
+// NewInternalError creates an AppError for unexpected server failures, hiding their details from clients.
+func NewInternalError(internalMessage string, underlying error) *AppError {
+	return NewAppError("Internal Server Error", internalMessage, http.StatusInternalServerError, underlying)
+}
+
+// NewNotImplementedError creates an AppError for operations the configured backend doesn't support.
+func NewNotImplementedError(internalMessage string, underlying error) *AppError {
+	return NewAppError("Not Implemented", internalMessage, http.StatusNotImplemented, underlying)
+}
+
+// NewUnavailableError creates an AppError for a database or service that is not ready or unreachable.
+func NewUnavailableError(internalMessage string, underlying error) *AppError {
+	return NewAppError("Service Unavailable", internalMessage, http.StatusServiceUnavailable, underlying)
+}
@@ -1,11 +1,16 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
-	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sqids/sqids-go"
 )
@@ -13,11 +18,30 @@ import (
 var (
 	// APIVersion is the version of the API.
 	APIVersion = "v1"
+
+	// RequestIDHeader is the name of the header carrying the request ID.
+	RequestIDHeader = "X-Request-ID"
 )
 
 // ContextKey is a type used for keys in the context.
 type ContextKey string
 
+const (
+	// BackendContextKey is the context key carrying the storage backend type serving the request.
+	BackendContextKey ContextKey = "backend"
+	// ClientIPContextKey is the context key carrying the client IP, extracted respecting trusted proxies.
+	ClientIPContextKey ContextKey = "clientIP"
+	// SpanContextKey is the context key carrying the SpanContext of the request.
+	SpanContextKey ContextKey = "span"
+)
+
+// SpanContext identifies the trace and span of a request, as propagated by the W3C traceparent header.
+// The IDs are lowercase hex, 32 characters for the trace ID and 16 for the span ID.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
 // Payload represents the structure of the JSON payload expected in requests.
 // It contains the short URL and the long URL.
 type Payload struct {
@@ -25,6 +49,314 @@ type Payload struct {
 	LongURL  string `json:"longURL"`
 }
 
+// legacyPayloadKeys are the PascalCase keys sent by clients before the JSON casing fix.
+var legacyPayloadKeys = []string{"ShortURL", "LongURL"}
+
+// UnmarshalJSON decodes a Payload by its struct tags, matching keys case-insensitively like encoding/json,
+// so the legacy PascalCase keys still decode during their deprecation window. The exact camelCase keys take
+// precedence over legacy ones, and a deprecation warning is logged when a legacy key is sent.
+// The legacy keys are to be dropped once the deprecation window ends.
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	type payload Payload // Without the UnmarshalJSON method, so decoding doesn't recurse
+	var decoded payload
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if raw, ok := fields["shortURL"]; ok {
+		if err := json.Unmarshal(raw, &decoded.ShortURL); err != nil {
+			return err
+		}
+	}
+	if raw, ok := fields["longURL"]; ok {
+		if err := json.Unmarshal(raw, &decoded.LongURL); err != nil {
+			return err
+		}
+	}
+	for _, key := range legacyPayloadKeys {
+		if _, ok := fields[key]; ok {
+			slog.Warn("Deprecated PascalCase payload keys used, send shortURL and longURL instead", "key", key)
+			break
+		}
+	}
+
+	*p = Payload(decoded)
+	return nil
+}
+
+// CheckPayload represents the structure of the JSON payload for a batch existence check.
+type CheckPayload struct {
+	ShortURLs []string `json:"shortURLs"`
+}
+
+const (
+	// StatusActive is reported for a short URL that exists and resolves.
+	StatusActive = "active"
+	// StatusNotFound is reported for a short URL that does not exist.
+	StatusNotFound = "not_found"
+)
+
+// SnakeCaser is implemented by response structs that can be rendered with snake_case JSON keys.
+// SnakeCase returns the same values in a struct whose JSON tags use snake_case.
+type SnakeCaser interface {
+	SnakeCase() interface{}
+}
+
+// ShortenResponse is the response body for a newly created short URL.
+// URL is the fully-qualified short link, only set if requested with ?full=true.
+// Counters is only set in debug mode, see ServerConfig.Debug.
+type ShortenResponse struct {
+	ShortURL string   `json:"shortURL"`
+	URL      string   `json:"url,omitempty"`
+	Counters []uint64 `json:"counters,omitempty"`
+}
+
+// shortenResponseSnake is ShortenResponse with snake_case JSON keys.
+type shortenResponseSnake struct {
+	ShortURL string   `json:"short_url"`
+	URL      string   `json:"url,omitempty"`
+	Counters []uint64 `json:"counters,omitempty"`
+}
+
+// SnakeCase implements the SnakeCaser interface for ShortenResponse.
+func (r ShortenResponse) SnakeCase() interface{} {
+	return shortenResponseSnake(r)
+}
+
+// CodeResponse is the response body for a newly created short URL in bare code mode,
+// for clients constructing their own links from the code.
+type CodeResponse struct {
+	Code string `json:"code"`
+}
+
+// UsageResponse is the response body of GET on the create endpoint, hinting how to create a short URL.
+type UsageResponse struct {
+	Message string `json:"message"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+}
+
+// ConflictResponse is the response body when a short URL already exists.
+// It points to the existing resource so clients can decide whether the existing mapping is acceptable.
+type ConflictResponse struct {
+	ShortURL string `json:"shortURL"`
+	LongURL  string `json:"longURL"`
+	Conflict bool   `json:"conflict"`
+}
+
+// conflictResponseSnake is ConflictResponse with snake_case JSON keys.
+type conflictResponseSnake struct {
+	ShortURL string `json:"short_url"`
+	LongURL  string `json:"long_url"`
+	Conflict bool   `json:"conflict"`
+}
+
+// SnakeCase implements the SnakeCaser interface for ConflictResponse.
+func (r ConflictResponse) SnakeCase() interface{} {
+	return conflictResponseSnake(r)
+}
+
+// Creator records who created a short URL and when, for abuse investigation.
+// It is only exposed through the admin API, never to the public.
+type Creator struct {
+	IP        string
+	CreatedAt time.Time
+}
+
+// CreatorResponse is the admin response body for the creator of a short URL.
+// CreatedAtUnix is CreatedAt in seconds since the Unix epoch, set only if epoch timestamps are enabled.
+type CreatorResponse struct {
+	ShortURL      string    `json:"shortURL"`
+	IP            string    `json:"ip"`
+	CreatedAt     time.Time `json:"createdAt"`
+	CreatedAtUnix *int64    `json:"createdAtUnix,omitempty"`
+}
+
+// creatorResponseSnake is CreatorResponse with snake_case JSON keys.
+type creatorResponseSnake struct {
+	ShortURL      string    `json:"short_url"`
+	IP            string    `json:"ip"`
+	CreatedAt     time.Time `json:"created_at"`
+	CreatedAtUnix *int64    `json:"created_at_unix,omitempty"`
+}
+
+// SnakeCase implements the SnakeCaser interface for CreatorResponse.
+func (r CreatorResponse) SnakeCase() interface{} {
+	return creatorResponseSnake(r)
+}
+
+// LookupResponse is the admin response body for the existing short URLs of a long URL.
+type LookupResponse struct {
+	LongURL   string   `json:"longURL"`
+	ShortURLs []string `json:"shortURLs"`
+}
+
+// lookupResponseSnake is LookupResponse with snake_case JSON keys.
+type lookupResponseSnake struct {
+	LongURL   string   `json:"long_url"`
+	ShortURLs []string `json:"short_urls"`
+}
+
+// SnakeCase implements the SnakeCaser interface for LookupResponse.
+func (r LookupResponse) SnakeCase() interface{} {
+	return lookupResponseSnake(r)
+}
+
+// URLRecord is the complete stored record of a short URL.
+// CreatedAt is nil if the creation time wasn't recorded, see ServiceConfig.RecordCreator.
+// It is internal, the public record endpoint only returns a RecordResponse.
+type URLRecord struct {
+	ShortURL  string
+	LongURL   string
+	CreatedAt *time.Time
+	Hits      uint64
+}
+
+// RecordResponse is the public response body for the record of a short URL.
+// The creation time and hits are not part of it, creation times are only exposed through the admin API.
+type RecordResponse struct {
+	ShortURL string       `json:"shortURL"`
+	LongURL  string       `json:"longURL"`
+	Preview  *LinkPreview `json:"preview,omitempty"`
+}
+
+// recordResponseSnake is RecordResponse with snake_case JSON keys.
+type recordResponseSnake struct {
+	ShortURL string       `json:"short_url"`
+	LongURL  string       `json:"long_url"`
+	Preview  *LinkPreview `json:"preview,omitempty"`
+}
+
+// Event types published on creation activity and, if enabled, on redirects.
+const (
+	EventCreated = "created"
+	EventVisited = "visited"
+)
+
+// GeoInfo is the location and network of a client IP, as resolved by a GeoResolver.
+// Empty fields are unknown.
+type GeoInfo struct {
+	Country string `json:"country,omitempty"` // ISO 3166-1 alpha-2 country code, e.g. NZ
+	ASN     uint32 `json:"asn,omitempty"`     // Autonomous system number of the network
+}
+
+// Event is a change to the stored short URLs or a visit of one, streamed to live dashboards.
+// Geo is only set on visit events, when the client IP could be resolved.
+type Event struct {
+	Type     string    `json:"type"`
+	ShortURL string    `json:"shortURL"`
+	LongURL  string    `json:"longURL"`
+	Time     time.Time `json:"time"`
+	Geo      *GeoInfo  `json:"geo,omitempty"`
+}
+
+// eventSnake is Event with snake_case JSON keys.
+type eventSnake struct {
+	Type     string    `json:"type"`
+	ShortURL string    `json:"short_url"`
+	LongURL  string    `json:"long_url"`
+	Time     time.Time `json:"time"`
+	Geo      *GeoInfo  `json:"geo,omitempty"`
+}
+
+// SnakeCase implements the SnakeCaser interface for Event.
+func (e Event) SnakeCase() interface{} {
+	return eventSnake(e)
+}
+
+// LinkPreview is the OpenGraph metadata of a long URL, for building rich previews.
+type LinkPreview struct {
+	Title       string `json:"title,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// SnakeCase implements the SnakeCaser interface for RecordResponse.
+func (r RecordResponse) SnakeCase() interface{} {
+	return recordResponseSnake(r)
+}
+
+// URLEntry is a short URL and the long URL it redirects to.
+type URLEntry struct {
+	ShortURL string `json:"shortURL"`
+	LongURL  string `json:"longURL"`
+}
+
+// urlEntrySnake is URLEntry with snake_case JSON keys.
+type urlEntrySnake struct {
+	ShortURL string `json:"short_url"`
+	LongURL  string `json:"long_url"`
+}
+
+// ListResponse is the paginated admin response body of the stored short URLs.
+// NextOffset is the offset of the next page, or null on the last page.
+type ListResponse struct {
+	Data       []URLEntry `json:"data"`
+	Total      int        `json:"total"`
+	Limit      int        `json:"limit"`
+	Offset     int        `json:"offset"`
+	NextOffset *int       `json:"nextOffset"`
+}
+
+// listResponseSnake is ListResponse with snake_case JSON keys.
+type listResponseSnake struct {
+	Data       []urlEntrySnake `json:"data"`
+	Total      int             `json:"total"`
+	Limit      int             `json:"limit"`
+	Offset     int             `json:"offset"`
+	NextOffset *int            `json:"next_offset"`
+}
+
+// SnakeCase implements the SnakeCaser interface for ListResponse.
+func (r ListResponse) SnakeCase() interface{} {
+	data := make([]urlEntrySnake, len(r.Data))
+	for i, entry := range r.Data {
+		data[i] = urlEntrySnake(entry)
+	}
+	return listResponseSnake{
+		Data:       data,
+		Total:      r.Total,
+		Limit:      r.Limit,
+		Offset:     r.Offset,
+		NextOffset: r.NextOffset,
+	}
+}
+
+// CursorListResponse is the cursor paginated admin response body of the stored short URLs.
+// NextCursor is the after cursor of the next page, or null on the last page.
+type CursorListResponse struct {
+	Data       []URLEntry `json:"data"`
+	Limit      int        `json:"limit"`
+	After      string     `json:"after"`
+	NextCursor *string    `json:"nextCursor"`
+}
+
+// cursorListResponseSnake is CursorListResponse with snake_case JSON keys.
+type cursorListResponseSnake struct {
+	Data       []urlEntrySnake `json:"data"`
+	Limit      int             `json:"limit"`
+	After      string          `json:"after"`
+	NextCursor *string         `json:"next_cursor"`
+}
+
+// SnakeCase implements the SnakeCaser interface for CursorListResponse.
+func (r CursorListResponse) SnakeCase() interface{} {
+	data := make([]urlEntrySnake, len(r.Data))
+	for i, entry := range r.Data {
+		data[i] = urlEntrySnake(entry)
+	}
+	return cursorListResponseSnake{
+		Data:       data,
+		Limit:      r.Limit,
+		After:      r.After,
+		NextCursor: r.NextCursor,
+	}
+}
+
 // SqidsGen is a generator for unique IDs using the sqids package.
 type SqidsGen struct {
 	Sqid *sqids.Sqids
@@ -39,6 +371,16 @@ func NewSqidsGen() *SqidsGen {
 	return sqidsGen
 }
 
+// NewSqidsGenWithAlphabet creates a new instance of SqidsGen encoding with alphabet instead of the default one.
+// It returns an error if sqids rejects the alphabet, e.g. for repeated or multibyte characters.
+func NewSqidsGenWithAlphabet(alphabet string) (*SqidsGen, error) {
+	squid, err := sqids.New(sqids.Options{Alphabet: alphabet})
+	if err != nil {
+		return nil, err
+	}
+	return &SqidsGen{Sqid: squid}, nil
+}
+
 // Generate creates a new unique ID using the sqids package.
 // It encodes an array of uint64 values into a string ID.
 func (s *SqidsGen) Generate(arr []uint64) string {
@@ -46,61 +388,102 @@ func (s *SqidsGen) Generate(arr []uint64) string {
 	return id
 }
 
+// Decode returns the array a unique ID was generated from.
+// It returns nil if id was not generated by Generate, since sqids decodes any string over its alphabet.
+func (s *SqidsGen) Decode(id string) []uint64 {
+	arr := s.Sqid.Decode(id)
+	if len(arr) == 0 || s.Generate(arr) != id {
+		return nil
+	}
+	return arr
+}
+
 // DecodePayload decodes the JSON payload from the request body.
 func DecodePayload(r *http.Request) (*Payload, error) {
 	var payload Payload
+	if err := decodeJSONBody(r, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
 
+// DecodeCheckPayload decodes the JSON payload of a batch existence check from the request body.
+func DecodeCheckPayload(r *http.Request) (*CheckPayload, error) {
+	var payload CheckPayload
+	if err := decodeJSONBody(r, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// decodeJSONBody reads the request body and decodes it as JSON into v.
+// It returns a BadRequestError if the body cannot be read, is empty, is not valid UTF-8 or is not valid JSON,
+// and a payload too large AppError if the body is over the size limit of an http.MaxBytesReader.
+func decodeJSONBody(r *http.Request, v interface{}) error {
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		slog.Error("Failed to read request body", "error", err)
-		return nil, NewBadRequestError([]Details{
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			badRequest := NewBadRequestError([]Details{
+				{Field: "body", Issue: fmt.Sprintf("Body exceeds the maximum size of %d bytes", maxBytesErr.Limit)},
+			})
+			return NewPayloadTooLargeError(badRequest.Error(), badRequest)
+		}
+		return NewBadRequestError([]Details{
 			{Field: "body", Issue: "Failed to read body"},
 		})
 	}
 
+	// encoding/json silently replaces invalid UTF-8 with U+FFFD, so reject it before decoding
+	if !utf8.Valid(bodyBytes) {
+		slog.Error("Request body is not valid UTF-8")
+		return NewBadRequestError([]Details{
+			{Field: "body", Issue: "Body is not valid UTF-8"},
+		})
+	}
+
+	// An empty body is a missing payload, not malformed JSON, so say so precisely
+	if len(bytes.TrimSpace(bodyBytes)) == 0 {
+		return NewBadRequestError([]Details{
+			{Field: "body", Issue: "request body is required"},
+		})
+	}
+
 	slog.Info("Raw request body", "body", string(bodyBytes))
 
-	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+	if err := json.Unmarshal(bodyBytes, v); err != nil {
 		slog.Error("Failed to decode JSON payload", "error", err)
-		return nil, NewBadRequestError([]Details{
+		return NewBadRequestError([]Details{
 			{Field: "body", Issue: "Invalid JSON format"},
 		})
 	}
-	return &payload, nil
+	return nil
 }
 
 // GlobalCounter is a thread-safe counter that can be used to generate unique IDs.
-// It uses a mutex to ensure that increments and reads are safe in a concurrent environment.
+// It uses atomic operations, so concurrent increments on the hot path don't contend on a lock.
 type GlobalCounter struct {
-	mu    sync.Mutex
-	count uint64
+	count atomic.Uint64
 }
 
 // Increment increases the counter by 1 in a thread-safe manner.
 func (c *GlobalCounter) Increment() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.count++
+	c.count.Add(1)
 }
 
 // Count returns the current value of the counter without incrementing it.
 func (c *GlobalCounter) Count() uint64 {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.count
+	return c.count.Load()
 }
 
-// GetAndIncrement returns the current value of the counter and then increments it.
+// GetAndIncrement increments the counter and returns the incremented value.
+// Each call returns a unique value, even when called concurrently.
 func (c *GlobalCounter) GetAndIncrement() uint64 {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.count++
-	return c.count
+	return c.count.Add(1)
 }
 
 // NewGlobalCounter creates a new instance of GlobalCounter.
 func NewGlobalCounter() *GlobalCounter {
-	return &GlobalCounter{
-		count: 0,
-	}
-}
\ No newline at end of file
+	return &GlobalCounter{}
+}
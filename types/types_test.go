@@ -0,0 +1,143 @@
+package types
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestGlobalCounterUnique tests that concurrent GetAndIncrement calls return unique, monotonic values.
+func TestGlobalCounterUnique(t *testing.T) {
+	counter := NewGlobalCounter()
+
+	const workers, perWorker = 8, 1000
+	results := make([][]uint64, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				results[i] = append(results[i], counter.GetAndIncrement())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool, workers*perWorker)
+	for _, values := range results {
+		for j, value := range values {
+			if seen[value] {
+				t.Fatalf("GetAndIncrement() returned %v twice", value)
+			}
+			seen[value] = true
+			if j > 0 && value <= values[j-1] {
+				t.Fatalf("GetAndIncrement() returned %v after %v, want increasing values", value, values[j-1])
+			}
+		}
+	}
+	if count := counter.Count(); count != workers*perWorker {
+		t.Errorf("Count() = %v, want %v", count, workers*perWorker)
+	}
+}
+
+// BenchmarkGlobalCounter benchmarks concurrent GetAndIncrement calls.
+func BenchmarkGlobalCounter(b *testing.B) {
+	counter := NewGlobalCounter()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.GetAndIncrement()
+		}
+	})
+}
+
+// mutexCounter is the previous mutex-guarded counter, kept as a baseline for BenchmarkGlobalCounter.
+type mutexCounter struct {
+	mu    sync.Mutex
+	count uint64
+}
+
+// BenchmarkMutexCounter benchmarks concurrent increments of a mutex-guarded counter.
+func BenchmarkMutexCounter(b *testing.B) {
+	counter := &mutexCounter{}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.mu.Lock()
+			counter.count++
+			counter.mu.Unlock()
+		}
+	})
+}
+
+// TestDecodePayloadEmptyBody tests that an empty body reports a missing body rather than invalid JSON.
+func TestDecodePayloadEmptyBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		issue string
+	}{
+		{"empty body", "", "request body is required"},
+		{"whitespace body", " \n", "request body is required"},
+		{"malformed body", "{", "Invalid JSON format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/shorten", strings.NewReader(tt.body))
+			_, err := DecodePayload(req)
+
+			var badRequest *BadRequestError
+			if !errors.As(err, &badRequest) {
+				t.Fatalf("DecodePayload() error = %v, want *BadRequestError", err)
+			}
+			want := []Details{{Field: "body", Issue: tt.issue}}
+			if !reflect.DeepEqual(badRequest.Details, want) {
+				t.Errorf("DecodePayload() details = %v, want %v", badRequest.Details, want)
+			}
+		})
+	}
+}
+
+// TestAppErrorFactories tests that each factory maps to its HTTP status and stable code, if any, and keeps the underlying error.
+func TestAppErrorFactories(t *testing.T) {
+	underlying := NewNotFoundError("abc")
+
+	tests := []struct {
+		name       string
+		factory    func(string, error) *AppError
+		wantStatus int
+		wantCode   string
+	}{
+		{"not found", NewNotFoundAppError, http.StatusNotFound, ErrorCodeNotFound},
+		{"validation", NewValidationError, http.StatusBadRequest, ErrorCodeValidation},
+		{"rate limit", NewRateLimitError, http.StatusTooManyRequests, ErrorCodeRateLimited},
+		{"conflict", NewConflictAppError, http.StatusConflict, ErrorCodeConflict},
+		{"payload too large", NewPayloadTooLargeError, http.StatusRequestEntityTooLarge, ErrorCodePayloadTooLarge},
+		{"unauthorized", NewUnauthorizedError, http.StatusUnauthorized, ""},
+		{"internal", NewInternalError, http.StatusInternalServerError, ""},
+		{"not implemented", NewNotImplementedError, http.StatusNotImplemented, ""},
+		{"unavailable", NewUnavailableError, http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appErr := tt.factory("internal", underlying)
+			if appErr.HTTPStatus != tt.wantStatus {
+				t.Errorf("HTTPStatus = %v, want %v", appErr.HTTPStatus, tt.wantStatus)
+			}
+			if appErr.Code != tt.wantCode {
+				t.Errorf("Code = %v, want %v", appErr.Code, tt.wantCode)
+			}
+			if appErr.Message == "" || appErr.InternalMessage != "internal" {
+				t.Errorf("Message = %q, InternalMessage = %q, want a message and %q", appErr.Message, appErr.InternalMessage, "internal")
+			}
+			if !errors.Is(appErr, underlying) {
+				t.Errorf("errors.Is(%v, underlying) = false, want true", appErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// ErrorFormat selects how HandleError renders errors to the client.
+type ErrorFormat string
+
+const (
+	// ErrorFormatJSON renders errors as the AppError JSON document, e.g. {"message":"Not Found"}.
+	ErrorFormatJSON ErrorFormat = "json"
+	// ErrorFormatProblem renders errors as RFC 7807 application/problem+json documents.
+	ErrorFormatProblem ErrorFormat = "problem"
+)
+
+var (
+	// errorFormat is the format used by HandleError.
+	errorFormat = ErrorFormatJSON
+)
+
+// SetErrorFormat sets the format used by HandleError.
+// It returns a ConfigError if the format is not supported.
+func SetErrorFormat(format string) error {
+	switch ErrorFormat(strings.ToLower(format)) {
+	case ErrorFormatJSON, "":
+		errorFormat = ErrorFormatJSON
+	case ErrorFormatProblem:
+		errorFormat = ErrorFormatProblem
+	default:
+		return types.NewConfigError("Unsupported error format: "+format, nil)
+	}
+	return nil
+}
+
+// ProblemDetails is an RFC 7807 problem document.
+// Code and Details carry the AppError code and the BadRequestError details as extension members,
+// InternalMessage and Underlying its internal details if debug errors are enabled.
+type ProblemDetails struct {
+	Type            string          `json:"type"`
+	Title           string          `json:"title"`
+	Status          int             `json:"status"`
+	Detail          string          `json:"detail,omitempty"`
+	Instance        string          `json:"instance,omitempty"`
+	Code            string          `json:"code,omitempty"`
+	Details         []types.Details `json:"details,omitempty"`
+	InternalMessage string          `json:"internalMessage,omitempty"`
+	Underlying      string          `json:"underlying,omitempty"`
+}
+
+// NewProblemDetails maps an AppError into a ProblemDetails document.
+// The instance identifies this occurrence of the problem, the request ID is used when it is a UUID.
+func NewProblemDetails(appErr *types.AppError, requestID string) *ProblemDetails {
+	problem := &ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(appErr.HTTPStatus),
+		Status: appErr.HTTPStatus,
+		Detail: appErr.Message,
+		Code:   appErr.Code,
+	}
+	if _, err := uuid.Parse(requestID); err == nil {
+		problem.Instance = "urn:uuid:" + requestID
+	}
+
+	var badRequest *types.BadRequestError
+	if errors.As(appErr, &badRequest) {
+		problem.Details = badRequest.Details
+	}
+	if debugErrors {
+		problem.InternalMessage = appErr.InternalMessage
+		if appErr.Underlying != nil {
+			problem.Underlying = appErr.Underlying.Error()
+		}
+	}
+	return problem
+}
+
+// writeProblem writes the AppError as an application/problem+json response.
+func writeProblem(w http.ResponseWriter, appErr *types.AppError) {
+	problem := NewProblemDetails(appErr, w.Header().Get(types.RequestIDHeader))
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		slog.Error("Failed to encode problem response", "error", err, "requestID", w.Header().Get(types.RequestIDHeader))
+	}
+}
@@ -5,20 +5,93 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pizza-nz/url-shortener/types"
 )
 
+// JSONCasing selects the casing of JSON response keys.
+type JSONCasing string
+
+const (
+	// JSONCasingCamel renders response keys in camelCase, e.g. shortURL.
+	JSONCasingCamel JSONCasing = "camel"
+	// JSONCasingSnake renders response keys in snake_case, e.g. short_url.
+	JSONCasingSnake JSONCasing = "snake"
+)
+
+var (
+	// jsonCasing is the casing used by JSONResponse.
+	jsonCasing = JSONCasingCamel
+	// debugErrors indicates whether HandleError sends the internal message and underlying error to clients.
+	debugErrors = false
+)
+
+// SetJSONCasing sets the casing of JSON response keys used by JSONResponse.
+// It returns a ConfigError if the casing is not supported.
+func SetJSONCasing(casing string) error {
+	switch JSONCasing(strings.ToLower(casing)) {
+	case JSONCasingCamel, "":
+		jsonCasing = JSONCasingCamel
+	case JSONCasingSnake:
+		jsonCasing = JSONCasingSnake
+	default:
+		return types.NewConfigError("Unsupported JSON casing: "+casing, nil)
+	}
+	return nil
+}
+
+// SetDebugErrors sets whether HandleError includes the internal message and the underlying error of an AppError
+// in the response, sparing developers a look into the logs. It leaks internals and must never be enabled in production.
+func SetDebugErrors(enabled bool) {
+	debugErrors = enabled
+}
+
+// debugErrorBody is the AppError JSON document with its internal details, sent only if debug errors are enabled.
+type debugErrorBody struct {
+	*types.AppError
+	InternalMessage string `json:"internalMessage,omitempty"`
+	Underlying      string `json:"underlying,omitempty"`
+}
+
+// errorBody returns the JSON document of appErr sent to clients, with its internal details if debug errors are enabled.
+func errorBody(appErr *types.AppError) interface{} {
+	if !debugErrors {
+		return appErr
+	}
+	body := debugErrorBody{AppError: appErr, InternalMessage: appErr.InternalMessage}
+	if appErr.Underlying != nil {
+		body.Underlying = appErr.Underlying.Error()
+	}
+	return body
+}
+
 // JSONResponse is a utility function to send a JSON response with the given status code and data.
+// If snake_case keys are configured and data implements types.SnakeCaser, the snake_case variant is sent.
+// API responses are dynamic and may be sensitive, so they are marked as not cacheable by intermediaries.
 func JSONResponse(w http.ResponseWriter, status int, data interface{}) {
+	if snakeCaser, ok := data.(types.SnakeCaser); ok && jsonCasing == JSONCasingSnake {
+		data = snakeCaser.SnakeCase()
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		slog.Error("Failed to encode JSON response", "error", err, "requestID", w.Header().Get("X-Request-ID"))
+		slog.Error("Failed to encode JSON response", "error", err, "requestID", w.Header().Get(types.RequestIDHeader))
 		http.Error(w, `{"message":"Failed to encode response"}`, http.StatusInternalServerError)
 	}
 }
 
+// Marshal encodes data as JSON with the configured key casing, for JSON written outside of JSONResponse.
+func Marshal(data interface{}) ([]byte, error) {
+	if snakeCaser, ok := data.(types.SnakeCaser); ok && jsonCasing == JSONCasingSnake {
+		data = snakeCaser.SnakeCase()
+	}
+	return json.Marshal(data)
+}
+
 // HandleError is a utility function to handle errors in HTTP handlers.
 // It logs the error and sends an appropriate JSON response to the client.
 func HandleError(w http.ResponseWriter, err error) {
@@ -27,13 +100,39 @@ func HandleError(w http.ResponseWriter, err error) {
 		// This is our custom error type, we can trust its fields.
 		slog.Error("Handle Error", "Error", appErr) // Log the detailed error
 
+		if appErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(appErr.RetryAfter/time.Second)+1))
+		}
+		if errorFormat == ErrorFormatProblem {
+			writeProblem(w, appErr)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(appErr.HTTPStatus)
-		json.NewEncoder(w).Encode(appErr)
+		json.NewEncoder(w).Encode(errorBody(appErr))
 		return
 	}
 
 	// For any other error, return a generic 500.
 	slog.Error("Handle Error", "An unexpected error occurred", err)
+	internalErr := types.NewAppError("An internal server error occurred.", "Unexpected error type", http.StatusInternalServerError, err)
+	if errorFormat == ErrorFormatProblem {
+		writeProblem(w, internalErr)
+		return
+	}
+	if debugErrors {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(internalErr.HTTPStatus)
+		json.NewEncoder(w).Encode(errorBody(internalErr))
+		return
+	}
 	http.Error(w, `{"message":"An internal server error occurred."}`, http.StatusInternalServerError)
 }
+
+// HandleMethodNotAllowed sends a 405 Method Not Allowed error with the Allow header listing the permitted methods.
+func HandleMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	allow := strings.Join(allowed, ", ")
+	w.Header().Set("Allow", allow)
+	HandleError(w, types.NewAppError("Method Not Allowed", "Only "+allow+" allowed", http.StatusMethodNotAllowed, nil))
+}
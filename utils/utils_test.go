@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pizza-nz/url-shortener/types"
+)
+
+// TestHandleErrorProblemJSON tests that HandleError renders an RFC 7807 document when configured.
+func TestHandleErrorProblemJSON(t *testing.T) {
+	if err := SetErrorFormat("problem"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetErrorFormat("json")
+
+	badRequest := types.NewBadRequestError([]types.Details{types.NewDetails("LongURL", "Long URL cannot be empty")})
+
+	rr := httptest.NewRecorder()
+	rr.Header().Set("X-Request-ID", "0b5e4b34-7a0c-4f7e-9a51-2b3f0d6c9e11")
+	HandleError(rr, types.NewAppError("Bad Request", badRequest.Error(), http.StatusBadRequest, badRequest))
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("HandleError returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Errorf("HandleError returned wrong content type: got %v want %v", contentType, "application/problem+json")
+	}
+
+	var problem ProblemDetails
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+
+	want := ProblemDetails{
+		Type:     "about:blank",
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   "Bad Request",
+		Instance: "urn:uuid:0b5e4b34-7a0c-4f7e-9a51-2b3f0d6c9e11",
+	}
+	if problem.Type != want.Type || problem.Title != want.Title || problem.Status != want.Status ||
+		problem.Detail != want.Detail || problem.Instance != want.Instance {
+		t.Errorf("HandleError returned unexpected problem: got %+v want %+v", problem, want)
+	}
+	if len(problem.Details) != 1 || problem.Details[0].Field != "LongURL" {
+		t.Errorf("HandleError returned unexpected details: got %+v", problem.Details)
+	}
+}
+
+// TestHandleErrorDefaultJSON tests that HandleError keeps the AppError JSON document by default.
+func TestHandleErrorDefaultJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	HandleError(rr, types.NewAppError("Not Found", "URL not found", http.StatusNotFound, nil))
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("HandleError returned wrong content type: got %v want %v", contentType, "application/json")
+	}
+	expected := `{"message":"Not Found"}` + "\n"
+	if rr.Body.String() != expected {
+		t.Errorf("HandleError returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+// TestHandleErrorRetryAfter tests that the RetryAfter of an AppError is sent as the Retry-After header in whole seconds.
+func TestHandleErrorRetryAfter(t *testing.T) {
+	appErr := types.NewRateLimitError("Creation rate exceeded", nil)
+	appErr.RetryAfter = 10 * time.Second
+
+	rr := httptest.NewRecorder()
+	HandleError(rr, appErr)
+
+	if status := rr.Code; status != http.StatusTooManyRequests {
+		t.Errorf("HandleError returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "11" {
+		t.Errorf("HandleError returned wrong Retry-After: got %v want %v", retryAfter, "11")
+	}
+}
+
+// TestSetErrorFormatInvalid tests that unsupported formats are rejected.
+func TestSetErrorFormatInvalid(t *testing.T) {
+	if err := SetErrorFormat("xml"); err == nil {
+		t.Error("Expected an error for an unsupported format, but got nil")
+	}
+}
+
+// TestHandleErrorDebugErrors tests that the internal message and underlying error are sent only with debug errors enabled.
+func TestHandleErrorDebugErrors(t *testing.T) {
+	appErr := types.NewAppError("Internal Server Error", "Failed to store URL", http.StatusInternalServerError, errors.New("connection refused"))
+
+	tests := []struct {
+		name        string
+		debugErrors bool
+		format      string
+		expected    string
+	}{
+		{"disabled", false, "json", `{"message":"Internal Server Error"}`},
+		{"enabled", true, "json", `{"message":"Internal Server Error","internalMessage":"Failed to store URL","underlying":"connection refused"}`},
+		{"disabled problem", false, "problem", `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"Internal Server Error"}`},
+		{"enabled problem", true, "problem", `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"Internal Server Error","internalMessage":"Failed to store URL","underlying":"connection refused"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDebugErrors(tt.debugErrors)
+			defer SetDebugErrors(false)
+			if err := SetErrorFormat(tt.format); err != nil {
+				t.Fatal(err)
+			}
+			defer SetErrorFormat("json")
+
+			rr := httptest.NewRecorder()
+			HandleError(rr, appErr)
+
+			if body := strings.TrimSpace(rr.Body.String()); body != tt.expected {
+				t.Errorf("HandleError returned unexpected body: got %v want %v", body, tt.expected)
+			}
+		})
+	}
+}